@@ -2,14 +2,24 @@ package main
 
 import (
 	"errors"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/mthsgimenez/participe/internal/auth"
 	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/env"
+	"github.com/mthsgimenez/participe/internal/passwordreset"
+	"github.com/mthsgimenez/participe/internal/session"
 	"github.com/mthsgimenez/participe/internal/user"
+	"github.com/mthsgimenez/participe/internal/verification"
 )
 
+// UserRegisterDTO is the self-registration body. CompanyId is optional, without
+// it the company is found from the email domain.
 type UserRegisterDTO struct {
 	Email     string `json:"email"`
 	Password  string `json:"password"`
@@ -51,20 +61,70 @@ func (u *UserRegisterDTO) Validate() (problems map[string]string) {
 		problems["password"] = "password cant be empty"
 	}
 
-	if u.CompanyId == 0 {
-		problems["company_id"] = "company_id cant be empty"
+	if u.CompanyId < 0 {
+		problems["company_id"] = "company_id must be a positive int"
+	}
+
+	return
+}
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email"`
+}
+
+func (f *ForgotPasswordDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if strings.TrimSpace(f.Email) == "" {
+		problems["email"] = "email cant be empty"
+	}
+
+	return
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (d *ResetPasswordDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if strings.TrimSpace(d.Token) == "" {
+		problems["token"] = "token cant be empty"
+	}
+
+	if strings.TrimSpace(d.Password) == "" {
+		problems["password"] = "password cant be empty"
+	}
+
+	return
+}
+
+type ResendVerificationDTO struct {
+	Email string `json:"email"`
+}
+
+func (d *ResendVerificationDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if strings.TrimSpace(d.Email) == "" {
+		problems["email"] = "email cant be empty"
 	}
 
 	return
 }
 
 type authHandler struct {
-	userService    *user.Service
-	companyService *company.Service
+	userService          *user.Service
+	companyService       *company.Service
+	passwordResetService *passwordreset.Service
+	verificationService  *verification.Service
+	sessionService       *session.Service
 }
 
-func NewAuthHandler(us *user.Service, cs *company.Service) *authHandler {
-	return &authHandler{us, cs}
+func NewAuthHandler(us *user.Service, cs *company.Service, ps *passwordreset.Service, vs *verification.Service, ss *session.Service) *authHandler {
+	return &authHandler{us, cs, ps, vs, ss}
 }
 
 func (h *authHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -79,7 +139,7 @@ func (h *authHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(d.Email)
+	u, err := h.userService.GetUserByEmail(r.Context(), d.Email)
 	if err != nil {
 		if errors.Is(err, user.ErrUserNotFound) {
 			RespondJSONError(w, "email or password invalid", http.StatusUnauthorized)
@@ -95,12 +155,104 @@ func (h *authHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateJWT(d.Email)
+	if !u.Active {
+		RespondJSONError(w, "account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	if !u.Verified {
+		RespondJSONError(w, "email not verified", http.StatusForbidden)
+		return
+	}
+
+	sess, refreshToken, err := h.sessionService.Start(r.Context(), u, r.UserAgent(), clientIP(r))
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := auth.GenerateJWT(u.Email, sess.Id)
 	if err != nil {
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	setAuthCookie(w, token)
+	setRefreshCookie(w, refreshToken)
+	RespondJSON(w, "login successful", http.StatusOK)
+}
+
+// handleRefresh issues a new access token from the refresh cookie, rotating the refresh token.
+func (h *authHandler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshCookieName)
+	if err != nil {
+		RespondJSONError(w, "missing refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	sess, refreshToken, err := h.sessionService.Refresh(r.Context(), cookie.Value)
+	if err != nil {
+		if errors.Is(err, session.ErrInvalidRefreshToken) {
+			clearAuthCookies(w)
+			RespondJSONError(w, "invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	u, err := h.userService.GetUser(r.Context(), sess.UserId)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	if !u.Active {
+		if err := h.sessionService.RevokeAll(r.Context(), u.Id, 0); err != nil {
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+		clearAuthCookies(w)
+		RespondJSONError(w, "account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	token, err := auth.GenerateJWT(u.Email, sess.Id)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	setAuthCookie(w, token)
+	setRefreshCookie(w, refreshToken)
+	RespondJSON(w, "token refreshed", http.StatusOK)
+}
+
+// handleLogout ends the session of the cookies. It is public so it works with an
+// expired access token, and it always clears the cookies.
+func (h *authHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	// The access token may have expired, the refresh token still identifies the session.
+	if cookie, err := r.Cookie(refreshCookieName); err == nil {
+		if err := h.sessionService.RevokeByRefreshToken(r.Context(), cookie.Value); err != nil && !errors.Is(err, session.ErrInvalidRefreshToken) {
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleJWKS publishes the public keys access tokens are signed with, so other
+// services can verify them. It is empty while tokens are signed with SECRET_KEY.
+func (h *authHandler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, auth.PublicKeys(), http.StatusOK)
+}
+
+const refreshCookieName = "refresh_token"
+
+func setAuthCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "jwt",
 		Value:    token,
@@ -109,10 +261,47 @@ func (h *authHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		Secure:   false,
 		SameSite: http.SameSiteLaxMode,
 	})
-	RespondJSON(w, "login successful", http.StatusOK)
+}
+
+// setRefreshCookie scopes the refresh token to /auth, it is only needed to refresh and log out.
+func setRefreshCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    token,
+		Path:     "/auth",
+		MaxAge:   int(session.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearAuthCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "jwt", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Path: "/auth", MaxAge: -1, HttpOnly: true})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// openRegistration reports whether anyone can sign up through /auth/register,
+// set ALLOW_OPEN_REGISTRATION=false to onboard through invitations only.
+func openRegistration() bool {
+	allowed, err := strconv.ParseBool(env.GetStringFallback("ALLOW_OPEN_REGISTRATION", "true"))
+	return err != nil || allowed
 }
 
 func (h *authHandler) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if !openRegistration() {
+		RespondJSONError(w, "registration is by invitation only", http.StatusForbidden)
+		return
+	}
+
 	u, problems, err := BindJSONValid[*UserRegisterDTO](r)
 	if err != nil {
 		if len(problems) > 0 {
@@ -124,9 +313,19 @@ func (h *authHandler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmp, err := h.companyService.GetCompany(u.CompanyId)
+	cmp, err := h.companyService.CompanyForEmail(r.Context(), u.Email, u.CompanyId)
 	if err != nil {
-		RespondJSONError(w, "invalid company_id", http.StatusBadRequest)
+		if errors.Is(err, company.ErrCompanyNotFound) {
+			RespondJSONError(w, "invalid company_id", http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, company.ErrDomainNotAllowed) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, map[string]string{"email": "email domain is not allowed to register for this company"})
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
 
@@ -142,11 +341,127 @@ func (h *authHandler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.userService.CreateUser(newUser)
+	created, err := h.userService.CreateUser(r.Context(), newUser)
 	if err != nil {
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	RespondJSON(w, "user registered", http.StatusOK)
+	// The account exists either way, a lost email can be sent again through /auth/verify/resend.
+	if err := h.verificationService.SendVerification(r.Context(), created, verificationLink()); err != nil {
+		log.Printf("register: %v", err)
+	}
+
+	RespondJSON(w, "user registered, check your email to verify it", http.StatusOK)
+}
+
+// verificationLink builds the URL of the verification email, GET /auth/verify
+// unless EMAIL_VERIFICATION_URL points to a page of the frontend.
+func verificationLink() func(token string) string {
+	verifyURL := emailLink("EMAIL_VERIFICATION_URL")
+	return func(token string) string {
+		return verifyURL + "?token=" + url.QueryEscape(token)
+	}
+}
+
+func (h *authHandler) handleVerify(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		RespondJSONError(w, "token cant be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verificationService.Verify(r.Context(), token); err != nil {
+		if errors.Is(err, verification.ErrInvalidToken) {
+			RespondJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, "email verified", http.StatusOK)
+}
+
+func (h *authHandler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	d, problems, err := BindJSONValid[*ResendVerificationDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.verificationService.ResendVerification(r.Context(), strings.TrimSpace(d.Email), verificationLink()); err != nil {
+		if errors.Is(err, verification.ErrTooManyRequests) {
+			RespondJSONError(w, "too many verification emails requested, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		log.Printf("resend verification: %v", err)
+	}
+
+	RespondJSON(w, "if the email belongs to an unverified account, a new link was sent to it", http.StatusAccepted)
+}
+
+func (h *authHandler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	d, problems, err := BindJSONValid[*ForgotPasswordDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The page that reads the token and posts it to /auth/reset-password along with the new password.
+	resetURL := emailLink("PASSWORD_RESET_URL")
+	link := func(token string) string {
+		return resetURL + "?token=" + url.QueryEscape(token)
+	}
+
+	// Failures are only logged, the answer must not tell whether the email has an account.
+	if err := h.passwordResetService.RequestReset(r.Context(), strings.TrimSpace(d.Email), link); err != nil {
+		log.Printf("forgot password: %v", err)
+	}
+
+	RespondJSON(w, "if the email belongs to an account, a reset link was sent to it", http.StatusAccepted)
+}
+
+func (h *authHandler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	d, problems, err := BindJSONValid[*ResetPasswordDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u, err := h.passwordResetService.ResetPassword(r.Context(), d.Token, d.Password)
+	if err != nil {
+		if errors.Is(err, passwordreset.ErrInvalidToken) {
+			RespondJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever knew the old password may still be logged in.
+	if err := h.sessionService.RevokeAll(r.Context(), u.Id, 0); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, "password changed", http.StatusOK)
 }
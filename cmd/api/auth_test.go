@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+func TestRegister(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("register and verify", func(t *testing.T) {
+		rec := s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{
+			Email: "bia@acme.com", Password: testPassword, CompanyId: s.acme.Id, Name: "Bia",
+		})
+		wantStatus(t, rec, http.StatusOK)
+
+		rec = s.request(t, http.MethodPost, "/auth/login", UserLoginDTO{Email: "bia@acme.com", Password: testPassword}, nil)
+		wantStatus(t, rec, http.StatusForbidden)
+
+		wantStatus(t, s.do(t, "", http.MethodGet, "/auth/verify?token=wrong", nil), http.StatusBadRequest)
+
+		// The link comes from PUBLIC_URL, never from the Host of the request.
+		if body := s.mail.last(t, "bia@acme.com"); !strings.Contains(body, testPublicURL+"/auth/verify?token=") {
+			t.Errorf("verification link isn't built from PUBLIC_URL:\n%s", body)
+		}
+
+		token := s.mail.token(t, "bia@acme.com")
+		wantStatus(t, s.do(t, "", http.MethodGet, "/auth/verify?token="+token, nil), http.StatusOK)
+		wantStatus(t, s.do(t, "", http.MethodGet, "/auth/verify?token="+token, nil), http.StatusBadRequest)
+
+		s.newSession(t, "bia@acme.com", testPassword)
+	})
+
+	t.Run("register by domain", func(t *testing.T) {
+		rec := s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{
+			Email: "dora@other.com", Password: testPassword, Name: "Dora",
+		})
+		wantStatus(t, rec, http.StatusOK)
+
+		u, err := s.users.FindByEmail(t.Context(), "dora@other.com")
+		if err != nil || u.Company.Id != s.other.Id || u.Role != user.ROLE_USER || u.Verified {
+			t.Errorf("registered user = %+v, %v", u, err)
+		}
+	})
+
+	t.Run("resend verification", func(t *testing.T) {
+		sent := s.mail.count("dora@other.com")
+
+		rec := s.do(t, "", http.MethodPost, "/auth/verify/resend", ResendVerificationDTO{Email: "dora@other.com"})
+		wantStatus(t, rec, http.StatusAccepted)
+		if s.mail.count("dora@other.com") != sent+1 {
+			t.Errorf("no verification email was sent again")
+		}
+
+		// The answer doesn't tell whether the email has an account.
+		rec = s.do(t, "", http.MethodPost, "/auth/verify/resend", ResendVerificationDTO{Email: "nobody@acme.com"})
+		wantStatus(t, rec, http.StatusAccepted)
+	})
+
+	t.Run("rejects", func(t *testing.T) {
+		rec := s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{})
+		wantStatus(t, rec, http.StatusBadRequest)
+		if problems := decode[ErrorResponse](t, rec).Problems; problems["email"] == "" || problems["password"] == "" {
+			t.Errorf("problems = %v", problems)
+		}
+
+		rec = s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{
+			Email: "eve@gmail.com", Password: testPassword, CompanyId: s.acme.Id, Name: "Eve",
+		})
+		wantStatus(t, rec, http.StatusBadRequest)
+
+		rec = s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{
+			Email: "eve@acme.com", Password: testPassword, CompanyId: 404, Name: "Eve",
+		})
+		wantStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("closed registration", func(t *testing.T) {
+		t.Setenv("ALLOW_OPEN_REGISTRATION", "false")
+
+		rec := s.do(t, "", http.MethodPost, "/auth/register", UserRegisterDTO{
+			Email: "eve@acme.com", Password: testPassword, CompanyId: s.acme.Id, Name: "Eve",
+		})
+		wantStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("sets cookies", func(t *testing.T) {
+		cookies := s.newSession(t, anaEmail, testPassword)
+		if cookie(cookies, "jwt") == nil || cookie(cookies, refreshCookieName) == nil {
+			t.Fatalf("login cookies = %v", cookies)
+		}
+
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, cookies), http.StatusOK)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		rec := s.do(t, "", http.MethodPost, "/auth/login", UserLoginDTO{Email: anaEmail, Password: "wrong"})
+		wantStatus(t, rec, http.StatusUnauthorized)
+
+		rec = s.do(t, "", http.MethodPost, "/auth/login", UserLoginDTO{Email: "nobody@acme.com", Password: testPassword})
+		wantStatus(t, rec, http.StatusUnauthorized)
+
+		wantStatus(t, s.do(t, "", http.MethodPost, "/auth/login", UserLoginDTO{}), http.StatusBadRequest)
+	})
+
+	t.Run("deactivated", func(t *testing.T) {
+		u, _ := s.users.FindByEmail(t.Context(), caioEmail)
+		u.Active = false
+		s.users.Update(t.Context(), u)
+
+		rec := s.do(t, "", http.MethodPost, "/auth/login", UserLoginDTO{Email: caioEmail, Password: testPassword})
+		wantStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	s := newTestServer(t)
+
+	wantStatus(t, s.do(t, "", http.MethodPost, "/auth/refresh", nil), http.StatusUnauthorized)
+
+	first := s.newSession(t, anaEmail, testPassword)
+
+	rec := s.request(t, http.MethodPost, "/auth/refresh", nil, first)
+	wantStatus(t, rec, http.StatusOK)
+	second := rec.Result().Cookies()
+	if cookie(second, refreshCookieName).Value == cookie(first, refreshCookieName).Value {
+		t.Fatalf("refresh token wasn't rotated")
+	}
+	wantStatus(t, s.request(t, http.MethodGet, "/me", nil, second), http.StatusOK)
+
+	// A refresh token that was already traded revokes the whole session.
+	wantStatus(t, s.request(t, http.MethodPost, "/auth/refresh", nil, first), http.StatusUnauthorized)
+	wantStatus(t, s.request(t, http.MethodGet, "/me", nil, second), http.StatusUnauthorized)
+	wantStatus(t, s.request(t, http.MethodPost, "/auth/refresh", nil, second), http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+
+	cookies := s.newSession(t, anaEmail, testPassword)
+
+	rec := s.request(t, http.MethodPost, "/auth/logout", nil, cookies)
+	wantStatus(t, rec, http.StatusNoContent)
+	if c := cookie(rec.Result().Cookies(), "jwt"); c == nil || c.MaxAge >= 0 {
+		t.Errorf("jwt cookie wasn't cleared: %v", c)
+	}
+
+	wantStatus(t, s.request(t, http.MethodGet, "/me", nil, cookies), http.StatusUnauthorized)
+
+	// Logging out without a session still clears the cookies.
+	wantStatus(t, s.do(t, "", http.MethodPost, "/auth/logout", nil), http.StatusNoContent)
+}
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, "", http.MethodPost, "/auth/forgot-password", ForgotPasswordDTO{Email: anaEmail})
+	wantStatus(t, rec, http.StatusAccepted)
+
+	rec = s.do(t, "", http.MethodPost, "/auth/forgot-password", ForgotPasswordDTO{Email: "nobody@acme.com"})
+	wantStatus(t, rec, http.StatusAccepted)
+	if s.mail.count("nobody@acme.com") != 0 {
+		t.Errorf("reset email sent to an unknown address")
+	}
+
+	token := s.mail.token(t, anaEmail)
+	newPassword := "another-secret"
+
+	t.Run("forged host", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/forgot-password", strings.NewReader(`{"email":"`+caioEmail+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Host = "attacker.test"
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		wantStatus(t, rec, http.StatusAccepted)
+
+		if body := s.mail.last(t, caioEmail); strings.Contains(body, "attacker.test") || !strings.Contains(body, testPublicURL+"/reset-password?token=") {
+			t.Errorf("reset link isn't built from PUBLIC_URL:\n%s", body)
+		}
+	})
+
+	rec = s.do(t, "", http.MethodPost, "/auth/reset-password", ResetPasswordDTO{Token: "wrong", Password: newPassword})
+	wantStatus(t, rec, http.StatusBadRequest)
+
+	rec = s.do(t, "", http.MethodPost, "/auth/reset-password", ResetPasswordDTO{Token: token, Password: newPassword})
+	wantStatus(t, rec, http.StatusOK)
+
+	rec = s.do(t, "", http.MethodPost, "/auth/reset-password", ResetPasswordDTO{Token: token, Password: newPassword})
+	wantStatus(t, rec, http.StatusBadRequest)
+
+	s.newSession(t, anaEmail, newPassword)
+}
+
+func TestJWKS(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, "", http.MethodGet, "/.well-known/jwks.json", nil)
+	wantStatus(t, rec, http.StatusOK)
+
+	// Tokens are signed with SECRET_KEY, which is never published.
+	if set := decode[auth.JWKS](t, rec); len(set.Keys) != 0 {
+		t.Errorf("JWKS = %+v, want no keys", set)
+	}
+}
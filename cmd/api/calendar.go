@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/ical"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type CalendarFeedDTO struct {
+	URL string `json:"url"`
+}
+
+type calendarHandler struct {
+	eventService *event.Service
+	userService  *user.Service
+}
+
+func NewCalendarHandler(e *event.Service, u *user.Service) *calendarHandler {
+	return &calendarHandler{e, u}
+}
+
+// handlePostCalendar issues a new feed token for the current user, invalidating the previous URL.
+func (h *calendarHandler) handlePostCalendar(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	token, err := h.userService.RotateCalendarToken(r.Context(), u.Id)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, CalendarFeedDTO{URL: publicURL() + "/calendar/" + token + ".ics"}, http.StatusOK)
+}
+
+func (h *calendarHandler) handleDeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	if err := h.userService.DisableCalendarFeed(r.Context(), u.Id); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetCalendarFeed serves the events a user registered to. It is public since
+// calendar clients can't log in, the token in the URL is the credential.
+func (h *calendarHandler) handleGetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(r.PathValue("token"), ".ics")
+
+	u, err := h.userService.GetUserByCalendarToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "calendar not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	regs, err := h.eventService.GetUserRegistrations(r.Context(), u, nil, nil)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	cal := &ical.Calendar{Name: "Participe"}
+	for _, reg := range *regs {
+		cal.Events = append(cal.Events, calendarEvents(reg.Event, reg.Status == event.STATUS_CANCELLED)...)
+	}
+
+	respondCalendar(w, cal, "participe.ics")
+}
+
+// calendarEvents converts an event to calendar entries, one per session when it has any.
+func calendarEvents(ev *event.Event, cancelled bool) []ical.Event {
+	status, sequence := ical.STATUS_CONFIRMED, 0
+	if cancelled {
+		// Bumping the sequence makes clients replace the copy they already have.
+		status, sequence = ical.STATUS_CANCELLED, 1
+	}
+
+	if len(ev.Sessions) == 0 {
+		return []ical.Event{{
+			UID:         fmt.Sprintf("event-%d@participe", ev.Id),
+			Summary:     ev.Name,
+			Description: ev.Description,
+			Start:       ev.Date,
+			End:         ev.EndDate,
+			Status:      status,
+			Sequence:    sequence,
+		}}
+	}
+
+	entries := make([]ical.Event, len(ev.Sessions))
+	for i, session := range ev.Sessions {
+		entries[i] = ical.Event{
+			UID:         fmt.Sprintf("event-%d-session-%d@participe", ev.Id, session.Id),
+			Summary:     ev.Name + " - " + session.Name,
+			Description: ev.Description,
+			Start:       session.StartsAt,
+			End:         session.EndsAt,
+			Status:      status,
+			Sequence:    sequence,
+		}
+	}
+
+	return entries
+}
+
+func respondCalendar(w http.ResponseWriter, cal *ical.Calendar, filename string) {
+	var buf bytes.Buffer
+	if err := cal.Encode(&buf); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
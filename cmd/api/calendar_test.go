@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCalendarRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	ev := s.createEvent(t, newEvent("Workshop"))
+	wantStatus(t, s.do(t, anaEmail, http.MethodPost, fmt.Sprintf("/event/%d/register", ev.Id), nil), http.StatusOK)
+
+	rec := s.do(t, anaEmail, http.MethodPost, "/me/calendar", nil)
+	wantStatus(t, rec, http.StatusOK)
+
+	feed, err := url.Parse(decode[CalendarFeedDTO](t, rec).URL)
+	if err != nil || !strings.HasPrefix(feed.Path, "/calendar/") {
+		t.Fatalf("calendar feed URL = %v, %v", feed, err)
+	}
+
+	// Calendar clients can't log in, the token in the URL is enough.
+	rec = s.do(t, "", http.MethodGet, feed.Path, nil)
+	wantStatus(t, rec, http.StatusOK)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") || !strings.Contains(rec.Body.String(), "SUMMARY:Workshop") {
+		t.Errorf("GET %s = %s", feed.Path, rec.Body.String())
+	}
+
+	// Rotating the token replaces the old feed URL.
+	rec = s.do(t, anaEmail, http.MethodPost, "/me/calendar", nil)
+	wantStatus(t, rec, http.StatusOK)
+	wantStatus(t, s.do(t, "", http.MethodGet, feed.Path, nil), http.StatusNotFound)
+
+	rotated, _ := url.Parse(decode[CalendarFeedDTO](t, rec).URL)
+	wantStatus(t, s.do(t, "", http.MethodGet, rotated.Path, nil), http.StatusOK)
+
+	wantStatus(t, s.do(t, anaEmail, http.MethodDelete, "/me/calendar", nil), http.StatusNoContent)
+	wantStatus(t, s.do(t, "", http.MethodGet, rotated.Path, nil), http.StatusNotFound)
+}
@@ -24,7 +24,7 @@ func (c *companyHandler) handleGetCompany(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	cmp, err := c.companyService.GetCompany(id)
+	cmp, err := c.companyService.GetCompany(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, company.ErrCompanyNotFound) {
 			RespondJSONError(w, "company not found", http.StatusNotFound)
@@ -39,7 +39,7 @@ func (c *companyHandler) handleGetCompany(w http.ResponseWriter, r *http.Request
 }
 
 func (c *companyHandler) handleGetCompanies(w http.ResponseWriter, r *http.Request) {
-	companies, err := c.companyService.GetCompanies()
+	companies, err := c.companyService.GetCompanies(r.Context())
 	if err != nil {
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
@@ -49,7 +49,7 @@ func (c *companyHandler) handleGetCompanies(w http.ResponseWriter, r *http.Reque
 }
 
 func (c *companyHandler) handlePostCompany(w http.ResponseWriter, r *http.Request) {
-	company, problems, err := BindJSONValid[*company.Company](r)
+	cmp, problems, err := BindJSONValid[*company.Company](r)
 	if err != nil {
 		if len(problems) > 0 {
 			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
@@ -60,8 +60,13 @@ func (c *companyHandler) handlePostCompany(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	newCompany, err := c.companyService.CreateCompany(company)
+	newCompany, err := c.companyService.CreateCompany(r.Context(), cmp)
 	if err != nil {
+		if errors.Is(err, company.ErrUniqueViolation) {
+			RespondJSONError(w, "a domain already belongs to another company", http.StatusConflict)
+			return
+		}
+
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
@@ -76,7 +81,7 @@ func (c *companyHandler) handleDeleteCompany(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := c.companyService.DeleteCompany(id); err != nil {
+	if err := c.companyService.DeleteCompany(r.Context(), id); err != nil {
 		if errors.Is(err, company.ErrCompanyNotFound) {
 			RespondJSONError(w, fmt.Sprintf("company with id %d does not exist", id), http.StatusNotFound)
 			return
@@ -108,8 +113,18 @@ func (c *companyHandler) handlePutCompany(w http.ResponseWriter, r *http.Request
 	}
 	cmp.Id = id
 
-	updatedCompany, err := c.companyService.UpdateCompany(id, cmp)
+	updatedCompany, err := c.companyService.UpdateCompany(r.Context(), id, cmp)
 	if err != nil {
+		if errors.Is(err, company.ErrCompanyNotFound) {
+			RespondJSONError(w, fmt.Sprintf("company with id %d does not exist", id), http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, company.ErrUniqueViolation) {
+			RespondJSONError(w, "a domain already belongs to another company", http.StatusConflict)
+			return
+		}
+
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/company"
+)
+
+func TestCompanyRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, adminEmail, http.MethodPost, "/company", company.Company{Name: "Globex", Domains: []string{"Globex.com"}})
+	wantStatus(t, rec, http.StatusCreated)
+	created := decode[company.Company](t, rec)
+	if created.Id == 0 || !slices.Equal(created.Domains, []string{"globex.com"}) {
+		t.Fatalf("created company = %+v", created)
+	}
+	path := fmt.Sprintf("/company/%d", created.Id)
+
+	t.Run("create rejects", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPost, "/company", company.Company{Name: "Copy", Domains: []string{"acme.com"}})
+		wantStatus(t, rec, http.StatusConflict)
+
+		rec = s.do(t, adminEmail, http.MethodPost, "/company", company.Company{Domains: []string{"not a domain"}})
+		wantStatus(t, rec, http.StatusBadRequest)
+		if problems := decode[ErrorResponse](t, rec).Problems; problems["name"] == "" || problems["domains[0]"] == "" {
+			t.Errorf("problems = %v", problems)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, "/company", nil)
+		wantStatus(t, rec, http.StatusOK)
+		stored, _ := s.companies.FindAll(t.Context())
+		if companies := decode[[]company.Company](t, rec); len(companies) != len(*stored) {
+			t.Errorf("GET /company returned %d companies, want %d", len(companies), len(*stored))
+		}
+
+		rec = s.do(t, anaEmail, http.MethodGet, path, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if found := decode[company.Company](t, rec); found.Name != "Globex" {
+			t.Errorf("GET %s = %+v", path, found)
+		}
+
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, "/company/404", nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, "/company/abc", nil), http.StatusBadRequest)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPut, path, company.Company{Name: "Globex Corp", Domains: []string{"globex.org"}})
+		wantStatus(t, rec, http.StatusOK)
+		if updated := decode[company.Company](t, rec); updated.Name != "Globex Corp" || !slices.Equal(updated.Domains, []string{"globex.org"}) {
+			t.Errorf("updated company = %+v", updated)
+		}
+
+		rec = s.do(t, adminEmail, http.MethodPut, path, company.Company{Name: "Globex Corp", Domains: []string{"other.com"}})
+		wantStatus(t, rec, http.StatusConflict)
+
+		rec = s.do(t, adminEmail, http.MethodPut, "/company/404", company.Company{Name: "Nobody"})
+		wantStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, path, nil), http.StatusNoContent)
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, path, nil), http.StatusNotFound)
+	})
+}
@@ -1,14 +1,72 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mthsgimenez/participe/internal/company"
 	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/ical"
+	"github.com/mthsgimenez/participe/internal/qrcode"
 	"github.com/mthsgimenez/participe/internal/user"
 )
 
+type AttendanceDTO struct {
+	UserId int    `json:"user_id"`
+	Status string `json:"status"`
+}
+
+func (a *AttendanceDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if a.UserId == 0 {
+		problems["user_id"] = "user_id cant be empty"
+	}
+
+	if status, ok := event.StringToRegistrationStatus(a.Status); !ok || (status != event.STATUS_ATTENDED && status != event.STATUS_NO_SHOW) {
+		problems["status"] = "status must be ATTENDED or NO_SHOW"
+	}
+
+	return
+}
+
+type CheckinTokenDTO struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func (c *CheckinTokenDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if strings.TrimSpace(c.Token) == "" {
+		problems["token"] = "token cant be empty"
+	}
+
+	return
+}
+
+// EventSeriesDTO is the first occurrence of a series along with its recurrence rule.
+type EventSeriesDTO struct {
+	event.Event
+	Rule string `json:"rule"`
+}
+
+func (d *EventSeriesDTO) Validate() (problems map[string]string) {
+	problems = d.Event.Validate()
+
+	if _, err := event.ParseRecurrence(d.Rule); err != nil {
+		problems["rule"] = err.Error()
+	}
+
+	return
+}
+
 type eventHandler struct {
 	eventService *event.Service
 	userService  *user.Service
@@ -19,7 +77,7 @@ func NewEventHandler(e *event.Service, u *user.Service) *eventHandler {
 }
 
 func (h *eventHandler) handleGetUpcomingEvents(w http.ResponseWriter, r *http.Request) {
-	events, err := h.eventService.GetUpcomingEvents()
+	events, err := h.eventService.GetUpcomingEvents(r.Context(), CurrentUser(r))
 	if err != nil {
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -29,40 +87,203 @@ func (h *eventHandler) handleGetUpcomingEvents(w http.ResponseWriter, r *http.Re
 }
 
 func (h *eventHandler) handleGetAllEvents(w http.ResponseWriter, r *http.Request) {
-	claims := GetUserClaims(r)
-	if claims == nil {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	events, err := h.eventService.GetEvents(r.Context())
+	if err != nil {
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(claims.Email)
+	RespondJSON(w, events, http.StatusOK)
+}
+
+func (h *eventHandler) handlePostRegister(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	u := CurrentUser(r)
+
+	ev, err := h.eventService.GetVisibleEvent(r.Context(), id, u)
+	if err != nil {
+		if errors.Is(err, event.ErrEventNotFound) {
+			RespondJSONError(w, "event not found", http.StatusNotFound)
+			return
+		}
+
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
 
-	if u.Role != user.ROLE_ADMIN {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	waitlisted, err := h.eventService.RegisterUserInEvent(r.Context(), ev, u)
+	if err != nil {
+		if errors.Is(err, event.ErrAlreadyRegistered) || errors.Is(err, event.ErrUniqueViolation) {
+			RespondJSONError(w, "user already registered or waitlisted", http.StatusConflict)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if waitlisted {
+		RespondJSON(w, "event is full, user added to the waitlist", http.StatusAccepted)
 		return
 	}
 
-	events, err := h.eventService.GetEvents()
+	RespondJSON(w, "user registered", http.StatusOK)
+}
+
+func (h *eventHandler) handleDeleteRegister(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	u := CurrentUser(r)
+
+	ev, err := h.eventService.GetVisibleEvent(r.Context(), id, u)
+	if err != nil {
+		if errors.Is(err, event.ErrEventNotFound) {
+			RespondJSONError(w, "event not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.eventService.CancelRegistration(r.Context(), ev, u); err != nil {
+		if errors.Is(err, event.ErrRegistrationNotFound) {
+			RespondJSONError(w, "user is not registered", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, event.ErrRegistrationFinished) {
+			RespondJSONError(w, "attendance was already recorded", http.StatusConflict)
+			return
+		}
+
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	RespondJSON(w, events, http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *eventHandler) handleGetCheckinToken(w http.ResponseWriter, r *http.Request) {
+	token, expiresAt, ok := h.issueCheckinToken(w, r)
+	if !ok {
+		return
+	}
+
+	RespondJSON(w, CheckinTokenDTO{Token: token, ExpiresAt: expiresAt}, http.StatusOK)
+}
+
+func (h *eventHandler) handleGetCheckinQR(w http.ResponseWriter, r *http.Request) {
+	token, _, ok := h.issueCheckinToken(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := qrcode.WritePNG(&buf, []byte(token), 8); err != nil {
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// issueCheckinToken writes the error response itself and reports false when no token could be issued.
+func (h *eventHandler) issueCheckinToken(w http.ResponseWriter, r *http.Request) (string, time.Time, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return "", time.Time{}, false
+	}
+
+	u := CurrentUser(r)
+
+	ev, err := h.eventService.GetVisibleEvent(r.Context(), id, u)
+	if err != nil {
+		if errors.Is(err, event.ErrEventNotFound) {
+			RespondJSONError(w, "event not found", http.StatusNotFound)
+			return "", time.Time{}, false
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return "", time.Time{}, false
+	}
+
+	token, expiresAt, err := h.eventService.IssueCheckinToken(r.Context(), ev, u)
+	if err != nil {
+		if errors.Is(err, event.ErrRegistrationNotFound) {
+			RespondJSONError(w, "user is not registered", http.StatusConflict)
+			return "", time.Time{}, false
+		}
+
+		if errors.Is(err, event.ErrAlreadyCheckedOut) {
+			RespondJSONError(w, "user already checked out", http.StatusConflict)
+			return "", time.Time{}, false
+		}
+
+		if errors.Is(err, user.ErrUserNotVerified) {
+			RespondJSONError(w, "verify your email before checking in", http.StatusForbidden)
+			return "", time.Time{}, false
+		}
+
+		var windowErr *event.CheckinWindowError
+		if errors.As(err, &windowErr) {
+			respondCheckinWindowError(w, windowErr)
+			return "", time.Time{}, false
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return "", time.Time{}, false
+	}
+
+	return token, expiresAt, true
 }
 
+// handlePostCheckin is used by admins and kiosks on site to redeem the token shown by an attendee.
 func (h *eventHandler) handlePostCheckin(w http.ResponseWriter, r *http.Request) {
+	h.redeemAttendanceToken(w, r, h.eventService.RedeemCheckinToken)
+}
+
+// handlePostCheckout is the check-out counterpart of handlePostCheckin.
+func (h *eventHandler) handlePostCheckout(w http.ResponseWriter, r *http.Request) {
+	h.redeemAttendanceToken(w, r, h.eventService.RedeemCheckoutToken)
+}
+
+func (h *eventHandler) redeemAttendanceToken(
+	w http.ResponseWriter,
+	r *http.Request,
+	redeem func(context.Context, *event.Event, string) (*event.Registration, error),
+) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
 		return
 	}
 
-	ev, err := h.eventService.GetEvent(id)
+	d, problems, err := BindJSONValid[*CheckinTokenDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ev, err := h.eventService.GetEvent(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, event.ErrEventNotFound) {
 			RespondJSONError(w, "event not found", http.StatusNotFound)
@@ -73,35 +294,131 @@ func (h *eventHandler) handlePostCheckin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	claims := GetUserClaims(r)
-	if claims == nil {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	reg, err := redeem(r.Context(), ev, d.Token)
+	if err != nil {
+		if errors.Is(err, event.ErrInvalidCheckinToken) {
+			RespondJSONError(w, "invalid or expired checkin token", http.StatusUnauthorized)
+			return
+		}
+
+		if errors.Is(err, event.ErrRegistrationNotFound) {
+			RespondJSONError(w, "user is not registered", http.StatusConflict)
+			return
+		}
+
+		if errors.Is(err, event.ErrAlreadyCheckedIn) {
+			RespondJSONError(w, "user already checked in", http.StatusConflict)
+			return
+		}
+
+		if errors.Is(err, event.ErrNotCheckedIn) {
+			RespondJSONError(w, "user is not checked in", http.StatusConflict)
+			return
+		}
+
+		if errors.Is(err, event.ErrAlreadyCheckedOut) {
+			RespondJSONError(w, "user already checked out", http.StatusConflict)
+			return
+		}
+
+		if errors.Is(err, event.ErrEventNotVisible) {
+			RespondJSONError(w, "the user's company can't attend this event", http.StatusForbidden)
+			return
+		}
+
+		var windowErr *event.CheckinWindowError
+		if errors.As(err, &windowErr) {
+			respondCheckinWindowError(w, windowErr)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(claims.Email)
+	attendee, err := h.userService.GetUser(r.Context(), reg.UserId)
 	if err != nil {
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
+	reg.User = attendee
+
+	RespondJSON(w, reg, http.StatusOK)
+}
+
+func (h *eventHandler) handlePostAttendance(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	d, problems, err := BindJSONValid[*AttendanceDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ev, err := h.eventService.GetEvent(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, event.ErrEventNotFound) {
+			RespondJSONError(w, "event not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	attendee, err := h.userService.GetUser(r.Context(), d.UserId)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	status, _ := event.StringToRegistrationStatus(d.Status)
+	reg, err := h.eventService.MarkAttendance(r.Context(), ev, attendee, status)
+	if err != nil {
+		if errors.Is(err, event.ErrRegistrationNotFound) {
+			RespondJSONError(w, "user is not registered", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, event.ErrInvalidStatus) {
+			RespondJSONError(w, "status must be ATTENDED or NO_SHOW", http.StatusBadRequest)
+			return
+		}
 
-	if err := h.eventService.CheckinUserInEvent(ev, u); err != nil {
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	RespondJSON(w, reg, http.StatusOK)
 }
 
 func (h *eventHandler) handleGetEvent(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.PathValue("id"))
+	// Patterns can't match part of a segment, so /event/{id}.ics lands here too.
+	idValue, asCalendar := strings.CutSuffix(r.PathValue("id"), ".ics")
+	id, err := strconv.Atoi(idValue)
 	if err != nil {
 		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
 		return
 	}
 
-	ev, err := h.eventService.GetEvent(id)
+	ev, err := h.eventService.GetVisibleEvent(r.Context(), id, CurrentUser(r))
 	if err != nil {
 		if errors.Is(err, event.ErrEventNotFound) {
-			RespondJSONError(w, "event not found", http.StatusInternalServerError)
+			RespondJSONError(w, "event not found", http.StatusNotFound)
 			return
 		}
 
@@ -109,37 +426,162 @@ func (h *eventHandler) handleGetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if asCalendar {
+		cal := &ical.Calendar{Name: ev.Name, Events: calendarEvents(ev, false)}
+		respondCalendar(w, cal, fmt.Sprintf("event-%d.ics", ev.Id))
+		return
+	}
+
 	RespondJSON(w, ev, http.StatusOK)
 }
 
 func (h *eventHandler) handleGetCheckins(w http.ResponseWriter, r *http.Request) {
-	claims := GetUserClaims(r)
-	if claims == nil {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	current := CurrentUser(r)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(claims.Email)
+	ev, err := h.eventService.GetEvent(r.Context(), id)
 	if err != nil {
+		if errors.Is(err, event.ErrEventNotFound) {
+			RespondJSONError(w, "event not found", http.StatusNotFound)
+			return
+		}
+
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
 
-	if u.Role != user.ROLE_ADMIN {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	var statuses []event.RegistrationStatus
+	for _, param := range r.URL.Query()["status"] {
+		for _, value := range strings.Split(param, ",") {
+			status, ok := event.StringToRegistrationStatus(value)
+			if !ok {
+				RespondJSONError(w, fmt.Sprintf("invalid status %q", value), http.StatusBadRequest)
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	list, err := h.eventService.GetCheckedUsers(r.Context(), ev, statuses...)
+	if err != nil {
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Company managers only see the attendance of their own company.
+	visible := []event.Registration{}
+	for _, reg := range *list {
+		if current.CanFor(user.PERM_VIEW_ATTENDANCE, reg.User.Company.Id) {
+			visible = append(visible, reg)
+		}
+	}
+
+	RespondJSON(w, visible, http.StatusOK)
+}
+
+func (h *eventHandler) handleGetMyEvents(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	h.respondUserEvents(w, r, u)
+}
+
+func (h *eventHandler) handleGetUserEvents(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
 		return
 	}
 
-	ev, err := h.eventService.GetEvent(id)
+	target, err := h.userService.GetUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// Users of other companies are hidden from company managers.
+	if !current.CanFor(user.PERM_VIEW_ATTENDANCE, target.Company.Id) {
+		RespondJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	h.respondUserEvents(w, r, target)
+}
+
+// respondUserEvents writes the registration history of u, limited by the from and to query params.
+func (h *eventHandler) respondUserEvents(w http.ResponseWriter, r *http.Request, u *user.User) {
+	from, err := parseDateParam(r, "from", false)
+	if err != nil {
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseDateParam(r, "to", true)
+	if err != nil {
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if from != nil && to != nil && !to.After(*from) {
+		RespondJSONError(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	regs, err := h.eventService.GetUserRegistrations(r.Context(), u, from, to)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, regs, http.StatusOK)
+}
+
+// parseDateParam reads an optional RFC 3339 timestamp or YYYY-MM-DD date from the query.
+// A plain date stands for its start, or for its end when endOfDay is set.
+func parseDateParam(r *http.Request, name string, endOfDay bool) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (2006-01-02) or an RFC 3339 timestamp", name)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return &t, nil
+}
+
+func (h *eventHandler) handleGetWaitlist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := h.eventService.GetEvent(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, event.ErrEventNotFound) {
-			RespondJSONError(w, "event not found", http.StatusInternalServerError)
+			RespondJSONError(w, "event not found", http.StatusNotFound)
 			return
 		}
 
@@ -147,7 +589,7 @@ func (h *eventHandler) handleGetCheckins(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	list, err := h.eventService.GetCheckedUsers(ev)
+	list, err := h.eventService.GetWaitlist(r.Context(), ev)
 	if err != nil {
 		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -157,20 +599,30 @@ func (h *eventHandler) handleGetCheckins(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *eventHandler) handlePostEvent(w http.ResponseWriter, r *http.Request) {
-	claims := GetUserClaims(r)
-	if claims == nil {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	ev, problems, err := BindJSONValid[*event.Event](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(claims.Email)
+	newEvent, err := h.eventService.CreateEvent(r.Context(), ev)
 	if err != nil {
-		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		respondEventWriteError(w, err)
 		return
 	}
 
-	if u.Role != user.ROLE_ADMIN {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	RespondJSON(w, newEvent, http.StatusOK)
+}
+
+func (h *eventHandler) handlePutEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
 		return
 	}
 
@@ -181,15 +633,214 @@ func (h *eventHandler) handlePostEvent(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	following, ok := parseSeriesScope(w, r)
+	if !ok {
 		return
 	}
 
-	newEvent, err := h.eventService.CreateEvent(ev)
+	if following {
+		updatedEvents, err := h.eventService.UpdateFollowingEvents(r.Context(), id, ev)
+		if err != nil {
+			respondEventWriteError(w, err)
+			return
+		}
+
+		RespondJSON(w, updatedEvents, http.StatusOK)
+		return
+	}
+
+	updatedEvent, err := h.eventService.UpdateEvent(r.Context(), id, ev)
 	if err != nil {
-		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		respondEventWriteError(w, err)
 		return
 	}
 
-	RespondJSON(w, newEvent, http.StatusOK)
+	RespondJSON(w, updatedEvent, http.StatusOK)
+}
+
+func (h *eventHandler) handlePatchEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	patch, problems, err := BindJSONValid[*event.EventPatch](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	following, ok := parseSeriesScope(w, r)
+	if !ok {
+		return
+	}
+
+	if following {
+		updatedEvents, err := h.eventService.PatchFollowingEvents(r.Context(), id, patch)
+		if err != nil {
+			respondEventWriteError(w, err)
+			return
+		}
+
+		RespondJSON(w, updatedEvents, http.StatusOK)
+		return
+	}
+
+	updatedEvent, err := h.eventService.PatchEvent(r.Context(), id, patch)
+	if err != nil {
+		respondEventWriteError(w, err)
+		return
+	}
+
+	RespondJSON(w, updatedEvent, http.StatusOK)
+}
+
+func (h *eventHandler) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	following, ok := parseSeriesScope(w, r)
+	if !ok {
+		return
+	}
+
+	deleteEvent := h.eventService.DeleteEvent
+	if following {
+		deleteEvent = h.eventService.DeleteFollowingEvents
+	}
+
+	if err := deleteEvent(r.Context(), id); err != nil {
+		respondEventWriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseSeriesScope reads the scope query param of event writes, "this" (the
+// default) only touches the given occurrence while "following" also changes the
+// later occurrences of its series.
+func parseSeriesScope(w http.ResponseWriter, r *http.Request) (following bool, ok bool) {
+	switch r.URL.Query().Get("scope") {
+	case "", "this":
+		return false, true
+	case "following":
+		return true, true
+	default:
+		RespondJSONError(w, "scope must be this or following", http.StatusBadRequest)
+		return false, false
+	}
+}
+
+func (h *eventHandler) handlePostSeries(w http.ResponseWriter, r *http.Request) {
+	d, problems, err := BindJSONValid[*EventSeriesDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := h.eventService.CreateSeries(r.Context(), &d.Event, d.Rule)
+	if err != nil {
+		if errors.Is(err, event.ErrInvalidRecurrence) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, map[string]string{"rule": err.Error()})
+			return
+		}
+
+		respondEventWriteError(w, err)
+		return
+	}
+
+	RespondJSON(w, series, http.StatusCreated)
+}
+
+func (h *eventHandler) handleGetSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	series, err := h.eventService.GetSeries(r.Context(), id, CurrentUser(r))
+	if err != nil {
+		if errors.Is(err, event.ErrSeriesNotFound) {
+			RespondJSONError(w, "series not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, series, http.StatusOK)
+}
+
+func (h *eventHandler) handleDeleteSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.eventService.DeleteSeries(r.Context(), id); err != nil {
+		if errors.Is(err, event.ErrSeriesNotFound) {
+			RespondJSONError(w, "series not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondEventWriteError maps errors returned by event writes to a response.
+func respondEventWriteError(w http.ResponseWriter, err error) {
+	var validationErr *event.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, validationErr.Problems)
+	case errors.Is(err, event.ErrEventNotFound):
+		RespondJSONError(w, "event not found", http.StatusNotFound)
+	case errors.Is(err, event.ErrUniqueViolation):
+		RespondJSONError(w, "event conflicts with an existing event", http.StatusConflict)
+	case errors.Is(err, company.ErrCompanyNotFound):
+		RespondJSONError(w, "company not found", http.StatusBadRequest)
+	case errors.Is(err, event.ErrForeignKeyViolation):
+		RespondJSONError(w, "event is still referenced by other records", http.StatusConflict)
+	default:
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+	}
+}
+
+// respondCheckinWindowError answers 409 while check-in hasn't opened yet, since
+// retrying later can succeed, and 422 once it's closed for good.
+func respondCheckinWindowError(w http.ResponseWriter, err *event.CheckinWindowError) {
+	status := http.StatusConflict
+	if err.Closed {
+		status = http.StatusUnprocessableEntity
+	}
+
+	RespondJSONErrorWithProblems(w, err.Error(), status, map[string]string{
+		"checkin_opens_at":  err.OpensAt.Format(time.RFC3339),
+		"checkin_closes_at": err.ClosesAt.Format(time.RFC3339),
+	})
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+func TestEventRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	ev := s.createEvent(t, newEvent("Workshop"))
+	path := fmt.Sprintf("/event/%d", ev.Id)
+
+	// Only the users of the other company see it.
+	private := newEvent("Other offsite")
+	private.CompanyId, private.Visibility = &s.other.Id, event.VISIBILITY_COMPANY
+	hidden := s.createEvent(t, private)
+
+	t.Run("create rejects", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPost, "/event", event.Event{})
+		wantStatus(t, rec, http.StatusBadRequest)
+		if problems := decode[ErrorResponse](t, rec).Problems; problems["name"] == "" || problems["date"] == "" {
+			t.Errorf("problems = %v", problems)
+		}
+
+		missingCompany := 404
+		missing := newEvent("Orphan")
+		missing.CompanyId = &missingCompany
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, "/event", missing), http.StatusBadRequest)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, "/event", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if events := decode[[]event.Event](t, rec); len(events) != 1 || events[0].Id != ev.Id {
+			t.Errorf("upcoming events of ana = %+v", events)
+		}
+
+		rec = s.do(t, caioEmail, http.MethodGet, "/event", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if events := decode[[]event.Event](t, rec); len(events) != 2 {
+			t.Errorf("caio sees %d upcoming events, want 2", len(events))
+		}
+
+		rec = s.do(t, adminEmail, http.MethodGet, "/event/all", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if events := decode[[]event.Event](t, rec); len(events) != 2 {
+			t.Errorf("GET /event/all returned %d events", len(events))
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, path, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if found := decode[event.Event](t, rec); found.Name != "Workshop" {
+			t.Errorf("GET %s = %+v", path, found)
+		}
+
+		rec = s.do(t, anaEmail, http.MethodGet, path+".ics", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") || !strings.Contains(rec.Body.String(), "SUMMARY:Workshop") {
+			t.Errorf("GET %s.ics = %s", path, rec.Body.String())
+		}
+
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, fmt.Sprintf("/event/%d", hidden.Id), nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, "/event/404", nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, "/event/abc", nil), http.StatusBadRequest)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		changed := *ev
+		changed.Name = "Advanced workshop"
+		rec := s.do(t, adminEmail, http.MethodPut, path, changed)
+		wantStatus(t, rec, http.StatusOK)
+		if updated := decode[event.Event](t, rec); updated.Name != "Advanced workshop" {
+			t.Errorf("PUT %s = %+v", path, updated)
+		}
+
+		capacity := 50
+		rec = s.do(t, adminEmail, http.MethodPatch, path, event.EventPatch{Capacity: &capacity})
+		wantStatus(t, rec, http.StatusOK)
+		if patched := decode[event.Event](t, rec); patched.Capacity != 50 || patched.Name != "Advanced workshop" {
+			t.Errorf("PATCH %s = %+v", path, patched)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodPut, "/event/404", changed), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodPatch, path+"?scope=all", event.EventPatch{}), http.StatusBadRequest)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		wantStatus(t, s.do(t, anaEmail, http.MethodPost, path+"/register", nil), http.StatusOK)
+		wantStatus(t, s.do(t, anaEmail, http.MethodPost, path+"/register", nil), http.StatusConflict)
+		wantStatus(t, s.do(t, anaEmail, http.MethodPost, fmt.Sprintf("/event/%d/register", hidden.Id), nil), http.StatusNotFound)
+
+		rec := s.do(t, anaEmail, http.MethodGet, "/me/events", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].EventId != ev.Id || regs[0].Status != event.STATUS_REGISTERED {
+			t.Errorf("GET /me/events = %+v", regs)
+		}
+
+		wantStatus(t, s.do(t, anaEmail, http.MethodDelete, path+"/register", nil), http.StatusNoContent)
+
+		// Hidden events are reported missing, not as events the user isn't registered to.
+		rec = s.do(t, anaEmail, http.MethodDelete, fmt.Sprintf("/event/%d/register", hidden.Id), nil)
+		wantStatus(t, rec, http.StatusNotFound)
+		if body := decode[ErrorResponse](t, rec); body.Message != "event not found" {
+			t.Errorf("DELETE hidden registration = %+v", body)
+		}
+
+		rec = s.do(t, anaEmail, http.MethodGet, "/me/events", nil)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].Status != event.STATUS_CANCELLED {
+			t.Errorf("GET /me/events after cancelling = %+v", regs)
+		}
+	})
+
+	t.Run("waitlist", func(t *testing.T) {
+		full := newEvent("Small room")
+		full.Capacity = 1
+		small := s.createEvent(t, full)
+		smallPath := fmt.Sprintf("/event/%d", small.Id)
+
+		wantStatus(t, s.do(t, anaEmail, http.MethodPost, smallPath+"/register", nil), http.StatusOK)
+		wantStatus(t, s.do(t, caioEmail, http.MethodPost, smallPath+"/register", nil), http.StatusAccepted)
+
+		rec := s.do(t, adminEmail, http.MethodGet, smallPath+"/waitlist", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if waitlist := decode[[]user.User](t, rec); len(waitlist) != 1 || waitlist[0].Email != caioEmail {
+			t.Errorf("waitlist = %+v", waitlist)
+		}
+
+		// Freeing the seat promotes caio.
+		wantStatus(t, s.do(t, anaEmail, http.MethodDelete, smallPath+"/register", nil), http.StatusNoContent)
+
+		rec = s.do(t, caioEmail, http.MethodGet, "/me/events", nil)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].Status != event.STATUS_REGISTERED {
+			t.Errorf("registrations of caio = %+v", regs)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, "/event/404/waitlist", nil), http.StatusNotFound)
+	})
+
+	t.Run("concurrent registrations", func(t *testing.T) {
+		full := newEvent("Last seat")
+		full.Capacity = 1
+		registerPath := fmt.Sprintf("/event/%d/register", s.createEvent(t, full).Id)
+
+		emails := []string{adminEmail, managerEmail, anaEmail, caioEmail}
+		for _, email := range emails {
+			s.login(t, email)
+		}
+
+		statuses := make(chan int, len(emails))
+		var wg sync.WaitGroup
+		for _, email := range emails {
+			wg.Go(func() {
+				statuses <- s.do(t, email, http.MethodPost, registerPath, nil).Code
+			})
+		}
+		wg.Wait()
+		close(statuses)
+
+		// Only one of them gets the seat, everyone else is waitlisted.
+		counts := map[int]int{}
+		for status := range statuses {
+			counts[status]++
+		}
+		if counts[http.StatusOK] != 1 || counts[http.StatusAccepted] != len(emails)-1 {
+			t.Errorf("registration statuses = %v", counts)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		gone := s.createEvent(t, newEvent("Cancelled talk"))
+		gonePath := fmt.Sprintf("/event/%d", gone.Id)
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, gonePath, nil), http.StatusNoContent)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, gonePath, nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, gonePath, nil), http.StatusNotFound)
+	})
+}
+
+func TestAttendanceRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	// Check-in is open from now on.
+	opensAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	meetup := newEvent("Meetup")
+	meetup.Date = time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	meetup.CheckinOpensAt = &opensAt
+	ev := s.createEvent(t, meetup)
+	path := fmt.Sprintf("/event/%d", ev.Id)
+
+	wantStatus(t, s.do(t, anaEmail, http.MethodGet, path+"/checkin/token", nil), http.StatusConflict)
+
+	wantStatus(t, s.do(t, anaEmail, http.MethodPost, path+"/register", nil), http.StatusOK)
+	wantStatus(t, s.do(t, caioEmail, http.MethodPost, path+"/register", nil), http.StatusOK)
+
+	rec := s.do(t, anaEmail, http.MethodGet, path+"/checkin/token", nil)
+	wantStatus(t, rec, http.StatusOK)
+	token := decode[CheckinTokenDTO](t, rec).Token
+
+	t.Run("qr code", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, path+"/checkin/qr", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if rec.Header().Get("Content-Type") != "image/png" || !strings.HasPrefix(rec.Body.String(), "\x89PNG") {
+			t.Errorf("GET %s/checkin/qr answered %s", path, rec.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("checkin and checkout", func(t *testing.T) {
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, path+"/checkout", CheckinTokenDTO{Token: token}), http.StatusConflict)
+
+		rec := s.do(t, adminEmail, http.MethodPost, path+"/checkin", CheckinTokenDTO{Token: token})
+		wantStatus(t, rec, http.StatusOK)
+		if reg := decode[event.Registration](t, rec); reg.Status != event.STATUS_ATTENDED || reg.User == nil || reg.User.Email != anaEmail {
+			t.Errorf("checkin = %+v", reg)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, path+"/checkin", CheckinTokenDTO{Token: token}), http.StatusConflict)
+
+		rec = s.do(t, adminEmail, http.MethodPost, path+"/checkout", CheckinTokenDTO{Token: token})
+		wantStatus(t, rec, http.StatusOK)
+		if reg := decode[event.Registration](t, rec); reg.CheckedOutAt == nil {
+			t.Errorf("checkout = %+v", reg)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, path+"/checkin", CheckinTokenDTO{Token: "forged"}), http.StatusUnauthorized)
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, path+"/checkin", CheckinTokenDTO{}), http.StatusBadRequest)
+	})
+
+	t.Run("mark attendance", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPost, path+"/attendance", AttendanceDTO{UserId: s.ids[caioEmail], Status: "NO_SHOW"})
+		wantStatus(t, rec, http.StatusOK)
+		if reg := decode[event.Registration](t, rec); reg.Status != event.STATUS_NO_SHOW {
+			t.Errorf("attendance = %+v", reg)
+		}
+
+		rec = s.do(t, adminEmail, http.MethodPost, path+"/attendance", AttendanceDTO{UserId: s.ids[managerEmail], Status: "ATTENDED"})
+		wantStatus(t, rec, http.StatusNotFound)
+
+		rec = s.do(t, adminEmail, http.MethodPost, path+"/attendance", AttendanceDTO{UserId: s.ids[caioEmail], Status: "REGISTERED"})
+		wantStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("list checkins", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodGet, path+"/checkin", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 2 {
+			t.Errorf("admin sees %d registrations, want 2", len(regs))
+		}
+
+		rec = s.do(t, adminEmail, http.MethodGet, path+"/checkin?status=NO_SHOW", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].UserId != s.ids[caioEmail] {
+			t.Errorf("no shows = %+v", regs)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, path+"/checkin?status=LOST", nil), http.StatusBadRequest)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, "/event/999999/checkin", nil), http.StatusNotFound)
+
+		// The manager of acme doesn't see caio.
+		rec = s.do(t, managerEmail, http.MethodGet, path+"/checkin", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].UserId != s.ids[anaEmail] {
+			t.Errorf("manager sees %+v", regs)
+		}
+	})
+
+	t.Run("user events", func(t *testing.T) {
+		caioPath := fmt.Sprintf("/user/%d/events", s.ids[caioEmail])
+
+		rec := s.do(t, adminEmail, http.MethodGet, caioPath, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 1 || regs[0].Status != event.STATUS_NO_SHOW {
+			t.Errorf("GET %s = %+v", caioPath, regs)
+		}
+
+		wantStatus(t, s.do(t, managerEmail, http.MethodGet, caioPath, nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, caioPath+"?from=yesterday", nil), http.StatusBadRequest)
+
+		// The event is today, a range ending yesterday leaves it out.
+		yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+		rec = s.do(t, adminEmail, http.MethodGet, caioPath+"?to="+yesterday, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if regs := decode[[]event.Registration](t, rec); len(regs) != 0 {
+			t.Errorf("GET %s?to=%s = %+v", caioPath, yesterday, regs)
+		}
+	})
+}
+
+func TestSeriesRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, adminEmail, http.MethodPost, "/series", EventSeriesDTO{Event: newEvent("Standup"), Rule: "FREQ=WEEKLY;COUNT=3"})
+	wantStatus(t, rec, http.StatusCreated)
+	series := decode[event.Series](t, rec)
+	if len(series.Events) != 3 {
+		t.Fatalf("created series = %+v", series)
+	}
+	path := fmt.Sprintf("/series/%d", series.Id)
+
+	t.Run("create rejects", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPost, "/series", EventSeriesDTO{Event: newEvent("Standup"), Rule: "FREQ=HOURLY"})
+		wantStatus(t, rec, http.StatusBadRequest)
+		if problems := decode[ErrorResponse](t, rec).Problems; problems["rule"] == "" {
+			t.Errorf("problems = %v", problems)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, path, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if found := decode[event.Series](t, rec); found.Rule != series.Rule || len(found.Events) != 3 {
+			t.Errorf("GET %s = %+v", path, found)
+		}
+
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, "/series/404", nil), http.StatusNotFound)
+	})
+
+	t.Run("following", func(t *testing.T) {
+		second := fmt.Sprintf("/event/%d", series.Events[1].Id)
+
+		name := "Weekly sync"
+		rec := s.do(t, adminEmail, http.MethodPatch, second+"?scope=following", event.EventPatch{Name: &name})
+		wantStatus(t, rec, http.StatusOK)
+		if updated := decode[[]event.Event](t, rec); len(updated) != 2 || updated[1].Name != name {
+			t.Errorf("PATCH %s?scope=following = %+v", second, updated)
+		}
+
+		renamed := series.Events[1]
+		renamed.Name = "Planning"
+		rec = s.do(t, adminEmail, http.MethodPut, second+"?scope=following", renamed)
+		wantStatus(t, rec, http.StatusOK)
+		if updated := decode[[]event.Event](t, rec); len(updated) != 2 || updated[0].Name != "Planning" {
+			t.Errorf("PUT %s?scope=following = %+v", second, updated)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, second+"?scope=following", nil), http.StatusNoContent)
+
+		rec = s.do(t, anaEmail, http.MethodGet, path, nil)
+		if found := decode[event.Series](t, rec); len(found.Events) != 1 || found.Events[0].Name != "Standup" {
+			t.Errorf("series after deleting the following events = %+v", found)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, path, nil), http.StatusNoContent)
+		wantStatus(t, s.do(t, anaEmail, http.MethodGet, path, nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, path, nil), http.StatusNotFound)
+	})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/invitation"
+	"github.com/mthsgimenez/participe/internal/mail"
+	"github.com/mthsgimenez/participe/internal/passwordreset"
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
+	"github.com/mthsgimenez/participe/internal/verification"
+)
+
+// The repositories below only keep what the route tests need, the ones with
+// Postgres semantics worth sharing live next to their packages.
+
+type fakeSession struct {
+	session.Session
+	refreshHash  string
+	previousHash string
+}
+
+type fakeSessionRepository struct {
+	mu       sync.Mutex
+	lastId   int
+	sessions map[int]*fakeSession
+	users    user.Repository
+}
+
+func newFakeSessionRepository(users user.Repository) *fakeSessionRepository {
+	return &fakeSessionRepository{sessions: map[int]*fakeSession{}, users: users}
+}
+
+func (r *fakeSessionRepository) active(s *fakeSession, now time.Time) bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(now)
+}
+
+func (r *fakeSessionRepository) Insert(ctx context.Context, s *session.Session, refreshHash string) (*session.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	now := time.Now()
+	stored := &fakeSession{Session: *s, refreshHash: refreshHash}
+	stored.Id, stored.CreatedAt, stored.LastUsedAt = r.lastId, now, now
+	r.sessions[stored.Id] = stored
+
+	newSession := stored.Session
+	return &newSession, nil
+}
+
+func (r *fakeSessionRepository) FindActiveById(ctx context.Context, id int) (*session.Session, error) {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	if !ok || !r.active(s, time.Now()) {
+		r.mu.Unlock()
+		return nil, session.ErrSessionNotFound
+	}
+	found := s.Session
+	r.mu.Unlock()
+
+	if u, err := r.users.FindById(ctx, found.UserId); err != nil || !u.Active {
+		return nil, session.ErrSessionNotFound
+	}
+
+	return &found, nil
+}
+
+func (r *fakeSessionRepository) FindByRefreshHash(ctx context.Context, hash string) (*session.Session, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.refreshHash == hash || s.previousHash == hash {
+			found := s.Session
+			return &found, s.previousHash == hash, nil
+		}
+	}
+	return nil, false, session.ErrSessionNotFound
+}
+
+func (r *fakeSessionRepository) FindActiveByUser(ctx context.Context, userId int) (*[]session.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := []session.Session{}
+	for _, s := range r.sessions {
+		if s.UserId == userId && r.active(s, time.Now()) {
+			sessions = append(sessions, s.Session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b session.Session) int { return b.Id - a.Id })
+
+	return &sessions, nil
+}
+
+func (r *fakeSessionRepository) Rotate(ctx context.Context, id int, oldHash, newHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.refreshHash != oldHash || !r.active(s, time.Now()) {
+		return session.ErrSessionNotFound
+	}
+
+	s.previousHash, s.refreshHash = s.refreshHash, newHash
+	s.LastUsedAt, s.ExpiresAt = time.Now(), expiresAt
+	return nil
+}
+
+func (r *fakeSessionRepository) Revoke(ctx context.Context, id, userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok || s.UserId != userId || s.RevokedAt != nil {
+		return session.ErrSessionNotFound
+	}
+
+	now := time.Now()
+	s.RevokedAt = &now
+	return nil
+}
+
+func (r *fakeSessionRepository) RevokeAllByUser(ctx context.Context, userId, except int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range r.sessions {
+		if s.UserId == userId && s.Id != except && s.RevokedAt == nil {
+			s.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeInvitationRepository struct {
+	mu          sync.Mutex
+	invitations []invitation.Invitation
+}
+
+func (r *fakeInvitationRepository) find(id int) *invitation.Invitation {
+	for i := range r.invitations {
+		if r.invitations[i].Id == id {
+			return &r.invitations[i]
+		}
+	}
+	return nil
+}
+
+func (r *fakeInvitationRepository) FindById(ctx context.Context, id int) (*invitation.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv := r.find(id)
+	if inv == nil {
+		return nil, invitation.ErrInvitationNotFound
+	}
+	found := *inv
+	return &found, nil
+}
+
+func (r *fakeInvitationRepository) FindPending(ctx context.Context) (*[]invitation.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := []invitation.Invitation{}
+	for _, inv := range slices.Backward(r.invitations) {
+		if inv.Pending(time.Now()) {
+			pending = append(pending, inv)
+		}
+	}
+	return &pending, nil
+}
+
+func (r *fakeInvitationRepository) Insert(ctx context.Context, inv *invitation.Invitation) (*invitation.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newInv := *inv
+	newInv.Id = len(r.invitations) + 1
+	newInv.CreatedAt = time.Now()
+	r.invitations = append(r.invitations, newInv)
+	return &newInv, nil
+}
+
+func (r *fakeInvitationRepository) RevokePendingByEmail(ctx context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i, inv := range r.invitations {
+		if inv.Email == email && inv.AcceptedAt == nil && inv.RevokedAt == nil {
+			r.invitations[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeInvitationRepository) Revoke(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv := r.find(id)
+	if inv == nil || inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return invitation.ErrInvitationNotFound
+	}
+	now := time.Now()
+	inv.RevokedAt = &now
+	return nil
+}
+
+func (r *fakeInvitationRepository) MarkAccepted(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inv := r.find(id)
+	if inv == nil || !inv.Pending(time.Now()) {
+		return invitation.ErrInvitationNotFound
+	}
+	now := time.Now()
+	inv.AcceptedAt = &now
+	return nil
+}
+
+type fakePasswordResetRepository struct {
+	mu     sync.Mutex
+	lastId int
+	tokens []passwordreset.Token
+}
+
+func (r *fakePasswordResetRepository) Insert(ctx context.Context, t *passwordreset.Token) (*passwordreset.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	newToken := *t
+	newToken.Id = r.lastId
+	newToken.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, newToken)
+	return &newToken, nil
+}
+
+func (r *fakePasswordResetRepository) Consume(ctx context.Context, hash string) (*passwordreset.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i, t := range r.tokens {
+		if t.Hash == hash && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			r.tokens[i].UsedAt = &now
+			used := r.tokens[i]
+			return &used, nil
+		}
+	}
+	return nil, passwordreset.ErrTokenNotFound
+}
+
+func (r *fakePasswordResetRepository) DeleteByUser(ctx context.Context, userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = slices.DeleteFunc(r.tokens, func(t passwordreset.Token) bool {
+		return t.UserId == userId && t.UsedAt == nil
+	})
+	return nil
+}
+
+type fakeVerificationRepository struct {
+	mu     sync.Mutex
+	lastId int
+	tokens []verification.Token
+}
+
+func (r *fakeVerificationRepository) Insert(ctx context.Context, t *verification.Token) (*verification.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	newToken := *t
+	newToken.Id = r.lastId
+	newToken.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, newToken)
+	return &newToken, nil
+}
+
+func (r *fakeVerificationRepository) Consume(ctx context.Context, hash string) (*verification.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tokens {
+		if t.Hash == hash && t.ExpiresAt.After(time.Now()) {
+			r.tokens = slices.Delete(r.tokens, i, i+1)
+			return &t, nil
+		}
+	}
+	return nil, verification.ErrTokenNotFound
+}
+
+func (r *fakeVerificationRepository) CountSince(ctx context.Context, userId int, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, t := range r.tokens {
+		if t.UserId == userId && t.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeVerificationRepository) DeleteByUser(ctx context.Context, userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = slices.DeleteFunc(r.tokens, func(t verification.Token) bool {
+		return t.UserId == userId
+	})
+	return nil
+}
+
+// mailbox keeps the messages sent instead of delivering them.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *mailbox) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`[?&]token=([^\s&]+)`)
+
+// last returns the body of the last message sent to to.
+func (m *mailbox) last(t *testing.T, to string) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range slices.Backward(m.messages) {
+		if msg.To == to {
+			return msg.Body
+		}
+	}
+
+	t.Fatalf("no message sent to %s", to)
+	return ""
+}
+
+// token returns the token of the link in the last message sent to to.
+func (m *mailbox) token(t *testing.T, to string) string {
+	t.Helper()
+
+	body := m.last(t, to)
+	match := linkToken.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("message to %s has no token link:\n%s", to, body)
+	}
+
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("unescape token: %v", err)
+	}
+	return token
+}
+
+func (m *mailbox) count(to string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, msg := range m.messages {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/invitation"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+const maxBulkInvitations = 100
+
+type InviteDTO struct {
+	Email     string `json:"email"`
+	CompanyId int    `json:"company_id"`
+	Role      string `json:"role"`
+}
+
+// InvitationsDTO invites one or more people at once.
+type InvitationsDTO struct {
+	Invitations []InviteDTO `json:"invitations"`
+}
+
+func (d *InvitationsDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if len(d.Invitations) == 0 {
+		problems["invitations"] = "invitations cant be empty"
+	}
+
+	if len(d.Invitations) > maxBulkInvitations {
+		problems["invitations"] = fmt.Sprintf("at most %d invitations can be sent at once", maxBulkInvitations)
+	}
+
+	for i, inv := range d.Invitations {
+		if !strings.Contains(inv.Email, "@") {
+			problems[fmt.Sprintf("invitations[%d].email", i)] = "email must be a valid address"
+		}
+
+		if inv.CompanyId <= 0 {
+			problems[fmt.Sprintf("invitations[%d].company_id", i)] = "company_id cant be empty"
+		}
+
+		if _, ok := user.ParseUserRole(inv.Role); inv.Role != "" && !ok {
+			problems[fmt.Sprintf("invitations[%d].role", i)] = "role must be ROLE_USER, ROLE_COMPANY_MANAGER or ROLE_ADMIN"
+		}
+	}
+
+	return
+}
+
+// InviteResultDTO is the outcome of one invitation of a bulk request, which
+// doesn't stop at the first failure.
+type InviteResultDTO struct {
+	Email      string                 `json:"email"`
+	Invitation *invitation.Invitation `json:"invitation,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type AcceptInvitationDTO struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func (d *AcceptInvitationDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if strings.TrimSpace(d.Token) == "" {
+		problems["token"] = "token cant be empty"
+	}
+
+	if strings.TrimSpace(d.Name) == "" {
+		problems["name"] = "name cant be empty"
+	}
+
+	if strings.TrimSpace(d.Password) == "" {
+		problems["password"] = "password cant be empty"
+	}
+
+	return
+}
+
+type invitationHandler struct {
+	invitationService *invitation.Service
+}
+
+func NewInvitationHandler(is *invitation.Service) *invitationHandler {
+	return &invitationHandler{is}
+}
+
+func (h *invitationHandler) handlePostInvitations(w http.ResponseWriter, r *http.Request) {
+	inviter := CurrentUser(r)
+
+	d, problems, err := BindJSONValid[*InvitationsDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inviteURL := emailLink("INVITATION_URL")
+	link := func(token string) string {
+		return inviteURL + "?token=" + url.QueryEscape(token)
+	}
+
+	results := make([]InviteResultDTO, len(d.Invitations))
+	for i, inv := range d.Invitations {
+		role := user.UserRole(user.ROLE_USER)
+		if inv.Role != "" {
+			role, _ = user.ParseUserRole(inv.Role)
+		}
+
+		results[i].Email = inv.Email
+		if !inviter.CanFor(user.PERM_MANAGE_USERS, inv.CompanyId) {
+			results[i].Error = "you can only invite people to your own company"
+			continue
+		}
+
+		if !inviter.CanAssign(role) {
+			results[i].Error = "you can't grant a role above your own"
+			continue
+		}
+
+		created, err := h.invitationService.Invite(r.Context(), inviter, inv.Email, inv.CompanyId, role, link)
+		switch {
+		case err == nil:
+			results[i].Invitation = created
+		case errors.Is(err, invitation.ErrAlreadyRegistered):
+			results[i].Error = "email already has an account"
+		case errors.Is(err, company.ErrCompanyNotFound):
+			results[i].Error = "company not found"
+		default:
+			results[i].Error = "something went wrong"
+		}
+	}
+
+	RespondJSON(w, results, http.StatusOK)
+}
+
+func (h *invitationHandler) handleGetInvitations(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	invitations, err := h.invitationService.GetPendingInvitations(r.Context())
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// Company managers only see the invitations to their own company.
+	visible := []invitation.Invitation{}
+	for _, inv := range *invitations {
+		if current.CanFor(user.PERM_MANAGE_USERS, inv.CompanyId) {
+			visible = append(visible, inv)
+		}
+	}
+
+	RespondJSON(w, visible, http.StatusOK)
+}
+
+func (h *invitationHandler) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.invitationService.GetInvitation(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, invitation.ErrInvitationNotFound) {
+			RespondJSONError(w, "pending invitation not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	if !current.CanFor(user.PERM_MANAGE_USERS, inv.CompanyId) {
+		RespondJSONError(w, "pending invitation not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.invitationService.Revoke(r.Context(), id); err != nil {
+		if errors.Is(err, invitation.ErrInvitationNotFound) {
+			RespondJSONError(w, "pending invitation not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetInvitation lets the accept page show who the invitation is for before the account is created.
+func (h *invitationHandler) handleGetInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, err := h.invitationService.GetInvitationByToken(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, invitation.ErrInvalidToken) {
+			RespondJSONError(w, "invalid or expired invitation", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, inv, http.StatusOK)
+}
+
+func (h *invitationHandler) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	d, problems, err := BindJSONValid[*AcceptInvitationDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u, err := h.invitationService.Accept(r.Context(), d.Token, strings.TrimSpace(d.Name), d.Password)
+	if err != nil {
+		if errors.Is(err, invitation.ErrInvalidToken) {
+			RespondJSONError(w, "invalid or expired invitation", http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, invitation.ErrAlreadyRegistered) {
+			RespondJSONError(w, "email already has an account", http.StatusConflict)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, u, http.StatusCreated)
+}
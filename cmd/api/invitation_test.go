@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/invitation"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+func TestInvitationRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, managerEmail, http.MethodPost, "/invitation", InvitationsDTO{Invitations: []InviteDTO{
+		{Email: "New@acme.com", CompanyId: s.acme.Id},
+		{Email: "someone@other.com", CompanyId: s.other.Id},
+		{Email: anaEmail, CompanyId: s.acme.Id},
+		{Email: "boss@acme.com", CompanyId: s.acme.Id, Role: "ROLE_ADMIN"},
+	}})
+	wantStatus(t, rec, http.StatusOK)
+
+	results := decode[[]InviteResultDTO](t, rec)
+	if len(results) != 4 || results[0].Invitation == nil || results[0].Invitation.Email != "new@acme.com" {
+		t.Fatalf("POST /invitation = %+v", results)
+	}
+	for i, want := range []string{
+		"you can only invite people to your own company",
+		"email already has an account",
+		"you can't grant a role above your own",
+	} {
+		if results[i+1].Invitation != nil || results[i+1].Error != want {
+			t.Errorf("result %d = %+v, want error %q", i+1, results[i+1], want)
+		}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodPost, "/invitation", InvitationsDTO{Invitations: []InviteDTO{
+			{Email: "someone@other.com", CompanyId: s.other.Id},
+		}})
+		wantStatus(t, rec, http.StatusOK)
+
+		rec = s.do(t, adminEmail, http.MethodGet, "/invitation", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if pending := decode[[]invitation.Invitation](t, rec); len(pending) != 2 {
+			t.Errorf("admin sees %d invitations, want 2", len(pending))
+		}
+
+		// Company managers only see the invitations to their company.
+		rec = s.do(t, managerEmail, http.MethodGet, "/invitation", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if pending := decode[[]invitation.Invitation](t, rec); len(pending) != 1 || pending[0].Email != "new@acme.com" {
+			t.Errorf("manager sees %+v", pending)
+		}
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, "/invitation", InvitationsDTO{}), http.StatusBadRequest)
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		// The link comes from PUBLIC_URL, never from the Host of the manager's request.
+		if body := s.mail.last(t, "new@acme.com"); !strings.Contains(body, testPublicURL+"/accept-invitation?token=") {
+			t.Errorf("invitation link isn't built from PUBLIC_URL:\n%s", body)
+		}
+
+		token := s.mail.token(t, "new@acme.com")
+
+		rec := s.do(t, "", http.MethodGet, "/auth/invitation?token="+url.QueryEscape(token), nil)
+		wantStatus(t, rec, http.StatusOK)
+		if inv := decode[invitation.Invitation](t, rec); inv.Email != "new@acme.com" || inv.CompanyId != s.acme.Id {
+			t.Errorf("GET /auth/invitation = %+v", inv)
+		}
+
+		wantStatus(t, s.do(t, "", http.MethodGet, "/auth/invitation?token=forged", nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, "", http.MethodPost, "/auth/invitation/accept", AcceptInvitationDTO{Token: token}), http.StatusBadRequest)
+
+		rec = s.do(t, "", http.MethodPost, "/auth/invitation/accept", AcceptInvitationDTO{Token: token, Name: "New", Password: testPassword})
+		wantStatus(t, rec, http.StatusCreated)
+		if u := decode[user.User](t, rec); u.Email != "new@acme.com" || u.Role != user.ROLE_USER || !u.Verified {
+			t.Errorf("accepted user = %+v", u)
+		}
+
+		// The link only works once, and the account can log in right away.
+		rec = s.do(t, "", http.MethodPost, "/auth/invitation/accept", AcceptInvitationDTO{Token: token, Name: "New", Password: testPassword})
+		wantStatus(t, rec, http.StatusBadRequest)
+		s.newSession(t, "new@acme.com", testPassword)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodGet, "/invitation", nil)
+		pending := decode[[]invitation.Invitation](t, rec)
+		if len(pending) != 1 {
+			t.Fatalf("pending invitations = %+v", pending)
+		}
+		path := fmt.Sprintf("/invitation/%d", pending[0].Id)
+
+		// Invitations to other companies are hidden from company managers.
+		wantStatus(t, s.do(t, managerEmail, http.MethodDelete, path, nil), http.StatusNotFound)
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, path, nil), http.StatusNoContent)
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, path, nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, "/invitation/abc", nil), http.StatusBadRequest)
+
+		token := s.mail.token(t, "someone@other.com")
+		wantStatus(t, s.do(t, "", http.MethodGet, "/auth/invitation?token="+url.QueryEscape(token), nil), http.StatusNotFound)
+	})
+}
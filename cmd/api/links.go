@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mthsgimenez/participe/internal/env"
+)
+
+// Links sent by email carry tokens, so they are only built from the configuration.
+// The Host header is picked by the client, a forged one would mail the token to
+// whoever sent it.
+
+// emailLinks maps the variable of each page linked from emails to its path under
+// PUBLIC_URL, used when the variable is unset.
+var emailLinks = map[string]string{
+	"PASSWORD_RESET_URL":     "/reset-password",
+	"EMAIL_VERIFICATION_URL": "/auth/verify",
+	"INVITATION_URL":         "/accept-invitation",
+}
+
+// publicURL is the base URL clients use to reach the API, from PUBLIC_URL. Empty
+// when unset, which leaves the URLs built on it relative to the API.
+func publicURL() string {
+	return strings.TrimSuffix(env.GetStringFallback("PUBLIC_URL", ""), "/")
+}
+
+// emailLink is the URL of the page name configures, or its path under PUBLIC_URL.
+func emailLink(name string) string {
+	return env.GetStringFallback(name, publicURL()+emailLinks[name])
+}
+
+// checkEmailLinks fails unless every link sent by email has a configured base,
+// PUBLIC_URL or its own variable. It runs at startup.
+func checkEmailLinks() error {
+	if publicURL() != "" {
+		return nil
+	}
+
+	for name := range emailLinks {
+		if env.GetStringFallback(name, "") == "" {
+			return fmt.Errorf("PUBLIC_URL or %s must be set", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckEmailLinks(t *testing.T) {
+	every := map[string]string{}
+	for name := range emailLinks {
+		every[name] = "https://app.participe.test/" + name
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"nothing set", map[string]string{}, true},
+		{"public url", map[string]string{"PUBLIC_URL": "https://participe.test"}, false},
+		{"every link", every, false},
+		{"only the reset link", map[string]string{"PASSWORD_RESET_URL": "https://app.participe.test/reset"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "PUBLIC_URL", tt.env["PUBLIC_URL"])
+			for name := range emailLinks {
+				setenv(t, name, tt.env[name])
+			}
+
+			if err := checkEmailLinks(); (err != nil) != tt.wantErr {
+				t.Errorf("checkEmailLinks error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// setenv sets the variable for the test, an empty value unsets it.
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+
+	t.Setenv(name, value)
+	if value == "" {
+		os.Unsetenv(name)
+	}
+}
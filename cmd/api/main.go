@@ -1,41 +1,66 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/mthsgimenez/participe/internal/auth"
 	"github.com/mthsgimenez/participe/internal/company"
 	"github.com/mthsgimenez/participe/internal/db"
 	"github.com/mthsgimenez/participe/internal/env"
 	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/invitation"
+	"github.com/mthsgimenez/participe/internal/mail"
+	"github.com/mthsgimenez/participe/internal/migrate"
+	"github.com/mthsgimenez/participe/internal/passwordreset"
+	"github.com/mthsgimenez/participe/internal/session"
 	"github.com/mthsgimenez/participe/internal/user"
+	"github.com/mthsgimenez/participe/internal/verification"
 )
 
 var (
-	companyRepository company.Repository
-	companyService    *company.Service
-	companyH          *companyHandler
-	userRepository    user.Repository
-	userService       *user.Service
-	userH             *userHandler
-	authH             *authHandler
-	eventRepository   event.Repository
-	eventService      *event.Service
-	eventH            *eventHandler
+	companyRepository       company.Repository
+	companyService          *company.Service
+	companyH                *companyHandler
+	userRepository          user.Repository
+	userService             *user.Service
+	userH                   *userHandler
+	mailer                  mail.Mailer
+	passwordResetRepository passwordreset.Repository
+	passwordResetService    *passwordreset.Service
+	verificationRepository  verification.Repository
+	verificationService     *verification.Service
+	authH                   *authHandler
+	eventRepository         event.Repository
+	eventService            *event.Service
+	eventH                  *eventHandler
+	calendarH               *calendarHandler
+	invitationRepository    invitation.Repository
+	invitationService       *invitation.Service
+	invitationH             *invitationHandler
+	sessionRepository       session.Repository
+	sessionService          *session.Service
 )
 
 func main() {
-	dbUser := env.GetStringFallback("DATABASE_USER", "postgres")
-	dbPassword := env.GetStringFallback("DATABASE_PASSWORD", "postgres")
-	dbHost := env.GetStringFallback("DATABASE_HOST", "localhost")
-	dbPort := env.GetStringFallback("DATABASE_PORT", "5432")
-	dbName := env.GetStringFallback("DATABASE_NAME", "postgres")
+	connString := db.ConnStringFromEnv()
 
-	connString := fmt.Sprintf(
-		"user=%s password=%s host=%s port=%s dbname=%s sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName,
-	)
+	requestTimeout, err := time.ParseDuration(env.GetStringFallback("REQUEST_TIMEOUT", "30s"))
+	if err != nil {
+		panic("error parsing REQUEST_TIMEOUT: " + err.Error())
+	}
+
+	if err := auth.LoadKeys(); err != nil {
+		panic("error loading auth keys: " + err.Error())
+	}
+
+	if err := checkEmailLinks(); err != nil {
+		panic("error configuring email links: " + err.Error())
+	}
 
 	conn, err := db.ConnectToDB(connString)
 	if err != nil {
@@ -43,24 +68,59 @@ func main() {
 	}
 	defer conn.Close()
 
+	if migrateOnStart, _ := strconv.ParseBool(env.GetStringFallback("MIGRATE_ON_START", "false")); migrateOnStart {
+		migrator, err := migrate.New(conn)
+		if err != nil {
+			panic("error loading migrations: " + err.Error())
+		}
+
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			panic("error migrating database: " + err.Error())
+		}
+
+		for _, m := range applied {
+			log.Printf("applied migration %04d_%s", m.Version, m.Name)
+		}
+	}
+
 	// Dependencies
 
 	companyRepository = company.NewRepositoryPostgres(conn)
-	companyService = company.NewService(companyRepository)
+	companyService = company.NewService(companyRepository, company.NewTransactorPostgres(conn))
 	companyH = newCompanyHandler(companyService)
 
 	userRepository = user.NewRepositoryPostgres(conn)
 	userService = user.NewService(userRepository, companyRepository)
-	userH = NewUserHandler(userService)
 
-	authH = NewAuthHandler(userService, companyService)
+	mailer, err = mail.NewFromEnv()
+	if err != nil {
+		panic("error configuring mailer: " + err.Error())
+	}
+
+	passwordResetRepository = passwordreset.NewRepositoryPostgres(conn)
+	passwordResetService = passwordreset.NewService(passwordResetRepository, userRepository, passwordreset.NewTransactorPostgres(conn), mailer)
+
+	verificationRepository = verification.NewRepositoryPostgres(conn)
+	verificationService = verification.NewService(verificationRepository, userRepository, verification.NewTransactorPostgres(conn), mailer)
+
+	sessionRepository = session.NewRepositoryPostgres(conn)
+	sessionService = session.NewService(sessionRepository)
+
+	userH = NewUserHandler(userService, verificationService, sessionService)
+	authH = NewAuthHandler(userService, companyService, passwordResetService, verificationService, sessionService)
 
 	eventRepository = event.NewRepositoryPostgres(conn)
-	eventService = event.NewService(eventRepository)
+	eventService = event.NewService(eventRepository, event.NewTransactorPostgres(conn))
 	eventH = NewEventHandler(eventService, userService)
+	calendarH = NewCalendarHandler(eventService, userService)
+
+	invitationRepository = invitation.NewRepositoryPostgres(conn)
+	invitationService = invitation.NewService(invitationRepository, userRepository, companyRepository, invitation.NewTransactorPostgres(conn), mailer)
+	invitationH = NewInvitationHandler(invitationService)
 
-	mux := createRoutes(companyH, authH, eventH, userH)
-	muxWithCors := CorsMiddleware(mux)
+	mux := createRoutes(companyH, authH, eventH, userH, calendarH, invitationH, userService, sessionService)
+	muxWithCors := CorsMiddleware(TimeoutMiddleware(requestTimeout, mux))
 
 	// -------------
 
@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "userClaims"
+const (
+	userContextKey        contextKey = "userClaims"
+	sessionContextKey     contextKey = "session"
+	currentUserContextKey contextKey = "currentUser"
+)
 
 func GetUserClaims(r *http.Request) *auth.Claims {
 	if claims, ok := r.Context().Value(userContextKey).(*auth.Claims); ok {
@@ -18,7 +26,9 @@ func GetUserClaims(r *http.Request) *auth.Claims {
 	return nil
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// AuthMiddleware requires a valid access token whose session is still active,
+// so revoking a session takes effect on the next request.
+func AuthMiddleware(sessions *session.Service, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("jwt")
 		if err != nil {
@@ -33,11 +43,81 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		sess, err := sessions.Validate(r.Context(), claims.SessionId)
+		if err != nil {
+			if errors.Is(err, session.ErrSessionNotFound) {
+				RespondJSONError(w, "session expired or revoked", http.StatusUnauthorized)
+				return
+			}
+
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), userContextKey, claims)
+		ctx = context.WithValue(ctx, sessionContextKey, sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CurrentUser returns the user loaded by CurrentUserMiddleware.
+func CurrentUser(r *http.Request) *user.User {
+	if u, ok := r.Context().Value(currentUserContextKey).(*user.User); ok {
+		return u
+	}
+	return nil
+}
+
+// CurrentUserMiddleware loads the logged in user once for the handlers, which get
+// it with CurrentUser. It must run behind AuthMiddleware.
+//
+// The user is the owner of the validated session rather than whoever has the email
+// of the token, which can have changed hands since the token was issued.
+func CurrentUserMiddleware(users *user.Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := r.Context().Value(sessionContextKey).(*session.Session)
+		if !ok {
+			RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		u, err := users.GetUser(r.Context(), sess.UserId)
+		if err != nil {
+			// The account was deleted since the session was validated.
+			if errors.Is(err, user.ErrUserNotFound) {
+				RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), currentUserContextKey, u)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequirePermission only lets the request through when the role of the current
+// user grants p, in any scope. Handlers of scoped permissions still have to check
+// the company of what they touch.
+func RequirePermission(p user.Permission, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := CurrentUser(r)
+		if u == nil {
+			RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !u.Can(p) {
+			RespondJSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
@@ -45,7 +125,7 @@ func CorsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -55,3 +135,14 @@ func CorsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// TimeoutMiddleware gives every request a deadline, so queries still running
+// when it passes are cancelled along with the ones from disconnected clients.
+func TimeoutMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
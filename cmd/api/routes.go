@@ -1,37 +1,89 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
+)
 
 func createRoutes(
 	companyH *companyHandler,
 	authH *authHandler,
 	eventH *eventHandler,
 	userH *userHandler,
+	calendarH *calendarHandler,
+	invitationH *invitationHandler,
+	userService *user.Service,
+	sessionService *session.Service,
 ) *http.ServeMux {
 	root := http.NewServeMux()
 
 	// Public routes
 	root.HandleFunc("POST /auth/register", authH.handleRegister)
 	root.HandleFunc("POST /auth/login", authH.handleLogin)
+	root.HandleFunc("POST /auth/refresh", authH.handleRefresh)
+	root.HandleFunc("POST /auth/logout", authH.handleLogout)
+	root.HandleFunc("POST /auth/forgot-password", authH.handleForgotPassword)
+	root.HandleFunc("POST /auth/reset-password", authH.handleResetPassword)
+	root.HandleFunc("GET /auth/verify", authH.handleVerify)
+	root.HandleFunc("POST /auth/verify/resend", authH.handleResendVerification)
+	root.HandleFunc("GET /auth/invitation", invitationH.handleGetInvitation)
+	root.HandleFunc("POST /auth/invitation/accept", invitationH.handleAcceptInvitation)
+	root.HandleFunc("GET /calendar/{token}", calendarH.handleGetCalendarFeed)
+	root.HandleFunc("GET /.well-known/jwks.json", authH.handleJWKS)
 
 	// Private routes
 	protectedMux := http.NewServeMux()
 	protectedMux.HandleFunc("GET /company/{id}", companyH.handleGetCompany)
 	protectedMux.HandleFunc("GET /company", companyH.handleGetCompanies)
-	protectedMux.HandleFunc("POST /company", companyH.handlePostCompany)
-	protectedMux.HandleFunc("PUT /company/{id}", companyH.handlePutCompany)
-	protectedMux.HandleFunc("DELETE /company/{id}", companyH.handleDeleteCompany)
+	protectedMux.Handle("POST /company", RequirePermission(user.PERM_MANAGE_COMPANIES, companyH.handlePostCompany))
+	protectedMux.Handle("PUT /company/{id}", RequirePermission(user.PERM_MANAGE_COMPANIES, companyH.handlePutCompany))
+	protectedMux.Handle("DELETE /company/{id}", RequirePermission(user.PERM_MANAGE_COMPANIES, companyH.handleDeleteCompany))
 
 	protectedMux.HandleFunc("GET /event", eventH.handleGetUpcomingEvents)
-	protectedMux.HandleFunc("GET /event/all", eventH.handleGetAllEvents)
+	protectedMux.Handle("GET /event/all", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handleGetAllEvents))
 	protectedMux.HandleFunc("GET /event/{id}", eventH.handleGetEvent)
-	protectedMux.HandleFunc("GET /event/{id}/checkin", eventH.handleGetCheckins)
-	protectedMux.HandleFunc("POST /event/{id}/checkin", eventH.handlePostCheckin)
-	protectedMux.HandleFunc("POST /event", eventH.handlePostEvent)
+	protectedMux.Handle("GET /event/{id}/checkin", RequirePermission(user.PERM_VIEW_ATTENDANCE, eventH.handleGetCheckins))
+	protectedMux.Handle("POST /event/{id}/checkin", RequirePermission(user.PERM_RECORD_ATTENDANCE, eventH.handlePostCheckin))
+	protectedMux.Handle("POST /event/{id}/checkout", RequirePermission(user.PERM_RECORD_ATTENDANCE, eventH.handlePostCheckout))
+	protectedMux.HandleFunc("GET /event/{id}/checkin/token", eventH.handleGetCheckinToken)
+	protectedMux.HandleFunc("GET /event/{id}/checkin/qr", eventH.handleGetCheckinQR)
+	protectedMux.HandleFunc("POST /event/{id}/register", eventH.handlePostRegister)
+	protectedMux.HandleFunc("DELETE /event/{id}/register", eventH.handleDeleteRegister)
+	protectedMux.Handle("POST /event/{id}/attendance", RequirePermission(user.PERM_RECORD_ATTENDANCE, eventH.handlePostAttendance))
+	protectedMux.Handle("GET /event/{id}/waitlist", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handleGetWaitlist))
+	protectedMux.Handle("POST /event", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handlePostEvent))
+	protectedMux.Handle("PUT /event/{id}", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handlePutEvent))
+	protectedMux.Handle("PATCH /event/{id}", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handlePatchEvent))
+	protectedMux.Handle("DELETE /event/{id}", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handleDeleteEvent))
+
+	protectedMux.Handle("POST /series", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handlePostSeries))
+	protectedMux.HandleFunc("GET /series/{id}", eventH.handleGetSeries)
+	protectedMux.Handle("DELETE /series/{id}", RequirePermission(user.PERM_MANAGE_EVENTS, eventH.handleDeleteSeries))
 
 	protectedMux.HandleFunc("GET /me", userH.handleGetMe)
+	protectedMux.HandleFunc("PATCH /me", userH.handlePatchMe)
+	protectedMux.HandleFunc("POST /me/password", userH.handlePostPassword)
+	protectedMux.HandleFunc("GET /me/sessions", userH.handleGetSessions)
+	protectedMux.HandleFunc("DELETE /me/sessions", userH.handleDeleteSessions)
+	protectedMux.HandleFunc("DELETE /me/sessions/{id}", userH.handleDeleteSession)
+	protectedMux.HandleFunc("GET /me/events", eventH.handleGetMyEvents)
+	protectedMux.HandleFunc("POST /me/calendar", calendarH.handlePostCalendar)
+	protectedMux.HandleFunc("DELETE /me/calendar", calendarH.handleDeleteCalendar)
+
+	protectedMux.Handle("GET /user", RequirePermission(user.PERM_MANAGE_USERS, userH.handleGetUsers))
+	protectedMux.Handle("GET /user/{id}", RequirePermission(user.PERM_MANAGE_USERS, userH.handleGetUser))
+	protectedMux.Handle("PATCH /user/{id}", RequirePermission(user.PERM_MANAGE_USERS, userH.handlePatchUser))
+	protectedMux.Handle("DELETE /user/{id}", RequirePermission(user.PERM_MANAGE_USERS, userH.handleDeleteUser))
+	protectedMux.Handle("POST /user/{id}/logout", RequirePermission(user.PERM_MANAGE_USERS, userH.handlePostUserLogout))
+	protectedMux.Handle("GET /user/{id}/events", RequirePermission(user.PERM_VIEW_ATTENDANCE, eventH.handleGetUserEvents))
+
+	protectedMux.Handle("POST /invitation", RequirePermission(user.PERM_MANAGE_USERS, invitationH.handlePostInvitations))
+	protectedMux.Handle("GET /invitation", RequirePermission(user.PERM_MANAGE_USERS, invitationH.handleGetInvitations))
+	protectedMux.Handle("DELETE /invitation/{id}", RequirePermission(user.PERM_MANAGE_USERS, invitationH.handleDeleteInvitation))
 
-	protected := AuthMiddleware(protectedMux)
+	protected := AuthMiddleware(sessionService, CurrentUserMiddleware(userService, protectedMux))
 
 	root.Handle("/", protected)
 
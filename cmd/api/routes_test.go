@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/invitation"
+	"github.com/mthsgimenez/participe/internal/passwordreset"
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
+	"github.com/mthsgimenez/participe/internal/verification"
+)
+
+// testPassword is the password of every user created by newTestServer.
+const testPassword = "secret123"
+
+// testPublicURL is the PUBLIC_URL of newTestServer, every emailed link starts with it.
+const testPublicURL = "https://participe.test"
+
+// Emails of the users newTestServer creates. Everyone but caio works at acme.
+const (
+	adminEmail   = "admin@acme.com"
+	managerEmail = "manager@acme.com"
+	anaEmail     = "ana@acme.com"
+	caioEmail    = "caio@other.com"
+)
+
+var (
+	hashOnce     sync.Once
+	withPassword user.User
+)
+
+// testServer runs the routes of createRoutes over the in-memory repositories.
+type testServer struct {
+	handler   http.Handler
+	companies *company.RepositoryMemory
+	users     *user.RepositoryMemory
+	events    *event.RepositoryMemory
+	mail      *mailbox
+
+	acme, other *company.Company
+	ids         map[string]int
+	cookies     map[string][]*http.Cookie
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	t.Setenv("PUBLIC_URL", testPublicURL)
+
+	// Hashing is slow, every seeded user starts from the same password.
+	hashOnce.Do(func() {
+		if err := withPassword.SetPassword(testPassword); err != nil {
+			panic(err)
+		}
+	})
+
+	companies := company.NewRepositoryMemory()
+	users := user.NewRepositoryMemory(companies)
+	events := event.NewRepositoryMemory(users, companies)
+	mailer := &mailbox{}
+
+	passwordResets := &fakePasswordResetRepository{}
+	verifications := &fakeVerificationRepository{}
+	invitations := &fakeInvitationRepository{}
+
+	companyService := company.NewService(companies, db.NewTransactorMemory[company.Repository](companies))
+	userService := user.NewService(users, companies)
+	passwordResetService := passwordreset.NewService(passwordResets, users, db.NewTransactorMemory(passwordreset.Repositories{Tokens: passwordResets, Users: users}), mailer)
+	verificationService := verification.NewService(verifications, users, db.NewTransactorMemory(verification.Repositories{Tokens: verifications, Users: users}), mailer)
+	sessionService := session.NewService(newFakeSessionRepository(users))
+	eventService := event.NewService(events, db.NewTransactorMemory[event.Repository](events))
+	invitationService := invitation.NewService(invitations, users, companies, db.NewTransactorMemory(invitation.Repositories{Invitations: invitations, Users: users}), mailer)
+
+	mux := createRoutes(
+		newCompanyHandler(companyService),
+		NewAuthHandler(userService, companyService, passwordResetService, verificationService, sessionService),
+		NewEventHandler(eventService, userService),
+		NewUserHandler(userService, verificationService, sessionService),
+		NewCalendarHandler(eventService, userService),
+		NewInvitationHandler(invitationService),
+		userService,
+		sessionService,
+	)
+
+	s := &testServer{
+		handler:   mux,
+		companies: companies,
+		users:     users,
+		events:    events,
+		mail:      mailer,
+		ids:       map[string]int{},
+		cookies:   map[string][]*http.Cookie{},
+	}
+
+	s.acme = s.seedCompany(t, "Acme", "acme.com")
+	s.other = s.seedCompany(t, "Other", "other.com")
+
+	s.seedUser(t, adminEmail, s.acme, user.ROLE_ADMIN)
+	s.seedUser(t, managerEmail, s.acme, user.ROLE_COMPANY_MANAGER)
+	s.seedUser(t, anaEmail, s.acme, user.ROLE_USER)
+	s.seedUser(t, caioEmail, s.other, user.ROLE_USER)
+
+	return s
+}
+
+func (s *testServer) seedCompany(t *testing.T, name, domain string) *company.Company {
+	t.Helper()
+
+	cmp, err := s.companies.Insert(t.Context(), &company.Company{Name: name})
+	if err != nil {
+		t.Fatalf("insert company: %v", err)
+	}
+
+	cmp.Domains, err = s.companies.ReplaceDomains(t.Context(), cmp.Id, []string{domain})
+	if err != nil {
+		t.Fatalf("replace domains: %v", err)
+	}
+
+	return cmp
+}
+
+// seedUser creates a verified user with testPassword.
+func (s *testServer) seedUser(t *testing.T, email string, cmp *company.Company, role user.UserRole) *user.User {
+	t.Helper()
+
+	u := withPassword
+	u.Email, u.Name, u.Company, u.Role = email, strings.Split(email, "@")[0], *cmp, role
+
+	created, err := s.users.Insert(t.Context(), &u)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	created.Verified = true
+	if created, err = s.users.Update(t.Context(), created); err != nil {
+		t.Fatalf("verify user: %v", err)
+	}
+
+	s.ids[email] = created.Id
+	return created
+}
+
+// login logs the user in once per server and returns the cookies of that session.
+func (s *testServer) login(t *testing.T, email string) []*http.Cookie {
+	t.Helper()
+
+	if cookies, ok := s.cookies[email]; ok {
+		return cookies
+	}
+
+	cookies := s.newSession(t, email, testPassword)
+	s.cookies[email] = cookies
+	return cookies
+}
+
+// newSession logs in on a new device, without touching the cookies kept by login.
+func (s *testServer) newSession(t *testing.T, email, password string) []*http.Cookie {
+	t.Helper()
+
+	rec := s.request(t, http.MethodPost, "/auth/login", map[string]string{"email": email, "password": password}, nil)
+	wantStatus(t, rec, http.StatusOK)
+
+	return rec.Result().Cookies()
+}
+
+// do sends a request as the user with that email, or anonymously when it is empty.
+func (s *testServer) do(t *testing.T, email, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var cookies []*http.Cookie
+	if email != "" {
+		cookies = s.login(t, email)
+	}
+
+	return s.request(t, method, target, body, cookies)
+}
+
+// request sends body as JSON, unless it is nil, along with cookies.
+func (s *testServer) request(t *testing.T, method, target string, body any, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, c := range cookies {
+		// Expired cookies are how the handlers clear them, browsers would drop them.
+		if c.MaxAge >= 0 {
+			req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// createEvent creates e as the admin.
+func (s *testServer) createEvent(t *testing.T, e event.Event) *event.Event {
+	t.Helper()
+
+	rec := s.do(t, adminEmail, http.MethodPost, "/event", e)
+	wantStatus(t, rec, http.StatusOK)
+
+	return decode[*event.Event](t, rec)
+}
+
+// newEvent returns a public event starting in a day, ready to be created.
+func newEvent(name string) event.Event {
+	return event.Event{
+		Name:        name,
+		Description: "Description of " + name,
+		Date:        time.Now().Add(24 * time.Hour).Truncate(time.Second),
+	}
+}
+
+func wantStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d, body: %s", rec.Code, status, rec.Body.String())
+	}
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func cookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, c := range cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestProtectedRoutesRequireLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	routes := []struct{ method, target string }{
+		{http.MethodGet, "/company"},
+		{http.MethodGet, "/company/1"},
+		{http.MethodPost, "/company"},
+		{http.MethodPut, "/company/1"},
+		{http.MethodDelete, "/company/1"},
+		{http.MethodGet, "/event"},
+		{http.MethodGet, "/event/all"},
+		{http.MethodGet, "/event/1"},
+		{http.MethodGet, "/event/1/checkin"},
+		{http.MethodPost, "/event/1/checkin"},
+		{http.MethodPost, "/event/1/checkout"},
+		{http.MethodGet, "/event/1/checkin/token"},
+		{http.MethodGet, "/event/1/checkin/qr"},
+		{http.MethodPost, "/event/1/register"},
+		{http.MethodDelete, "/event/1/register"},
+		{http.MethodPost, "/event/1/attendance"},
+		{http.MethodGet, "/event/1/waitlist"},
+		{http.MethodPost, "/event"},
+		{http.MethodPut, "/event/1"},
+		{http.MethodPatch, "/event/1"},
+		{http.MethodDelete, "/event/1"},
+		{http.MethodPost, "/series"},
+		{http.MethodGet, "/series/1"},
+		{http.MethodDelete, "/series/1"},
+		{http.MethodGet, "/me"},
+		{http.MethodPatch, "/me"},
+		{http.MethodPost, "/me/password"},
+		{http.MethodGet, "/me/sessions"},
+		{http.MethodDelete, "/me/sessions"},
+		{http.MethodDelete, "/me/sessions/1"},
+		{http.MethodGet, "/me/events"},
+		{http.MethodPost, "/me/calendar"},
+		{http.MethodDelete, "/me/calendar"},
+		{http.MethodGet, "/user"},
+		{http.MethodGet, "/user/1"},
+		{http.MethodPatch, "/user/1"},
+		{http.MethodDelete, "/user/1"},
+		{http.MethodPost, "/user/1/logout"},
+		{http.MethodGet, "/user/1/events"},
+		{http.MethodPost, "/invitation"},
+		{http.MethodGet, "/invitation"},
+		{http.MethodDelete, "/invitation/1"},
+	}
+
+	invalid := []*http.Cookie{{Name: "jwt", Value: "not-a-jwt"}}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.target, func(t *testing.T) {
+			wantStatus(t, s.request(t, route.method, route.target, nil, nil), http.StatusUnauthorized)
+			wantStatus(t, s.request(t, route.method, route.target, nil, invalid), http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestRoutesRequirePermission(t *testing.T) {
+	s := newTestServer(t)
+
+	// The routes a company manager can't reach either, users can't reach any of them.
+	managerDenied := []struct{ method, target string }{
+		{http.MethodPost, "/company"},
+		{http.MethodPut, "/company/1"},
+		{http.MethodDelete, "/company/1"},
+		{http.MethodGet, "/event/all"},
+		{http.MethodPost, "/event/1/checkin"},
+		{http.MethodPost, "/event/1/checkout"},
+		{http.MethodPost, "/event/1/attendance"},
+		{http.MethodGet, "/event/1/waitlist"},
+		{http.MethodPost, "/event"},
+		{http.MethodPut, "/event/1"},
+		{http.MethodPatch, "/event/1"},
+		{http.MethodDelete, "/event/1"},
+		{http.MethodPost, "/series"},
+		{http.MethodDelete, "/series/1"},
+	}
+	managerAllowed := []struct{ method, target string }{
+		{http.MethodGet, "/event/1/checkin"},
+		{http.MethodGet, "/user"},
+		{http.MethodGet, "/user/1"},
+		{http.MethodPatch, "/user/1"},
+		{http.MethodDelete, "/user/1"},
+		{http.MethodPost, "/user/1/logout"},
+		{http.MethodGet, "/user/1/events"},
+		{http.MethodPost, "/invitation"},
+		{http.MethodGet, "/invitation"},
+		{http.MethodDelete, "/invitation/1"},
+	}
+
+	for _, route := range managerDenied {
+		t.Run(route.method+" "+route.target, func(t *testing.T) {
+			wantStatus(t, s.do(t, anaEmail, route.method, route.target, nil), http.StatusForbidden)
+			wantStatus(t, s.do(t, managerEmail, route.method, route.target, nil), http.StatusForbidden)
+		})
+	}
+
+	for _, route := range managerAllowed {
+		t.Run(route.method+" "+route.target, func(t *testing.T) {
+			wantStatus(t, s.do(t, anaEmail, route.method, route.target, nil), http.StatusForbidden)
+
+			// Handlers may still refuse what the manager does there, just not RequirePermission.
+			rec := s.do(t, managerEmail, route.method, route.target, nil)
+			if rec.Code == http.StatusForbidden && decode[ErrorResponse](t, rec).Message == "Forbidden" {
+				t.Errorf("company manager was denied by RequirePermission")
+			}
+		})
+	}
+}
@@ -1,31 +1,479 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/session"
 	"github.com/mthsgimenez/participe/internal/user"
+	"github.com/mthsgimenez/participe/internal/verification"
 )
 
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 100
+)
+
+type UserPageDTO struct {
+	Users  *[]user.User `json:"users"`
+	Total  int          `json:"total"`
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
+
+type UserPatchDTO struct {
+	Role      *string `json:"role"`
+	CompanyId *int    `json:"company_id"`
+	Active    *bool   `json:"active"`
+}
+
+func (p *UserPatchDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if p.Role == nil && p.CompanyId == nil && p.Active == nil {
+		problems["body"] = "at least one of role, company_id or active is required"
+	}
+
+	if p.Role != nil {
+		if _, ok := user.ParseUserRole(*p.Role); !ok {
+			problems["role"] = "role must be ROLE_USER, ROLE_COMPANY_MANAGER or ROLE_ADMIN"
+		}
+	}
+
+	if p.CompanyId != nil && *p.CompanyId <= 0 {
+		problems["company_id"] = "company_id must be a positive int"
+	}
+
+	return
+}
+
+func (p *UserPatchDTO) toPatch() *user.UserPatch {
+	patch := &user.UserPatch{CompanyId: p.CompanyId, Active: p.Active}
+	if p.Role != nil {
+		role, _ := user.ParseUserRole(*p.Role)
+		patch.Role = &role
+	}
+	return patch
+}
+
+type ProfileDTO struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+func (p *ProfileDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if p.Name == nil && p.Email == nil {
+		problems["body"] = "at least one of name or email is required"
+	}
+
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		problems["name"] = "name cant be empty"
+	}
+
+	if p.Email != nil && strings.TrimSpace(*p.Email) == "" {
+		problems["email"] = "email cant be empty"
+	}
+
+	return
+}
+
+type PasswordChangeDTO struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (p *PasswordChangeDTO) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if p.CurrentPassword == "" {
+		problems["current_password"] = "current_password cant be empty"
+	}
+
+	if strings.TrimSpace(p.NewPassword) == "" {
+		problems["new_password"] = "new_password cant be empty"
+	}
+
+	return
+}
+
 type userHandler struct {
-	userService *user.Service
+	userService         *user.Service
+	verificationService *verification.Service
+	sessionService      *session.Service
 }
 
-func NewUserHandler(s *user.Service) *userHandler {
-	return &userHandler{s}
+func NewUserHandler(s *user.Service, vs *verification.Service, ss *session.Service) *userHandler {
+	return &userHandler{s, vs, ss}
 }
 
 func (h *userHandler) handleGetMe(w http.ResponseWriter, r *http.Request) {
-	claims := GetUserClaims(r)
-	if claims == nil {
-		RespondJSONError(w, "Unauthorized", http.StatusUnauthorized)
+	RespondJSON(w, CurrentUser(r), http.StatusOK)
+}
+
+func (h *userHandler) handlePatchMe(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	d, problems, err := BindJSONValid[*ProfileDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name, email := u.Name, u.Email
+	if d.Name != nil {
+		name = strings.TrimSpace(*d.Name)
+	}
+	if d.Email != nil {
+		email = strings.TrimSpace(*d.Email)
+	}
+
+	updated, err := h.userService.UpdateProfile(r.Context(), u.Id, name, email)
+	if err != nil {
+		if errors.Is(err, user.ErrUniqueViolation) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusConflict, map[string]string{"email": "email already in use"})
+			return
+		}
+
+		if errors.Is(err, company.ErrDomainNotAllowed) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusUnprocessableEntity, map[string]string{"email": "email domain is not allowed for your company"})
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// The JWT is keyed on the email, the old one would stop matching any user.
+	if updated.Email != u.Email {
+		token, err := auth.GenerateJWT(updated.Email, GetUserClaims(r).SessionId)
+		if err != nil {
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+		setAuthCookie(w, token)
+
+		if err := h.verificationService.SendVerification(r.Context(), updated, verificationLink()); err != nil {
+			log.Printf("update profile: %v", err)
+		}
+	}
+
+	RespondJSON(w, updated, http.StatusOK)
+}
+
+func (h *userHandler) handlePostPassword(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	d, problems, err := BindJSONValid[*PasswordChangeDTO](r)
+	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.userService.ChangePassword(r.Context(), u.Id, d.CurrentPassword, d.NewPassword); err != nil {
+		if errors.Is(err, user.ErrWrongPassword) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, map[string]string{"current_password": "current_password is wrong"})
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	// Other devices have to log in with the new password.
+	if err := h.sessionService.RevokeAll(r.Context(), u.Id, GetUserClaims(r).SessionId); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findManagedUser loads the user of the id path value, writing the error response
+// and returning false when it doesn't exist or is out of reach of current.
+// Users of other companies are reported as not found to company managers.
+func (h *userHandler) findManagedUser(w http.ResponseWriter, r *http.Request, current *user.User) (*user.User, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return nil, false
+	}
+
+	target, err := h.userService.GetUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "user not found", http.StatusNotFound)
+			return nil, false
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !current.CanFor(user.PERM_MANAGE_USERS, target.Company.Id) {
+		RespondJSONError(w, "user not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return target, true
+}
+
+func (h *userHandler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	query := r.URL.Query()
+	filter := user.Filter{Limit: defaultUserPageSize}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxUserPageSize {
+			RespondJSONError(w, "limit must be an int between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			RespondJSONError(w, "offset must be a non negative int", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	if value := query.Get("company_id"); value != "" {
+		companyId, err := strconv.Atoi(value)
+		if err != nil {
+			RespondJSONError(w, "company_id must be an int", http.StatusBadRequest)
+			return
+		}
+		filter.CompanyId = &companyId
+	}
+
+	if value := query.Get("role"); value != "" {
+		role, ok := user.ParseUserRole(value)
+		if !ok {
+			RespondJSONError(w, "role must be ROLE_USER, ROLE_COMPANY_MANAGER or ROLE_ADMIN", http.StatusBadRequest)
+			return
+		}
+		filter.Role = &role
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			RespondJSONError(w, "active must be true or false", http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+
+	// Company managers only list their own company.
+	if current.Role.Scope(user.PERM_MANAGE_USERS) == user.SCOPE_COMPANY {
+		if filter.CompanyId != nil && *filter.CompanyId != current.Company.Id {
+			RespondJSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		filter.CompanyId = &current.Company.Id
+	}
+
+	users, total, err := h.userService.GetUsersPage(r.Context(), filter)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, UserPageDTO{Users: users, Total: total, Limit: filter.Limit, Offset: filter.Offset}, http.StatusOK)
+}
+
+func (h *userHandler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.findManagedUser(w, r, CurrentUser(r))
+	if !ok {
 		return
 	}
 
-	u, err := h.userService.GetUserByEmail(claims.Email)
+	RespondJSON(w, u, http.StatusOK)
+}
+
+func (h *userHandler) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	target, ok := h.findManagedUser(w, r, current)
+	if !ok {
+		return
+	}
+
+	d, problems, err := BindJSONValid[*UserPatchDTO](r)
 	if err != nil {
+		if len(problems) > 0 {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, problems)
+			return
+		}
+
+		RespondJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	patch := d.toPatch()
+
+	// Nobody can lock themselves out, someone else has to demote or deactivate them.
+	if target.Id == current.Id && ((patch.Role != nil && *patch.Role != current.Role) || (patch.Active != nil && !*patch.Active)) {
+		RespondJSONError(w, "you can't demote or deactivate yourself", http.StatusConflict)
+		return
+	}
+
+	if !current.CanManage(target) || (patch.Role != nil && !current.CanAssign(*patch.Role)) {
+		RespondJSONError(w, "you can't grant or change a role above your own", http.StatusForbidden)
+		return
+	}
+
+	if patch.CompanyId != nil && !current.CanFor(user.PERM_MANAGE_USERS, *patch.CompanyId) {
+		RespondJSONError(w, "you can't move users out of your company", http.StatusForbidden)
+		return
+	}
+
+	u, err := h.userService.PatchUser(r.Context(), target.Id, patch)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, company.ErrCompanyNotFound) || errors.Is(err, user.ErrForeignKeyViolation) {
+			RespondJSONErrorWithProblems(w, "invalid request body", http.StatusBadRequest, map[string]string{"company_id": "company not found"})
+			return
+		}
+
 		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
 		return
 	}
 
+	if !u.Active {
+		if err := h.sessionService.RevokeAll(r.Context(), u.Id, 0); err != nil {
+			RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	RespondJSON(w, u, http.StatusOK)
 }
+
+func (h *userHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	target, ok := h.findManagedUser(w, r, current)
+	if !ok {
+		return
+	}
+
+	if target.Id == current.Id {
+		RespondJSONError(w, "you can't delete yourself", http.StatusConflict)
+		return
+	}
+
+	if !current.CanManage(target) {
+		RespondJSONError(w, "you can't delete a user with a role above your own", http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.DeleteUser(r.Context(), target.Id); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			RespondJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *userHandler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	sessions, err := h.sessionService.GetUserSessions(r.Context(), u.Id, GetUserClaims(r).SessionId)
+	if err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	RespondJSON(w, sessions, http.StatusOK)
+}
+
+// handleDeleteSessions logs the user out of every other device.
+func (h *userHandler) handleDeleteSessions(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	if err := h.sessionService.RevokeAll(r.Context(), u.Id, GetUserClaims(r).SessionId); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *userHandler) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	u := CurrentUser(r)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		RespondJSONError(w, "id must be an int", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), id, u.Id); err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			RespondJSONError(w, "session not found", http.StatusNotFound)
+			return
+		}
+
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	if id == GetUserClaims(r).SessionId {
+		clearAuthCookies(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePostUserLogout lets admins and company managers log a user out of every device.
+func (h *userHandler) handlePostUserLogout(w http.ResponseWriter, r *http.Request) {
+	current := CurrentUser(r)
+
+	target, ok := h.findManagedUser(w, r, current)
+	if !ok {
+		return
+	}
+
+	if !current.CanManage(target) {
+		RespondJSONError(w, "you can't log out a user with a role above your own", http.StatusForbidden)
+		return
+	}
+
+	if err := h.sessionService.RevokeAll(r.Context(), target.Id, 0); err != nil {
+		RespondJSONError(w, "something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
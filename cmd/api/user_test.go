@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+func TestMeRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("get", func(t *testing.T) {
+		rec := s.do(t, anaEmail, http.MethodGet, "/me", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if me := decode[user.User](t, rec); me.Email != anaEmail || me.Company.Id != s.acme.Id {
+			t.Errorf("GET /me = %+v", me)
+		}
+	})
+
+	t.Run("update profile", func(t *testing.T) {
+		name := "Ana Maria"
+		rec := s.do(t, anaEmail, http.MethodPatch, "/me", ProfileDTO{Name: &name})
+		wantStatus(t, rec, http.StatusOK)
+		if me := decode[user.User](t, rec); me.Name != name || me.Email != anaEmail {
+			t.Errorf("PATCH /me = %+v", me)
+		}
+
+		taken := adminEmail
+		wantStatus(t, s.do(t, anaEmail, http.MethodPatch, "/me", ProfileDTO{Email: &taken}), http.StatusConflict)
+
+		// Acme only allows acme.com addresses, registering with one doesn't allow switching away from it.
+		outside := "ana@other.com"
+		wantStatus(t, s.do(t, anaEmail, http.MethodPatch, "/me", ProfileDTO{Email: &outside}), http.StatusUnprocessableEntity)
+		if u, err := s.users.FindByEmail(t.Context(), anaEmail); err != nil || u.Email != anaEmail {
+			t.Errorf("user after a rejected email change = %+v, %v", u, err)
+		}
+	})
+
+	t.Run("change email", func(t *testing.T) {
+		cookies := s.newSession(t, managerEmail, testPassword)
+		otherDevice := s.newSession(t, managerEmail, testPassword)
+
+		email := "boss@acme.com"
+		rec := s.request(t, http.MethodPatch, "/me", ProfileDTO{Email: &email}, cookies)
+		wantStatus(t, rec, http.StatusOK)
+		if me := decode[user.User](t, rec); me.Email != email || me.Verified {
+			t.Errorf("PATCH /me = %+v", me)
+		}
+		if s.mail.count(email) != 1 {
+			t.Errorf("no verification email sent to the new address")
+		}
+
+		// The session goes on with the cookie issued for the new email.
+		cookies = []*http.Cookie{cookie(rec.Result().Cookies(), "jwt")}
+		rec = s.request(t, http.MethodGet, "/me", nil, cookies)
+		wantStatus(t, rec, http.StatusOK)
+		if me := decode[user.User](t, rec); me.Email != email {
+			t.Errorf("GET /me after changing the email = %+v", me)
+		}
+
+		// Access tokens issued before carry the old email, even once someone else owns it
+		// they stand for the user of their session.
+		managerId := s.ids[managerEmail]
+		s.seedUser(t, managerEmail, s.acme, user.ROLE_USER)
+		rec = s.request(t, http.MethodGet, "/me", nil, otherDevice)
+		wantStatus(t, rec, http.StatusOK)
+		if me := decode[user.User](t, rec); me.Id != managerId || me.Email != email {
+			t.Errorf("GET /me with a token issued before the change = %+v, want user %d", me, managerId)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		current := s.newSession(t, caioEmail, testPassword)
+		other := s.newSession(t, caioEmail, testPassword)
+		third := s.newSession(t, caioEmail, testPassword)
+
+		rec := s.request(t, http.MethodGet, "/me/sessions", nil, current)
+		wantStatus(t, rec, http.StatusOK)
+		sessions := decode[[]session.Session](t, rec)
+		if len(sessions) != 3 {
+			t.Fatalf("GET /me/sessions returned %d sessions", len(sessions))
+		}
+
+		var currentId, otherId int
+		for _, sess := range sessions {
+			if sess.Current {
+				currentId = sess.Id
+			} else if otherId == 0 {
+				otherId = sess.Id
+			}
+		}
+		if currentId == 0 {
+			t.Fatalf("no session is marked current: %+v", sessions)
+		}
+
+		wantStatus(t, s.request(t, http.MethodDelete, fmt.Sprintf("/me/sessions/%d", otherId), nil, current), http.StatusNoContent)
+		wantStatus(t, s.request(t, http.MethodDelete, fmt.Sprintf("/me/sessions/%d", otherId), nil, current), http.StatusNotFound)
+		wantStatus(t, s.request(t, http.MethodDelete, "/me/sessions/abc", nil, current), http.StatusBadRequest)
+
+		// Logging out everywhere else keeps the current session.
+		wantStatus(t, s.request(t, http.MethodDelete, "/me/sessions", nil, current), http.StatusNoContent)
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, other), http.StatusUnauthorized)
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, third), http.StatusUnauthorized)
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, current), http.StatusOK)
+
+		// Ending the current session clears its cookie.
+		rec = s.request(t, http.MethodDelete, fmt.Sprintf("/me/sessions/%d", currentId), nil, current)
+		wantStatus(t, rec, http.StatusNoContent)
+		if c := cookie(rec.Result().Cookies(), "jwt"); c == nil || c.MaxAge >= 0 {
+			t.Errorf("jwt cookie wasn't cleared: %v", c)
+		}
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, current), http.StatusUnauthorized)
+	})
+
+	t.Run("change password", func(t *testing.T) {
+		current := s.newSession(t, anaEmail, testPassword)
+		other := s.newSession(t, anaEmail, testPassword)
+
+		rec := s.request(t, http.MethodPost, "/me/password", PasswordChangeDTO{CurrentPassword: "wrong", NewPassword: "another-secret"}, current)
+		wantStatus(t, rec, http.StatusBadRequest)
+		if problems := decode[ErrorResponse](t, rec).Problems; problems["current_password"] == "" {
+			t.Errorf("problems = %v", problems)
+		}
+
+		rec = s.request(t, http.MethodPost, "/me/password", PasswordChangeDTO{CurrentPassword: testPassword, NewPassword: "another-secret"}, current)
+		wantStatus(t, rec, http.StatusNoContent)
+
+		// Other devices have to log in again.
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, other), http.StatusUnauthorized)
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, current), http.StatusOK)
+		s.newSession(t, anaEmail, "another-secret")
+	})
+}
+
+func TestUserRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("list", func(t *testing.T) {
+		rec := s.do(t, adminEmail, http.MethodGet, "/user", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if page := decode[UserPageDTO](t, rec); page.Total != 4 || len(*page.Users) != 4 || page.Limit != defaultUserPageSize {
+			t.Errorf("GET /user = %+v", page)
+		}
+
+		rec = s.do(t, adminEmail, http.MethodGet, "/user?role=ROLE_ADMIN&limit=1", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if page := decode[UserPageDTO](t, rec); page.Total != 1 || (*page.Users)[0].Email != adminEmail {
+			t.Errorf("GET /user?role=ROLE_ADMIN = %+v", page)
+		}
+
+		rec = s.do(t, adminEmail, http.MethodGet, fmt.Sprintf("/user?company_id=%d", s.other.Id), nil)
+		wantStatus(t, rec, http.StatusOK)
+		if page := decode[UserPageDTO](t, rec); page.Total != 1 || (*page.Users)[0].Email != caioEmail {
+			t.Errorf("GET /user?company_id = %+v", page)
+		}
+
+		for _, query := range []string{"limit=0", "offset=-1", "company_id=x", "role=ROLE_KING", "active=maybe"} {
+			wantStatus(t, s.do(t, adminEmail, http.MethodGet, "/user?"+query, nil), http.StatusBadRequest)
+		}
+
+		// Company managers only list their own company.
+		rec = s.do(t, managerEmail, http.MethodGet, "/user", nil)
+		wantStatus(t, rec, http.StatusOK)
+		if page := decode[UserPageDTO](t, rec); page.Total != 3 {
+			t.Errorf("manager lists %d users, want 3", page.Total)
+		}
+
+		wantStatus(t, s.do(t, managerEmail, http.MethodGet, fmt.Sprintf("/user?company_id=%d", s.other.Id), nil), http.StatusForbidden)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		caioPath := fmt.Sprintf("/user/%d", s.ids[caioEmail])
+
+		rec := s.do(t, adminEmail, http.MethodGet, caioPath, nil)
+		wantStatus(t, rec, http.StatusOK)
+		if found := decode[user.User](t, rec); found.Email != caioEmail {
+			t.Errorf("GET %s = %+v", caioPath, found)
+		}
+
+		wantStatus(t, s.do(t, managerEmail, http.MethodGet, caioPath, nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, "/user/404", nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, "/user/abc", nil), http.StatusBadRequest)
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		anaPath := fmt.Sprintf("/user/%d", s.ids[anaEmail])
+		admin, manager := "ROLE_ADMIN", "ROLE_COMPANY_MANAGER"
+
+		wantStatus(t, s.do(t, managerEmail, http.MethodPatch, anaPath, UserPatchDTO{Role: &admin}), http.StatusForbidden)
+		wantStatus(t, s.do(t, managerEmail, http.MethodPatch, anaPath, UserPatchDTO{CompanyId: &s.other.Id}), http.StatusForbidden)
+		wantStatus(t, s.do(t, adminEmail, http.MethodPatch, fmt.Sprintf("/user/%d", s.ids[adminEmail]), UserPatchDTO{Role: &manager}), http.StatusConflict)
+
+		missing := 404
+		rec := s.do(t, adminEmail, http.MethodPatch, anaPath, UserPatchDTO{CompanyId: &missing})
+		wantStatus(t, rec, http.StatusBadRequest)
+
+		rec = s.do(t, managerEmail, http.MethodPatch, anaPath, UserPatchDTO{Role: &manager})
+		wantStatus(t, rec, http.StatusOK)
+		if patched := decode[user.User](t, rec); patched.Role != user.ROLE_COMPANY_MANAGER {
+			t.Errorf("PATCH %s = %+v", anaPath, patched)
+		}
+	})
+
+	t.Run("deactivate", func(t *testing.T) {
+		cookies := s.newSession(t, caioEmail, testPassword)
+		caioPath := fmt.Sprintf("/user/%d", s.ids[caioEmail])
+
+		active := false
+		rec := s.do(t, adminEmail, http.MethodPatch, caioPath, UserPatchDTO{Active: &active})
+		wantStatus(t, rec, http.StatusOK)
+		if patched := decode[user.User](t, rec); patched.Active {
+			t.Errorf("PATCH %s = %+v", caioPath, patched)
+		}
+
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, cookies), http.StatusUnauthorized)
+
+		active = true
+		wantStatus(t, s.do(t, adminEmail, http.MethodPatch, caioPath, UserPatchDTO{Active: &active}), http.StatusOK)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		cookies := s.newSession(t, caioEmail, testPassword)
+		caioPath := fmt.Sprintf("/user/%d", s.ids[caioEmail])
+
+		wantStatus(t, s.do(t, managerEmail, http.MethodPost, caioPath+"/logout", nil), http.StatusNotFound)
+		wantStatus(t, s.do(t, managerEmail, http.MethodPost, fmt.Sprintf("/user/%d/logout", s.ids[adminEmail]), nil), http.StatusForbidden)
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodPost, caioPath+"/logout", nil), http.StatusNoContent)
+		wantStatus(t, s.request(t, http.MethodGet, "/me", nil, cookies), http.StatusUnauthorized)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		caioPath := fmt.Sprintf("/user/%d", s.ids[caioEmail])
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, fmt.Sprintf("/user/%d", s.ids[adminEmail]), nil), http.StatusConflict)
+		wantStatus(t, s.do(t, managerEmail, http.MethodDelete, fmt.Sprintf("/user/%d", s.ids[adminEmail]), nil), http.StatusForbidden)
+
+		wantStatus(t, s.do(t, adminEmail, http.MethodDelete, caioPath, nil), http.StatusNoContent)
+		wantStatus(t, s.do(t, adminEmail, http.MethodGet, caioPath, nil), http.StatusNotFound)
+	})
+}
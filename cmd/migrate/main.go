@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/migrate"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up                  apply every pending migration
+  down [n]            roll back the last n migrations (default 1)
+  status              list migrations and when they were applied
+  baseline <version>  mark migrations up to version as applied without running them
+  seed                load the development data, without an admin (see participe-admin create-admin)
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	conn, err := db.ConnectToDB(db.ConnStringFromEnv())
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations("applied", applied)
+		if err != nil {
+			fail(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				fail(fmt.Errorf("down: %q is not a positive number", os.Args[2]))
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		printMigrations("rolled back", rolledBack)
+		if err != nil {
+			fail(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fail(err)
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, appliedAt)
+		}
+	case "baseline":
+		if len(os.Args) < 3 {
+			fail(fmt.Errorf("baseline: missing version"))
+		}
+		version, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			fail(fmt.Errorf("baseline: %q is not a version number", os.Args[2]))
+		}
+		marked, err := migrator.Baseline(ctx, version)
+		if err != nil {
+			fail(err)
+		}
+		printMigrations("marked as applied", marked)
+	case "seed":
+		if err := migrator.Seed(ctx); err != nil {
+			fail(err)
+		}
+		fmt.Println("seed data loaded")
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func printMigrations(verb string, migrations []migrate.Migration) {
+	for _, m := range migrations {
+		fmt.Printf("%s %04d_%s\n", verb, m.Version, m.Name)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error: "+err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/event"
+	"github.com/mthsgimenez/participe/internal/migrate"
+	"github.com/mthsgimenez/participe/internal/session"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+const usage = `usage: participe-admin <command> [flags]
+
+commands:
+  create-company  -name <name> [-domains a.com,b.com]
+  create-admin    -email <email> -name <name> -company <id> [-password <password>]
+  reset-password  -email <email> [-password <password>]
+  set-role        -email <email> -role <ROLE_USER|ROLE_COMPANY_MANAGER|ROLE_ADMIN>
+  seed            load the development data into an empty database, without an admin
+  attendance      -event <id> [-status <REGISTERED|CANCELLED|ATTENDED|NO_SHOW>]
+
+To set up a new environment, run create-company and then create-admin.
+Without -password a random password is generated and printed.
+Run participe-admin <command> -h for the flags of a command.
+`
+
+var (
+	companyService *company.Service
+	userService    *user.Service
+	eventService   *event.Service
+	sessionService *session.Service
+	migrator       *migrate.Migrator
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"create-company": createCompany,
+		"create-admin":   createAdmin,
+		"reset-password": resetPassword,
+		"set-role":       setRole,
+		"seed":           seed,
+		"attendance":     attendance,
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	conn, err := db.ConnectToDB(db.ConnStringFromEnv())
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	companyRepository := company.NewRepositoryPostgres(conn)
+	companyService = company.NewService(companyRepository, company.NewTransactorPostgres(conn))
+	userService = user.NewService(user.NewRepositoryPostgres(conn), companyRepository)
+	eventService = event.NewService(event.NewRepositoryPostgres(conn), event.NewTransactorPostgres(conn))
+	sessionService = session.NewService(session.NewRepositoryPostgres(conn))
+
+	migrator, err = migrate.New(conn)
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := command(ctx, os.Args[2:]); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error: "+err.Error())
+	os.Exit(1)
+}
@@ -10,16 +10,22 @@ import (
 
 var key = []byte(env.GetStringFallback("SECRET_KEY", "secret"))
 
+// AccessTokenTTL is kept short since access tokens are only checked against
+// their session, refresh tokens keep the user logged in.
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
-	Email string `json:"email"`
+	Email     string `json:"email"`
+	SessionId int    `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(email string) (string, error) {
-	expirationDate := time.Now().Add(7 * (time.Hour * 24))
+func GenerateJWT(email string, sessionId int) (string, error) {
+	expirationDate := time.Now().Add(AccessTokenTTL)
 
 	claims := &Claims{
-		Email: email,
+		Email:     email,
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationDate),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -27,8 +33,7 @@ func GenerateJWT(email string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(key)
+	tokenString, err := keyring.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -39,9 +44,7 @@ func GenerateJWT(email string) (string, error) {
 func VerifyJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
-		return key, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.verificationKey)
 
 	if err != nil {
 		if err == jwt.ErrTokenExpired {
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mthsgimenez/participe/internal/env"
+)
+
+const defaultSecretKey = "secret"
+
+var ErrInsecureConfig = errors.New("insecure auth configuration")
+
+// signingKey is a key tokens are signed or verified with. Keys loaded from a
+// public key file can only verify.
+type signingKey struct {
+	kid      string
+	method   jwt.SigningMethod
+	signer   any
+	verifier any
+}
+
+// Keyring holds the key new tokens are signed with and every key still accepted
+// when verifying, so a key can be rotated without invalidating the tokens it signed.
+type Keyring struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	// previous are the secrets SECRET_KEY replaced, signed tokens made with them still verify.
+	previous [][]byte
+}
+
+var keyring = newHMACKeyring(key)
+
+func newHMACKeyring(secret []byte) *Keyring {
+	k := hmacKey(secret)
+	return &Keyring{active: k, keys: map[string]*signingKey{k.kid: k}}
+}
+
+func hmacKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(secret)
+	return &signingKey{
+		kid:      "hs-" + hex.EncodeToString(sum[:8]),
+		method:   jwt.SigningMethodHS256,
+		signer:   secret,
+		verifier: secret,
+	}
+}
+
+// LoadKeys configures the keys from the environment and must run before the
+// server starts. JWT_KEY_FILES lists PEM files, RSA or Ed25519, comma separated:
+// the first one signs new tokens and must be a private key, the others only
+// verify. Without it tokens are signed with HS256 and SECRET_KEY, and
+// SECRET_KEY_PREVIOUS lists former secrets still accepted.
+//
+// Unless APP_ENV=development is set explicitly, SECRET_KEY must be set to
+// something other than the default, it also signs check-in tokens and invitations.
+func LoadKeys() error {
+	// An unset APP_ENV is production, forgetting it must not allow the default secret.
+	appEnv := env.GetStringFallback("APP_ENV", "production")
+	secret, secretSet := os.LookupEnv("SECRET_KEY")
+	if appEnv != "development" && (!secretSet || secret == defaultSecretKey) {
+		return fmt.Errorf("auth: load keys: %w: SECRET_KEY must be set outside of development (APP_ENV=%s)", ErrInsecureConfig, appEnv)
+	}
+
+	key = []byte(env.GetStringFallback("SECRET_KEY", defaultSecretKey))
+
+	kr := &Keyring{keys: map[string]*signingKey{}}
+
+	// Secrets SECRET_KEY replaced, accepted until the tokens they signed expire.
+	for previous := range strings.SplitSeq(env.GetStringFallback("SECRET_KEY_PREVIOUS", ""), ",") {
+		if previous = strings.TrimSpace(previous); previous != "" {
+			k := hmacKey([]byte(previous))
+			k.signer = nil
+			kr.keys[k.kid] = k
+			kr.previous = append(kr.previous, []byte(previous))
+		}
+	}
+
+	files := env.GetStringFallback("JWT_KEY_FILES", "")
+	if strings.TrimSpace(files) == "" {
+		k := hmacKey(key)
+		kr.active, kr.keys[k.kid] = k, k
+		keyring = kr
+		return nil
+	}
+
+	for i, path := range strings.Split(files, ",") {
+		k, err := loadKeyFile(strings.TrimSpace(path))
+		if err != nil {
+			return fmt.Errorf("auth: load keys: %w", err)
+		}
+
+		if i == 0 {
+			if k.signer == nil {
+				return fmt.Errorf("auth: load keys: %s is a public key, the first key must be able to sign", path)
+			}
+			kr.active = k
+		}
+		kr.keys[k.kid] = k
+	}
+
+	// Tokens signed with SECRET_KEY before switching to key files stay valid until they expire.
+	if secretSet {
+		k := hmacKey(key)
+		k.signer = nil
+		kr.keys[k.kid] = k
+	}
+
+	keyring = kr
+	return nil
+}
+
+func loadKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	k := &signingKey{}
+	switch parsedKey := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.signer, k.verifier = jwt.SigningMethodRS256, parsedKey, &parsedKey.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.verifier = jwt.SigningMethodRS256, parsedKey
+	case ed25519.PrivateKey:
+		k.method, k.signer, k.verifier = jwt.SigningMethodEdDSA, parsedKey, parsedKey.Public()
+	case ed25519.PublicKey:
+		k.method, k.verifier = jwt.SigningMethodEdDSA, parsedKey
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+	}
+
+	if rsaKey, ok := k.verifier.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("%s: RSA keys must have at least 2048 bits", path)
+	}
+
+	k.kid = k.jwk().thumbprint()
+	return k, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *signingKey) jwk() JWK {
+	enc := base64.RawURLEncoding
+	switch pub := k.verifier.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: enc.EncodeToString(pub.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: enc.EncodeToString(pub)}
+	default:
+		return JWK{}
+	}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the key, used as its kid.
+func (j JWK) thumbprint() string {
+	// The members must be in lexicographic order, which json.Marshal does for maps.
+	members := map[string]string{"kty": j.Kty}
+	switch j.Kty {
+	case "RSA":
+		members["n"], members["e"] = j.N, j.E
+	case "OKP":
+		members["crv"], members["x"] = j.Crv, j.X
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKeys returns the asymmetric keys tokens can be verified with, for other
+// services to fetch. HMAC secrets are never published.
+func PublicKeys() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range keyring.keys {
+		if k.method == jwt.SigningMethodHS256 {
+			continue
+		}
+
+		jwk := k.jwk()
+		jwk.Kid, jwk.Use, jwk.Alg = k.kid, "sig", k.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func (kr *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.active.method, claims)
+	token.Header["kid"] = kr.active.kid
+	return token.SignedString(kr.active.signer)
+}
+
+// verificationKey picks the key a token claims to be signed with. The algorithm
+// must be the one of that key, so a public key can't be used as an HMAC secret.
+func (kr *Keyring) verificationKey(token *jwt.Token) (any, error) {
+	var k *signingKey
+	if kid, ok := token.Header["kid"].(string); ok {
+		k = kr.keys[kid]
+	} else {
+		// Tokens issued before kids were added are HS256 with SECRET_KEY.
+		k = kr.keys[hmacKey(key).kid]
+	}
+
+	if k == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return k.verifier, nil
+}
@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// loadKeys runs LoadKeys with env set, an empty value unsets the variable. The
+// keys in use before are restored when the test ends.
+func loadKeys(t *testing.T, env map[string]string) error {
+	t.Helper()
+
+	previousKey, previousKeyring := key, keyring
+	t.Cleanup(func() { key, keyring = previousKey, previousKeyring })
+
+	for _, name := range []string{"APP_ENV", "SECRET_KEY", "SECRET_KEY_PREVIOUS", "JWT_KEY_FILES"} {
+		t.Setenv(name, env[name])
+		if env[name] == "" {
+			os.Unsetenv(name)
+		}
+	}
+
+	return LoadKeys()
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	return path
+}
+
+func tokenHeader(t *testing.T, token string) map[string]any {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("parse %q: %v", token, err)
+	}
+	return parsed.Header
+}
+
+func TestLoadKeysDefaultSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"unset APP_ENV", map[string]string{}, true},
+		{"unset APP_ENV with the default secret", map[string]string{"SECRET_KEY": "secret"}, true},
+		{"production", map[string]string{"APP_ENV": "production"}, true},
+		{"production with the default secret", map[string]string{"APP_ENV": "production", "SECRET_KEY": "secret"}, true},
+		{"development", map[string]string{"APP_ENV": "development"}, false},
+		{"unset APP_ENV with a secret", map[string]string{"SECRET_KEY": "a-real-secret"}, false},
+		{"production with a secret", map[string]string{"APP_ENV": "production", "SECRET_KEY": "a-real-secret"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadKeys(t, tt.env)
+			if tt.wantErr != errors.Is(err, ErrInsecureConfig) {
+				t.Errorf("LoadKeys error = %v, want insecure config: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 7638, section 3.1.
+			name: "RSA",
+			jwk: JWK{
+				Kty: "RSA",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037, appendix A.3.
+			name: "Ed25519",
+			jwk:  JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.jwk.thumbprint(); got != tt.want {
+				t.Errorf("thumbprint = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadKeysEdDSA(t *testing.T) {
+	// The private key of RFC 8037, appendix A.1, whose thumbprint is known.
+	seed, _ := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	der, err := x509.MarshalPKCS8PrivateKey(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	err = loadKeys(t, map[string]string{"JWT_KEY_FILES": writePEM(t, "PRIVATE KEY", der), "SECRET_KEY": "a-real-secret"})
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+
+	token, err := GenerateJWT("user@example.com", 1)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	header := tokenHeader(t, token)
+	if header["alg"] != "EdDSA" || header["kid"] != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Errorf("header = %v, want EdDSA with the RFC 8037 thumbprint as kid", header)
+	}
+
+	if claims, err := VerifyJWT(token); err != nil || claims.Email != "user@example.com" {
+		t.Errorf("VerifyJWT = %+v, %v", claims, err)
+	}
+}
+
+func TestLoadKeysRS256(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	rsaFile := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	edDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	if err != nil {
+		t.Fatalf("marshal Ed25519 key: %v", err)
+	}
+	edFile := writePEM(t, "PUBLIC KEY", edDER)
+
+	err = loadKeys(t, map[string]string{"JWT_KEY_FILES": rsaFile + ", " + edFile, "SECRET_KEY": "a-real-secret"})
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+
+	rsaKid := (&signingKey{verifier: &rsaKey.PublicKey}).jwk().thumbprint()
+	edKid := (&signingKey{verifier: edPublic}).jwk().thumbprint()
+
+	t.Run("signs with the first key", func(t *testing.T) {
+		token, err := GenerateJWT("user@example.com", 1)
+		if err != nil {
+			t.Fatalf("GenerateJWT: %v", err)
+		}
+
+		if header := tokenHeader(t, token); header["alg"] != "RS256" || header["kid"] != rsaKid {
+			t.Errorf("header = %v, want RS256 with kid %s", header, rsaKid)
+		}
+
+		if _, err := VerifyJWT(token); err != nil {
+			t.Errorf("VerifyJWT: %v", err)
+		}
+	})
+
+	t.Run("verifies with a public key", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{Email: "user@example.com"})
+		token.Header["kid"] = edKid
+		signed, err := token.SignedString(edPrivate)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+
+		if _, err := VerifyJWT(signed); err != nil {
+			t.Errorf("VerifyJWT: %v", err)
+		}
+	})
+
+	t.Run("publishes only the asymmetric keys", func(t *testing.T) {
+		algs := map[string]string{}
+		for _, jwk := range PublicKeys().Keys {
+			algs[jwk.Kid] = jwk.Alg
+		}
+
+		if len(algs) != 2 || algs[rsaKid] != "RS256" || algs[edKid] != "EdDSA" {
+			t.Errorf("PublicKeys = %v, want %s as RS256 and %s as EdDSA", algs, rsaKid, edKid)
+		}
+	})
+
+	t.Run("rejects HS256 with an RSA kid", func(t *testing.T) {
+		publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		if err != nil {
+			t.Fatalf("marshal RSA key: %v", err)
+		}
+
+		// The public key is no secret, signing with it as an HMAC key must not work.
+		for _, secret := range [][]byte{pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), key} {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Email: "admin@example.com"})
+			token.Header["kid"] = rsaKid
+			signed, err := token.SignedString(secret)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			if _, err := VerifyJWT(signed); err == nil {
+				t.Errorf("VerifyJWT accepted an HS256 token with kid %s", rsaKid)
+			}
+		}
+	})
+
+	t.Run("first key must be private", func(t *testing.T) {
+		err := loadKeys(t, map[string]string{"JWT_KEY_FILES": edFile + "," + rsaFile, "SECRET_KEY": "a-real-secret"})
+		if err == nil {
+			t.Error("LoadKeys accepted a public key to sign with")
+		}
+	})
+}
+
+func TestLoadKeysPreviousSecret(t *testing.T) {
+	if err := loadKeys(t, map[string]string{"SECRET_KEY": "old-secret"}); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+
+	token, err := GenerateJWT("user@example.com", 1)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	signed := SignToken("invitation", "42", time.Now().Add(time.Hour))
+
+	t.Run("listed in SECRET_KEY_PREVIOUS", func(t *testing.T) {
+		err := loadKeys(t, map[string]string{"SECRET_KEY": "new-secret", "SECRET_KEY_PREVIOUS": "older-secret, old-secret"})
+		if err != nil {
+			t.Fatalf("LoadKeys: %v", err)
+		}
+
+		if _, err := VerifyJWT(token); err != nil {
+			t.Errorf("VerifyJWT: %v", err)
+		}
+
+		fresh, err := GenerateJWT("user@example.com", 1)
+		if err != nil {
+			t.Fatalf("GenerateJWT: %v", err)
+		}
+		if tokenHeader(t, fresh)["kid"] == tokenHeader(t, token)["kid"] {
+			t.Error("new tokens are still signed with the previous secret")
+		}
+
+		if payload, err := VerifySignedToken("invitation", signed); err != nil || payload != "42" {
+			t.Errorf("VerifySignedToken = %q, %v", payload, err)
+		}
+		if _, err := VerifySignedToken("checkin", signed); !errors.Is(err, ErrInvalidSignedToken) {
+			t.Errorf("VerifySignedToken for another purpose error = %v, want ErrInvalidSignedToken", err)
+		}
+	})
+
+	t.Run("not listed", func(t *testing.T) {
+		if err := loadKeys(t, map[string]string{"SECRET_KEY": "new-secret"}); err != nil {
+			t.Fatalf("LoadKeys: %v", err)
+		}
+
+		if _, err := VerifyJWT(token); err == nil {
+			t.Error("VerifyJWT accepted a token signed with a secret no longer configured")
+		}
+
+		if _, err := VerifySignedToken("invitation", signed); !errors.Is(err, ErrInvalidSignedToken) {
+			t.Errorf("VerifySignedToken error = %v, want ErrInvalidSignedToken", err)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// NewOpaqueToken returns a random token to hand out and the hash to store in its place.
+func NewOpaqueToken() (token string, hash string) {
+	token = rand.Text()
+	return token, HashOpaqueToken(token)
+}
+
+// HashOpaqueToken returns the hash stored for a token from NewOpaqueToken.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
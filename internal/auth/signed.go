@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignedToken = errors.New("invalid signed token")
+	ErrSignedTokenExpired = errors.New("signed token expired")
+)
+
+// SignToken returns a compact token carrying payload until expiresAt, signed with
+// HMAC-SHA256 over the purpose so a token issued for one use can't be replayed in another.
+func SignToken(purpose, payload string, expiresAt time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload + "|" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return body + "." + base64.RawURLEncoding.EncodeToString(signature(key, purpose, body))
+}
+
+// VerifySignedToken checks a token created by SignToken for the same purpose and returns its payload.
+// Tokens signed with a secret listed in SECRET_KEY_PREVIOUS are accepted too, so
+// rotating SECRET_KEY doesn't invalidate the tokens already handed out.
+func VerifySignedToken(purpose, token string) (string, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", fmt.Errorf("verify signed token: %w", ErrInvalidSignedToken)
+	}
+
+	decodedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !validSignature(decodedSig, purpose, body) {
+		return "", fmt.Errorf("verify signed token: %w", ErrInvalidSignedToken)
+	}
+
+	decodedBody, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", fmt.Errorf("verify signed token: %w", ErrInvalidSignedToken)
+	}
+
+	i := strings.LastIndex(string(decodedBody), "|")
+	if i < 0 {
+		return "", fmt.Errorf("verify signed token: %w", ErrInvalidSignedToken)
+	}
+
+	expiresAt, err := strconv.ParseInt(string(decodedBody[i+1:]), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("verify signed token: %w", ErrInvalidSignedToken)
+	}
+
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		return "", fmt.Errorf("verify signed token: %w", ErrSignedTokenExpired)
+	}
+
+	return string(decodedBody[:i]), nil
+}
+
+// validSignature reports whether sig was made with SECRET_KEY or one of the secrets it replaced.
+func validSignature(sig []byte, purpose, body string) bool {
+	if hmac.Equal(sig, signature(key, purpose, body)) {
+		return true
+	}
+
+	for _, secret := range keyring.previous {
+		if hmac.Equal(sig, signature(secret, purpose, body)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func signature(secret []byte, purpose, body string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -1,17 +1,79 @@
 package company
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type Company struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
+	// Domains are the email domains allowed to self-register as employees of
+	// the company. Without any, the company can't be joined by registering.
+	Domains []string `json:"domains"`
 }
 
 func (c *Company) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
 	if strings.TrimSpace(c.Name) == "" {
-		problems = map[string]string{"name": "name must not be empty"}
-		return
+		problems["name"] = "name must not be empty"
+	}
+
+	for i, domain := range c.Domains {
+		if !validDomain(NormalizeDomain(domain)) {
+			problems[fmt.Sprintf("domains[%d]", i)] = "domain must look like example.com"
+		}
+	}
+
+	return
+}
+
+// NormalizeDomain lowercases a domain and drops a leading @ or trailing dot.
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "@")
+	return strings.TrimSuffix(domain, ".")
+}
+
+// EmailDomain returns the normalized domain of an email address, or "" when there is none.
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return ""
+	}
+
+	return NormalizeDomain(email[at+1:])
+}
+
+func validDomain(domain string) bool {
+	if len(domain) > 255 || !strings.Contains(domain, ".") {
+		return false
+	}
+
+	for label := range strings.SplitSeq(domain, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// AllowsEmail reports whether the email belongs to one of the company domains.
+func (c *Company) AllowsEmail(email string) bool {
+	domain := EmailDomain(email)
+	for _, d := range c.Domains {
+		if domain != "" && domain == d {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
@@ -0,0 +1,192 @@
+package company
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// RepositoryMemory keeps companies in memory. It behaves like RepositoryPostgres,
+// errors included, for tests and running without a database.
+type RepositoryMemory struct {
+	mu        sync.Mutex
+	lastId    int
+	companies map[int]Company
+	// domains maps each domain to the company that owns it.
+	domains map[string]int
+
+	restricts []func(id int) bool
+	cascades  []func(id int)
+}
+
+func NewRepositoryMemory() *RepositoryMemory {
+	return &RepositoryMemory{
+		companies: map[int]Company{},
+		domains:   map[string]int{},
+	}
+}
+
+// OnDelete lets another repository stand in for its foreign keys to companies.
+// DeleteById fails while restrict reports rows pointing at the company, and calls
+// cascade to drop the rows deleted along with it. Either can be nil.
+func (r *RepositoryMemory) OnDelete(restrict func(id int) bool, cascade func(id int)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if restrict != nil {
+		r.restricts = append(r.restricts, restrict)
+	}
+	if cascade != nil {
+		r.cascades = append(r.cascades, cascade)
+	}
+}
+
+// withDomains returns a copy of cmp with its domains, sorted like the Postgres query.
+func (r *RepositoryMemory) withDomains(cmp Company) Company {
+	cmp.Domains = []string{}
+	for domain, id := range r.domains {
+		if id == cmp.Id {
+			cmp.Domains = append(cmp.Domains, domain)
+		}
+	}
+	sort.Strings(cmp.Domains)
+	return cmp
+}
+
+func (r *RepositoryMemory) FindById(ctx context.Context, id int) (*Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmp, ok := r.companies[id]
+	if !ok {
+		return nil, fmt.Errorf("company_repository: find by id: %w", ErrCompanyNotFound)
+	}
+
+	cmp = r.withDomains(cmp)
+	return &cmp, nil
+}
+
+func (r *RepositoryMemory) FindByDomain(ctx context.Context, domain string) (*Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.domains[domain]
+	if !ok {
+		return nil, fmt.Errorf("company_repository: find by domain: %w", ErrCompanyNotFound)
+	}
+
+	cmp := r.withDomains(r.companies[id])
+	return &cmp, nil
+}
+
+func (r *RepositoryMemory) FindAll(ctx context.Context) (*[]Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var companies []Company
+	for _, cmp := range r.companies {
+		companies = append(companies, r.withDomains(cmp))
+	}
+
+	sort.Slice(companies, func(i, j int) bool {
+		return companies[i].Id < companies[j].Id
+	})
+
+	return &companies, nil
+}
+
+func (r *RepositoryMemory) DeleteById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	restricts, cascades := slices.Clone(r.restricts), slices.Clone(r.cascades)
+	r.mu.Unlock()
+
+	// The other repositories are asked without holding the lock, they may call back
+	// into this one.
+	for _, restricted := range restricts {
+		if restricted(id) {
+			return fmt.Errorf("company_repository: delete by id: %w", ErrForeignKeyViolation)
+		}
+	}
+
+	r.mu.Lock()
+	_, ok := r.companies[id]
+	delete(r.companies, id)
+	for domain, owner := range r.domains {
+		if owner == id {
+			delete(r.domains, domain)
+		}
+	}
+	r.mu.Unlock()
+
+	if ok {
+		for _, cascade := range cascades {
+			cascade(id)
+		}
+	}
+
+	return nil
+}
+
+func (r *RepositoryMemory) Insert(ctx context.Context, cmp *Company) (*Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	newCompany := Company{Id: r.lastId, Name: cmp.Name}
+	r.companies[newCompany.Id] = newCompany
+
+	newCompany.Domains = []string{}
+	return &newCompany, nil
+}
+
+func (r *RepositoryMemory) Update(ctx context.Context, cmp *Company) (*Company, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.companies[cmp.Id]; !ok {
+		return nil, fmt.Errorf("company_repository: update: %w", ErrCompanyNotFound)
+	}
+
+	r.companies[cmp.Id] = Company{Id: cmp.Id, Name: cmp.Name}
+
+	// Like the Postgres query, the domains are handed back as given.
+	return &Company{Id: cmp.Id, Name: cmp.Name, Domains: cmp.Domains}, nil
+}
+
+func (r *RepositoryMemory) ReplaceDomains(ctx context.Context, id int, domains []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		if owner, ok := r.domains[domain]; (ok && owner != id) || seen[domain] {
+			return nil, fmt.Errorf("company_repository: replace domains: %w", ErrUniqueViolation)
+		}
+		seen[domain] = true
+	}
+
+	if _, ok := r.companies[id]; !ok && len(domains) > 0 {
+		return nil, fmt.Errorf("company_repository: replace domains: %w", ErrCompanyNotFound)
+	}
+
+	for domain, owner := range r.domains {
+		if owner == id {
+			delete(r.domains, domain)
+		}
+	}
+	for _, domain := range domains {
+		r.domains[domain] = id
+	}
+
+	return domains, nil
+}
+
+func (r *RepositoryMemory) Exists(ctx context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.companies[id]
+	return ok, nil
+}
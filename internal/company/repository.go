@@ -1,11 +1,13 @@
 package company
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 
 	"github.com/lib/pq"
+	"github.com/mthsgimenez/participe/internal/db"
 )
 
 var (
@@ -14,19 +16,45 @@ var (
 	ErrUniqueViolation     = errors.New("unique constraint violated")
 )
 
+// selectCompanies selects companies with their domains aggregated into an array.
+const selectCompanies = `SELECT c.id, c."name",
+	COALESCE(array_agg(d."domain" ORDER BY d."domain") FILTER (WHERE d."domain" IS NOT NULL), '{}')
+	FROM companies c
+	LEFT JOIN company_domains d ON d.company_id = c.id`
+
 type RepositoryPostgres struct {
-	db *sql.DB
+	db db.DBTX
+}
+
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
+}
+
+// NewTransactorPostgres runs transactions on conn with a RepositoryPostgres bound to each.
+func NewTransactorPostgres(conn *sql.DB) *db.TransactorPostgres[Repository] {
+	return db.NewTransactorPostgres(conn, func(tx db.DBTX) Repository {
+		return NewRepositoryPostgres(tx)
+	})
+}
+
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-func NewRepositoryPostgres(db *sql.DB) *RepositoryPostgres {
-	return &RepositoryPostgres{db}
+func scanCompany(row scanner, cmp *Company) error {
+	var domains pq.StringArray
+	if err := row.Scan(&cmp.Id, &cmp.Name, &domains); err != nil {
+		return err
+	}
+	cmp.Domains = []string(domains)
+	return nil
 }
 
-func (r *RepositoryPostgres) FindById(id int) (*Company, error) {
+func (r *RepositoryPostgres) FindById(ctx context.Context, id int) (*Company, error) {
 	cmp := &Company{}
 
-	row := r.db.QueryRow(`SELECT * FROM companies WHERE id = $1`, id)
-	if err := row.Scan(&cmp.Id, &cmp.Name); err != nil {
+	row := r.db.QueryRowContext(ctx, selectCompanies+` WHERE c.id = $1 GROUP BY c.id`, id)
+	if err := scanCompany(row, cmp); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("company_repository: find by id: %w", ErrCompanyNotFound)
 		}
@@ -36,8 +64,25 @@ func (r *RepositoryPostgres) FindById(id int) (*Company, error) {
 	return cmp, nil
 }
 
-func (r *RepositoryPostgres) FindAll() (*[]Company, error) {
-	rows, err := r.db.Query(`SELECT * FROM companies`)
+// FindByDomain returns the company that owns an email domain.
+func (r *RepositoryPostgres) FindByDomain(ctx context.Context, domain string) (*Company, error) {
+	cmp := &Company{}
+
+	row := r.db.QueryRowContext(ctx, selectCompanies+`
+		WHERE c.id = (SELECT company_id FROM company_domains WHERE "domain" = $1)
+		GROUP BY c.id`, domain)
+	if err := scanCompany(row, cmp); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("company_repository: find by domain: %w", ErrCompanyNotFound)
+		}
+		return nil, fmt.Errorf("company_repository: find by domain: %w", err)
+	}
+
+	return cmp, nil
+}
+
+func (r *RepositoryPostgres) FindAll(ctx context.Context) (*[]Company, error) {
+	rows, err := r.db.QueryContext(ctx, selectCompanies+` GROUP BY c.id ORDER BY c.id`)
 	if err != nil {
 		return nil, fmt.Errorf("company_repository: find all: %w", err)
 	}
@@ -46,7 +91,7 @@ func (r *RepositoryPostgres) FindAll() (*[]Company, error) {
 	var companies []Company
 	for rows.Next() {
 		var cmp Company
-		if err := rows.Scan(&cmp.Id, &cmp.Name); err != nil {
+		if err := scanCompany(rows, &cmp); err != nil {
 			return nil, fmt.Errorf("company_repository: find all: %w", err)
 		}
 		companies = append(companies, cmp)
@@ -59,8 +104,8 @@ func (r *RepositoryPostgres) FindAll() (*[]Company, error) {
 	return &companies, nil
 }
 
-func (r *RepositoryPostgres) DeleteById(id int) error {
-	_, err := r.db.Exec(`DELETE FROM companies WHERE id = $1`, id)
+func (r *RepositoryPostgres) DeleteById(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM companies WHERE id = $1`, id)
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
@@ -73,10 +118,10 @@ func (r *RepositoryPostgres) DeleteById(id int) error {
 	return nil
 }
 
-func (r *RepositoryPostgres) Insert(cmp *Company) (*Company, error) {
-	row := r.db.QueryRow(`INSERT INTO companies ("name") VALUES ($1) RETURNING *`, cmp.Name)
+func (r *RepositoryPostgres) Insert(ctx context.Context, cmp *Company) (*Company, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO companies ("name") VALUES ($1) RETURNING id, "name"`, cmp.Name)
 
-	var newCompany Company
+	newCompany := Company{Domains: []string{}}
 	if err := row.Scan(&newCompany.Id, &newCompany.Name); err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
@@ -90,11 +135,14 @@ func (r *RepositoryPostgres) Insert(cmp *Company) (*Company, error) {
 	return &newCompany, nil
 }
 
-func (r *RepositoryPostgres) Update(cmp *Company) (*Company, error) {
-	row := r.db.QueryRow(`UPDATE companies SET "name" = $1 WHERE id = $2 RETURNING *`, cmp.Name, cmp.Id)
+func (r *RepositoryPostgres) Update(ctx context.Context, cmp *Company) (*Company, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE companies SET "name" = $1 WHERE id = $2 RETURNING id, "name"`, cmp.Name, cmp.Id)
 
-	var updatedCompany Company
+	updatedCompany := Company{Domains: cmp.Domains}
 	if err := row.Scan(&updatedCompany.Id, &updatedCompany.Name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("company_repository: update: %w", ErrCompanyNotFound)
+		}
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == "23505" { // Unique violation
@@ -107,8 +155,44 @@ func (r *RepositoryPostgres) Update(cmp *Company) (*Company, error) {
 	return &updatedCompany, nil
 }
 
-func (r *RepositoryPostgres) Exists(id int) (bool, error) {
-	row := r.db.QueryRow(`SELECT COUNT(*) FROM companies WHERE id = $1`, id)
+// ReplaceDomains sets the email domains of the company, a domain can only belong to one company.
+func (r *RepositoryPostgres) ReplaceDomains(ctx context.Context, id int, domains []string) ([]string, error) {
+	// Checked first so a taken domain doesn't leave the company with none.
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM company_domains WHERE "domain" = ANY($1::text[]) AND company_id <> $2`, pq.StringArray(domains), id)
+	var taken int
+	if err := row.Scan(&taken); err != nil {
+		return nil, fmt.Errorf("company_repository: replace domains: %w", err)
+	}
+
+	if taken > 0 {
+		return nil, fmt.Errorf("company_repository: replace domains: %w", ErrUniqueViolation)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM company_domains WHERE company_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("company_repository: replace domains: %w", err)
+	}
+
+	if len(domains) > 0 {
+		_, err := r.db.ExecContext(ctx, `INSERT INTO company_domains (company_id, "domain") SELECT $1, unnest($2::text[])`, id, pq.StringArray(domains))
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				if pqErr.Code == "23505" { // Unique violation
+					return nil, fmt.Errorf("company_repository: replace domains: %w", ErrUniqueViolation)
+				}
+				if pqErr.Code == "23503" { // Foreign key violation
+					return nil, fmt.Errorf("company_repository: replace domains: %w", ErrCompanyNotFound)
+				}
+			}
+			return nil, fmt.Errorf("company_repository: replace domains: %w", err)
+		}
+	}
+
+	return domains, nil
+}
+
+func (r *RepositoryPostgres) Exists(ctx context.Context, id int) (bool, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM companies WHERE id = $1`, id)
 
 	var count int
 	if err := row.Scan(&count); err != nil {
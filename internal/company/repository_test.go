@@ -0,0 +1,166 @@
+package company
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/db/dbtest"
+)
+
+func TestRepositoryMemory(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewRepositoryMemory()
+	})
+}
+
+func TestRepositoryPostgres(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewRepositoryPostgres(dbtest.Open(t))
+	})
+}
+
+// testRepository checks the behaviour every Repository implementation must share,
+// newRepo returns an empty one.
+func testRepository(t *testing.T, newRepo func(t *testing.T) Repository) {
+	ctx := t.Context()
+
+	t.Run("insert and find", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, err := repo.Insert(ctx, &Company{Name: "Acme"})
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		if created.Id == 0 || created.Name != "Acme" || created.Domains == nil {
+			t.Fatalf("Insert returned %+v", created)
+		}
+
+		found, err := repo.FindById(ctx, created.Id)
+		if err != nil {
+			t.Fatalf("FindById: %v", err)
+		}
+		if found.Name != "Acme" || len(found.Domains) != 0 {
+			t.Errorf("FindById returned %+v", found)
+		}
+
+		exists, err := repo.Exists(ctx, created.Id)
+		if err != nil || !exists {
+			t.Errorf("Exists = %v, %v, want true", exists, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.FindById(ctx, 404); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("FindById error = %v, want ErrCompanyNotFound", err)
+		}
+		if _, err := repo.FindByDomain(ctx, "nowhere.com"); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("FindByDomain error = %v, want ErrCompanyNotFound", err)
+		}
+		if _, err := repo.Update(ctx, &Company{Id: 404, Name: "Nobody"}); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("Update error = %v, want ErrCompanyNotFound", err)
+		}
+		if _, err := repo.ReplaceDomains(ctx, 404, []string{"nowhere.com"}); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("ReplaceDomains error = %v, want ErrCompanyNotFound", err)
+		}
+		if exists, err := repo.Exists(ctx, 404); err != nil || exists {
+			t.Errorf("Exists = %v, %v, want false", exists, err)
+		}
+		if err := repo.DeleteById(ctx, 404); err != nil {
+			t.Errorf("DeleteById of a missing company: %v", err)
+		}
+	})
+
+	t.Run("find all", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, name := range []string{"First", "Second"} {
+			if _, err := repo.Insert(ctx, &Company{Name: name}); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+		}
+
+		companies, err := repo.FindAll(ctx)
+		if err != nil {
+			t.Fatalf("FindAll: %v", err)
+		}
+		if len(*companies) != 2 || (*companies)[0].Name != "First" || (*companies)[1].Name != "Second" {
+			t.Errorf("FindAll returned %+v", *companies)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, _ := repo.Insert(ctx, &Company{Name: "Old"})
+		updated, err := repo.Update(ctx, &Company{Id: created.Id, Name: "New"})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if updated.Name != "New" {
+			t.Errorf("Update returned %+v", updated)
+		}
+
+		found, _ := repo.FindById(ctx, created.Id)
+		if found.Name != "New" {
+			t.Errorf("FindById after Update returned %+v", found)
+		}
+	})
+
+	t.Run("domains", func(t *testing.T) {
+		repo := newRepo(t)
+
+		acme, _ := repo.Insert(ctx, &Company{Name: "Acme"})
+		other, _ := repo.Insert(ctx, &Company{Name: "Other"})
+
+		if _, err := repo.ReplaceDomains(ctx, acme.Id, []string{"b.com", "a.com"}); err != nil {
+			t.Fatalf("ReplaceDomains: %v", err)
+		}
+
+		found, _ := repo.FindById(ctx, acme.Id)
+		if !slices.Equal(found.Domains, []string{"a.com", "b.com"}) {
+			t.Errorf("domains = %v, want them sorted", found.Domains)
+		}
+
+		byDomain, err := repo.FindByDomain(ctx, "b.com")
+		if err != nil || byDomain.Id != acme.Id {
+			t.Errorf("FindByDomain = %+v, %v", byDomain, err)
+		}
+
+		if _, err := repo.ReplaceDomains(ctx, other.Id, []string{"a.com"}); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("taking a domain of another company: error = %v, want ErrUniqueViolation", err)
+		}
+
+		if _, err := repo.ReplaceDomains(ctx, acme.Id, []string{"c.com"}); err != nil {
+			t.Fatalf("ReplaceDomains: %v", err)
+		}
+		if _, err := repo.FindByDomain(ctx, "a.com"); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("replaced domain still found: %v", err)
+		}
+
+		// Freed domains can be taken by another company.
+		if _, err := repo.ReplaceDomains(ctx, other.Id, []string{"a.com"}); err != nil {
+			t.Errorf("ReplaceDomains with a freed domain: %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+
+		created, _ := repo.Insert(ctx, &Company{Name: "Acme"})
+		repo.ReplaceDomains(ctx, created.Id, []string{"acme.com"})
+
+		if err := repo.DeleteById(ctx, created.Id); err != nil {
+			t.Fatalf("DeleteById: %v", err)
+		}
+
+		if _, err := repo.FindById(ctx, created.Id); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("FindById after delete: error = %v, want ErrCompanyNotFound", err)
+		}
+		if _, err := repo.FindByDomain(ctx, "acme.com"); !errors.Is(err, ErrCompanyNotFound) {
+			t.Errorf("domain of a deleted company still found: %v", err)
+		}
+	})
+}
@@ -1,26 +1,38 @@
 package company
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mthsgimenez/participe/internal/db"
+)
 
 type Repository interface {
-	FindById(id int) (*Company, error)
-	FindAll() (*[]Company, error)
-	DeleteById(id int) error
-	Insert(*Company) (*Company, error)
-	Update(*Company) (*Company, error)
-	Exists(id int) (bool, error)
+	FindById(ctx context.Context, id int) (*Company, error)
+	FindByDomain(ctx context.Context, domain string) (*Company, error)
+	FindAll(ctx context.Context) (*[]Company, error)
+	DeleteById(ctx context.Context, id int) error
+	Insert(ctx context.Context, cmp *Company) (*Company, error)
+	Update(ctx context.Context, cmp *Company) (*Company, error)
+	ReplaceDomains(ctx context.Context, id int, domains []string) ([]string, error)
+	Exists(ctx context.Context, id int) (bool, error)
 }
 
+var ErrDomainNotAllowed = errors.New("email domain not allowed")
+
 type Service struct {
-	repo Repository
+	repo       Repository
+	transactor db.Transactor[Repository]
 }
 
-func NewService(r Repository) *Service {
-	return &Service{r}
+func NewService(r Repository, transactor db.Transactor[Repository]) *Service {
+	return &Service{r, transactor}
 }
 
-func (s *Service) GetCompany(id int) (*Company, error) {
-	c, err := s.repo.FindById(id)
+func (s *Service) GetCompany(ctx context.Context, id int) (*Company, error) {
+	c, err := s.repo.FindById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("company_service: get company: %w", err)
 	}
@@ -28,8 +40,8 @@ func (s *Service) GetCompany(id int) (*Company, error) {
 	return c, nil
 }
 
-func (s *Service) GetCompanies() (*[]Company, error) {
-	cList, err := s.repo.FindAll()
+func (s *Service) GetCompanies(ctx context.Context) (*[]Company, error) {
+	cList, err := s.repo.FindAll(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("company_service: get companies: %w", err)
 	}
@@ -37,8 +49,19 @@ func (s *Service) GetCompanies() (*[]Company, error) {
 	return cList, nil
 }
 
-func (s *Service) CreateCompany(c *Company) (*Company, error) {
-	newComp, err := s.repo.Insert(c)
+// CreateCompany creates the company along with its domains, a domain taken by
+// another company leaves nothing behind.
+func (s *Service) CreateCompany(ctx context.Context, c *Company) (*Company, error) {
+	var newComp *Company
+	err := s.transactor.InTx(ctx, func(repo Repository) error {
+		var err error
+		if newComp, err = repo.Insert(ctx, c); err != nil {
+			return err
+		}
+
+		newComp.Domains, err = repo.ReplaceDomains(ctx, newComp.Id, normalizeDomains(c.Domains))
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("company_service: create company: %w", err)
 	}
@@ -46,15 +69,28 @@ func (s *Service) CreateCompany(c *Company) (*Company, error) {
 	return newComp, nil
 }
 
-func (s *Service) UpdateCompany(id int, newData *Company) (*Company, error) {
-	cmp, err := s.repo.FindById(id)
+// UpdateCompany replaces the company data. Domains are kept when newData.Domains
+// is nil, an empty list removes them.
+func (s *Service) UpdateCompany(ctx context.Context, id int, newData *Company) (*Company, error) {
+	cmp, err := s.repo.FindById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("company_service: update company: find by id: %w", err)
 	}
 
 	cmp.Name = newData.Name
 
-	updatedCmp, err := s.repo.Update(cmp)
+	var updatedCmp *Company
+	err = s.transactor.InTx(ctx, func(repo Repository) error {
+		var err error
+		if updatedCmp, err = repo.Update(ctx, cmp); err != nil {
+			return err
+		}
+
+		if newData.Domains != nil {
+			updatedCmp.Domains, err = repo.ReplaceDomains(ctx, id, normalizeDomains(newData.Domains))
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("company_service: update company: %w", err)
 	}
@@ -62,8 +98,8 @@ func (s *Service) UpdateCompany(id int, newData *Company) (*Company, error) {
 	return updatedCmp, nil
 }
 
-func (s *Service) DeleteCompany(id int) error {
-	exists, err := s.repo.Exists(id)
+func (s *Service) DeleteCompany(ctx context.Context, id int) error {
+	exists, err := s.repo.Exists(ctx, id)
 	if err != nil {
 		return fmt.Errorf("company_service: delete company: exists check: %w", err)
 	}
@@ -72,9 +108,52 @@ func (s *Service) DeleteCompany(id int) error {
 		return fmt.Errorf("company_service: delete company: %w", ErrCompanyNotFound)
 	}
 
-	if err := s.repo.DeleteById(id); err != nil {
+	if err := s.repo.DeleteById(ctx, id); err != nil {
 		return fmt.Errorf("company_service: delete company: %w", err)
 	}
 
 	return nil
 }
+
+// CompanyForEmail returns the company someone registering with email joins. With
+// a companyId the email must belong to one of its domains, without one the
+// company is picked from the email domain.
+func (s *Service) CompanyForEmail(ctx context.Context, email string, companyId int) (*Company, error) {
+	if companyId == 0 {
+		domain := EmailDomain(email)
+		if domain == "" {
+			return nil, fmt.Errorf("company_service: company for email: %w", ErrDomainNotAllowed)
+		}
+
+		cmp, err := s.repo.FindByDomain(ctx, domain)
+		if err != nil {
+			if errors.Is(err, ErrCompanyNotFound) {
+				return nil, fmt.Errorf("company_service: company for email: %w", ErrDomainNotAllowed)
+			}
+			return nil, fmt.Errorf("company_service: company for email: %w", err)
+		}
+
+		return cmp, nil
+	}
+
+	cmp, err := s.repo.FindById(ctx, companyId)
+	if err != nil {
+		return nil, fmt.Errorf("company_service: company for email: %w", err)
+	}
+
+	if !cmp.AllowsEmail(email) {
+		return nil, fmt.Errorf("company_service: company for email: %w", ErrDomainNotAllowed)
+	}
+
+	return cmp, nil
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		normalized = append(normalized, NormalizeDomain(d))
+	}
+
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
@@ -0,0 +1,80 @@
+// Package dbtest gives tests an empty, migrated database to run against.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/env"
+	"github.com/mthsgimenez/participe/internal/migrate"
+)
+
+// lockId serializes the tests of every package, which share the database.
+const lockId = 7_301_992_115
+
+// Open connects to the database in TEST_DATABASE_URL, migrates it and empties
+// every table. The test is skipped when the variable isn't set. The database is
+// held by the test until it ends.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+
+	connString, err := env.GetString("TEST_DATABASE_URL")
+	if err != nil {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	conn, err := db.ConnectToDB(connString)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	lock, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	if _, err := lock.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockId); err != nil {
+		t.Fatalf("dbtest: lock: %v", err)
+	}
+	t.Cleanup(func() {
+		lock.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockId)
+		lock.Close()
+	})
+
+	migrator, err := migrate.New(conn)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT quote_ident(tablename) FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'`)
+	if err != nil {
+		t.Fatalf("dbtest: list tables: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("dbtest: list tables: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("dbtest: list tables: %v", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, `TRUNCATE `+strings.Join(tables, ", ")+` RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatalf("dbtest: truncate: %v", err)
+	}
+
+	return conn
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/mthsgimenez/participe/internal/env"
+)
+
+// ConnStringFromEnv builds the connection string from the DATABASE_* variables.
+func ConnStringFromEnv() string {
+	dbUser := env.GetStringFallback("DATABASE_USER", "postgres")
+	dbPassword := env.GetStringFallback("DATABASE_PASSWORD", "postgres")
+	dbHost := env.GetStringFallback("DATABASE_HOST", "localhost")
+	dbPort := env.GetStringFallback("DATABASE_PORT", "5432")
+	dbName := env.GetStringFallback("DATABASE_NAME", "postgres")
+
+	return fmt.Sprintf(
+		"user=%s password=%s host=%s port=%s dbname=%s sslmode=disable",
+		dbUser, dbPassword, dbHost, dbPort, dbName,
+	)
+}
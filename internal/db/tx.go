@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// DBTX runs statements. Both *sql.DB and *sql.Tx satisfy it, so a repository
+// built on one works the same inside and outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Transactor runs fn with repositories bound to a single transaction, for work
+// that has to succeed or fail as a whole. The transaction commits when fn returns
+// nil and rolls back otherwise.
+type Transactor[R any] interface {
+	InTx(ctx context.Context, fn func(repos R) error) error
+}
+
+// TransactorPostgres begins a transaction on conn and builds the repositories
+// handed to fn from it with bind.
+type TransactorPostgres[R any] struct {
+	conn *sql.DB
+	bind func(tx DBTX) R
+}
+
+func NewTransactorPostgres[R any](conn *sql.DB, bind func(tx DBTX) R) *TransactorPostgres[R] {
+	return &TransactorPostgres[R]{conn, bind}
+}
+
+func (t *TransactorPostgres[R]) InTx(ctx context.Context, fn func(repos R) error) error {
+	tx, err := t.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transactor: begin: %w", err)
+	}
+	// Does nothing once committed.
+	defer tx.Rollback()
+
+	if err := fn(t.bind(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transactor: commit: %w", err)
+	}
+
+	return nil
+}
+
+// TransactorMemory hands in-memory repositories to fn, one call at a time so
+// transactions don't interleave. There is nothing to roll back to, the writes fn
+// made before failing are kept.
+type TransactorMemory[R any] struct {
+	mu    sync.Mutex
+	repos R
+}
+
+func NewTransactorMemory[R any](repos R) *TransactorMemory[R] {
+	return &TransactorMemory[R]{repos: repos}
+}
+
+func (t *TransactorMemory[R]) InTx(ctx context.Context, fn func(repos R) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return fn(t.repos)
+}
@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db/dbtest"
+)
+
+func TestTransactorPostgres(t *testing.T) {
+	ctx := t.Context()
+	conn := dbtest.Open(t)
+	repo := company.NewRepositoryPostgres(conn)
+	transactor := company.NewTransactorPostgres(conn)
+
+	taken, err := repo.Insert(ctx, &company.Company{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if _, err := repo.ReplaceDomains(ctx, taken.Id, []string{"acme.com"}); err != nil {
+		t.Fatalf("ReplaceDomains: %v", err)
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		err := transactor.InTx(ctx, func(tx company.Repository) error {
+			cmp, err := tx.Insert(ctx, &company.Company{Name: "Copy"})
+			if err != nil {
+				return err
+			}
+			_, err = tx.ReplaceDomains(ctx, cmp.Id, []string{"acme.com"})
+			return err
+		})
+		if !errors.Is(err, company.ErrUniqueViolation) {
+			t.Fatalf("InTx error = %v, want ErrUniqueViolation", err)
+		}
+
+		if all, _ := repo.FindAll(ctx); len(*all) != 1 {
+			t.Errorf("companies after rolling back = %+v", *all)
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		var created *company.Company
+		err := transactor.InTx(ctx, func(tx company.Repository) error {
+			var err error
+			if created, err = tx.Insert(ctx, &company.Company{Name: "Globex"}); err != nil {
+				return err
+			}
+			_, err = tx.ReplaceDomains(ctx, created.Id, []string{"globex.com"})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("InTx: %v", err)
+		}
+
+		found, err := repo.FindByDomain(ctx, "globex.com")
+		if err != nil || found.Id != created.Id {
+			t.Errorf("FindByDomain = %+v, %v", found, err)
+		}
+	})
+}
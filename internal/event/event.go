@@ -1,15 +1,118 @@
 package event
 
 import (
+	"fmt"
 	"strings"
 	"time"
 )
 
+const (
+	// DefaultDuration is used when an event is created without an end_date.
+	DefaultDuration = time.Hour
+	// DefaultCheckinOpensBefore is how early check-in opens when an event doesn't set its own window.
+	DefaultCheckinOpensBefore = time.Hour
+)
+
 type Event struct {
 	Id          int       `json:"id"`
 	Description string    `json:"description"`
 	Name        string    `json:"name"`
 	Date        time.Time `json:"date"`
+	EndDate     time.Time `json:"end_date"`
+	// Sessions split events spanning several days, they are optional.
+	Sessions []Session `json:"sessions"`
+	// Capacity is the maximum number of registered users, 0 means unlimited.
+	Capacity int `json:"capacity"`
+	// CheckinOpensAt and CheckinClosesAt bound when attendees can check in, nil
+	// opens DefaultCheckinOpensBefore the Date and closes at the EndDate.
+	CheckinOpensAt  *time.Time `json:"checkin_opens_at"`
+	CheckinClosesAt *time.Time `json:"checkin_closes_at"`
+	// MinAttendanceMinutes is how long an attendee must stay for the attendance
+	// to count toward compliance, 0 means checking in is enough.
+	MinAttendanceMinutes int `json:"min_attendance_minutes"`
+	// SeriesId is set on the occurrences of a recurring event.
+	SeriesId *int `json:"series_id"`
+	// CompanyId is the company the event belongs to, nil for events of no company in particular.
+	CompanyId *int `json:"company_id"`
+	// Visibility defaults to VISIBILITY_PUBLIC, the others require a CompanyId.
+	Visibility Visibility `json:"visibility"`
+	// Companies are the companies a VISIBILITY_SELECTED event is shared with, besides its own.
+	Companies []int `json:"companies"`
+}
+
+// setDefaults fills the optional fields left empty when the event was submitted.
+func (e *Event) setDefaults() {
+	e.EndDate = e.end()
+
+	if e.Sessions == nil {
+		e.Sessions = []Session{}
+	}
+
+	if e.Visibility == "" {
+		e.Visibility = VISIBILITY_PUBLIC
+	}
+
+	if e.Companies == nil {
+		e.Companies = []int{}
+	}
+}
+
+// end returns EndDate, or the default end while the event wasn't saved yet.
+func (e *Event) end() time.Time {
+	if e.EndDate.IsZero() {
+		return e.Date.Add(DefaultDuration)
+	}
+	return e.EndDate
+}
+
+// CheckinWindow returns when check-in opens and closes for the event.
+func (e *Event) CheckinWindow() (opensAt, closesAt time.Time) {
+	opensAt = e.Date.Add(-DefaultCheckinOpensBefore)
+	if e.CheckinOpensAt != nil {
+		opensAt = *e.CheckinOpensAt
+	}
+
+	closesAt = e.end()
+	if e.CheckinClosesAt != nil {
+		closesAt = *e.CheckinClosesAt
+	}
+
+	return
+}
+
+// CheckinWindowError is returned when checking in before the window opens or after it closes.
+type CheckinWindowError struct {
+	OpensAt  time.Time
+	ClosesAt time.Time
+	Closed   bool
+}
+
+func (e *CheckinWindowError) Error() string {
+	if e.Closed {
+		return fmt.Sprintf("checkin closed at %s", e.ClosesAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("checkin opens at %s", e.OpensAt.Format(time.RFC3339))
+}
+
+// ValidationError is returned by the service when an event ends up invalid after a change.
+type ValidationError struct {
+	Problems map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid event: %d problems", len(e.Problems))
+}
+
+// checkCheckinWindow returns a *CheckinWindowError when now is outside the event's check-in window.
+func (e *Event) checkCheckinWindow(now time.Time) error {
+	opensAt, closesAt := e.CheckinWindow()
+	if now.Before(opensAt) {
+		return &CheckinWindowError{OpensAt: opensAt, ClosesAt: closesAt}
+	}
+	if now.After(closesAt) {
+		return &CheckinWindowError{OpensAt: opensAt, ClosesAt: closesAt, Closed: true}
+	}
+	return nil
 }
 
 func (e *Event) Validate() (problems map[string]string) {
@@ -27,5 +130,150 @@ func (e *Event) Validate() (problems map[string]string) {
 		problems["date"] = "date cannot be empty"
 	}
 
+	if !e.EndDate.IsZero() && !e.EndDate.After(e.Date) {
+		problems["end_date"] = "end_date must be after date"
+	}
+
+	validateSessions(e, problems)
+	validateVisibility(e, problems)
+
+	if e.Capacity < 0 {
+		problems["capacity"] = "capacity cannot be negative"
+	}
+
+	if e.MinAttendanceMinutes < 0 {
+		problems["min_attendance_minutes"] = "min_attendance_minutes cannot be negative"
+	}
+
+	if opensAt, closesAt := e.CheckinWindow(); !closesAt.After(opensAt) {
+		problems["checkin_closes_at"] = "checkin_closes_at must be after checkin_opens_at"
+	}
+
 	return
 }
+
+// EventPatch holds a partial update for an Event, nil fields are left untouched.
+type EventPatch struct {
+	Description *string    `json:"description"`
+	Name        *string    `json:"name"`
+	Date        *time.Time `json:"date"`
+	EndDate     *time.Time `json:"end_date"`
+	Sessions    *[]Session `json:"sessions"`
+	Capacity    *int       `json:"capacity"`
+	// CheckinOpensAt and CheckinClosesAt can only be set, not cleared, through a patch.
+	CheckinOpensAt       *time.Time `json:"checkin_opens_at"`
+	CheckinClosesAt      *time.Time `json:"checkin_closes_at"`
+	MinAttendanceMinutes *int       `json:"min_attendance_minutes"`
+	// CompanyId can only be set, not cleared, make the event PUBLIC instead.
+	CompanyId  *int        `json:"company_id"`
+	Visibility *Visibility `json:"visibility"`
+	Companies  *[]int      `json:"companies"`
+}
+
+func (p *EventPatch) Validate() (problems map[string]string) {
+	problems = map[string]string{}
+
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		problems["name"] = "name cannot be empty"
+	}
+
+	if p.Description != nil && strings.TrimSpace(*p.Description) == "" {
+		problems["description"] = "description cannot be empty"
+	}
+
+	if p.Date != nil && p.Date.IsZero() {
+		problems["date"] = "date cannot be empty"
+	}
+
+	if p.Capacity != nil && *p.Capacity < 0 {
+		problems["capacity"] = "capacity cannot be negative"
+	}
+
+	if p.MinAttendanceMinutes != nil && *p.MinAttendanceMinutes < 0 {
+		problems["min_attendance_minutes"] = "min_attendance_minutes cannot be negative"
+	}
+
+	if p.Visibility != nil && !p.Visibility.Valid() {
+		problems["visibility"] = "visibility must be PUBLIC, COMPANY or SELECTED"
+	}
+
+	return
+}
+
+func (p *EventPatch) Apply(e *Event) {
+	if p.Description != nil {
+		e.Description = *p.Description
+	}
+
+	if p.Name != nil {
+		e.Name = *p.Name
+	}
+
+	if p.Date != nil {
+		// Moving only the start keeps the event's duration and sessions in place relative to it.
+		shift := p.Date.Sub(e.Date)
+		e.Date = *p.Date
+
+		if p.EndDate == nil {
+			e.EndDate = e.EndDate.Add(shift)
+		}
+
+		if p.Sessions == nil {
+			for i := range e.Sessions {
+				e.Sessions[i].StartsAt = e.Sessions[i].StartsAt.Add(shift)
+				e.Sessions[i].EndsAt = e.Sessions[i].EndsAt.Add(shift)
+			}
+		}
+
+		// So does the check-in window, check-in would otherwise stay open at the old time.
+		if p.CheckinOpensAt == nil && e.CheckinOpensAt != nil {
+			opensAt := e.CheckinOpensAt.Add(shift)
+			e.CheckinOpensAt = &opensAt
+		}
+
+		if p.CheckinClosesAt == nil && e.CheckinClosesAt != nil {
+			closesAt := e.CheckinClosesAt.Add(shift)
+			e.CheckinClosesAt = &closesAt
+		}
+	}
+
+	if p.EndDate != nil {
+		e.EndDate = *p.EndDate
+	}
+
+	if p.Sessions != nil {
+		e.Sessions = *p.Sessions
+	}
+
+	if p.Capacity != nil {
+		e.Capacity = *p.Capacity
+	}
+
+	if p.CheckinOpensAt != nil {
+		e.CheckinOpensAt = p.CheckinOpensAt
+	}
+
+	if p.CheckinClosesAt != nil {
+		e.CheckinClosesAt = p.CheckinClosesAt
+	}
+
+	if p.MinAttendanceMinutes != nil {
+		e.MinAttendanceMinutes = *p.MinAttendanceMinutes
+	}
+
+	if p.CompanyId != nil {
+		e.CompanyId = p.CompanyId
+	}
+
+	if p.Visibility != nil {
+		e.Visibility = *p.Visibility
+		// Only SELECTED events are shared, switching away drops the companies.
+		if e.Visibility != VISIBILITY_SELECTED && p.Companies == nil {
+			e.Companies = []int{}
+		}
+	}
+
+	if p.Companies != nil {
+		e.Companies = *p.Companies
+	}
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventPatchApplyMovesDate(t *testing.T) {
+	date := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		v := date.Add(time.Duration(hours) * time.Hour)
+		return &v
+	}
+
+	newEvent := func() *Event {
+		return &Event{
+			Date:            date,
+			EndDate:         *at(8),
+			Sessions:        []Session{{Name: "Keynote", StartsAt: *at(1), EndsAt: *at(2)}},
+			CheckinOpensAt:  at(-1),
+			CheckinClosesAt: at(2),
+		}
+	}
+
+	t.Run("shifts what isn't patched", func(t *testing.T) {
+		e := newEvent()
+		(&EventPatch{Date: at(48)}).Apply(e)
+
+		if !e.EndDate.Equal(*at(56)) {
+			t.Errorf("EndDate = %v, want %v", e.EndDate, *at(56))
+		}
+		if !e.Sessions[0].StartsAt.Equal(*at(49)) || !e.Sessions[0].EndsAt.Equal(*at(50)) {
+			t.Errorf("Sessions = %+v, want them two days later", e.Sessions)
+		}
+		if !e.CheckinOpensAt.Equal(*at(47)) || !e.CheckinClosesAt.Equal(*at(50)) {
+			t.Errorf("check-in window = %v to %v, want %v to %v", *e.CheckinOpensAt, *e.CheckinClosesAt, *at(47), *at(50))
+		}
+	})
+
+	t.Run("keeps what is patched", func(t *testing.T) {
+		e := newEvent()
+		(&EventPatch{Date: at(48), CheckinOpensAt: at(40)}).Apply(e)
+
+		if !e.CheckinOpensAt.Equal(*at(40)) || !e.CheckinClosesAt.Equal(*at(50)) {
+			t.Errorf("check-in window = %v to %v, want %v to %v", *e.CheckinOpensAt, *e.CheckinClosesAt, *at(40), *at(50))
+		}
+	})
+
+	t.Run("without a window", func(t *testing.T) {
+		e := newEvent()
+		e.CheckinOpensAt, e.CheckinClosesAt = nil, nil
+		(&EventPatch{Date: at(48)}).Apply(e)
+
+		if e.CheckinOpensAt != nil || e.CheckinClosesAt != nil {
+			t.Errorf("check-in window = %v to %v, want none", e.CheckinOpensAt, e.CheckinClosesAt)
+		}
+	})
+}
@@ -0,0 +1,691 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+// RepositoryMemory keeps events in memory. It behaves like RepositoryPostgres,
+// errors included, for tests and running without a database.
+type RepositoryMemory struct {
+	mu        sync.Mutex
+	users     *user.RepositoryMemory
+	companies *company.RepositoryMemory
+
+	lastId int
+	events map[int]Event
+	// shared holds the companies each event is shared with.
+	shared map[int][]int
+
+	lastSeriesId int
+	series       map[int]Series
+
+	lastSessionId int
+	sessions      map[int][]Session
+
+	lastRegistrationId int
+	registrations      []memoryRegistration
+
+	lastWaitlistId int
+	waitlist       []memoryWaitlistEntry
+}
+
+// memoryRegistration is a row of events_users.
+type memoryRegistration struct {
+	id int
+	Registration
+}
+
+// memoryWaitlistEntry is a row of events_waitlist.
+type memoryWaitlistEntry struct {
+	id        int
+	userId    int
+	eventId   int
+	createdAt time.Time
+}
+
+// NewRepositoryMemory returns an empty repository whose events reference the users
+// and companies of the given repositories, deleting those cascades or is restricted
+// like with the Postgres foreign keys.
+func NewRepositoryMemory(users *user.RepositoryMemory, companies *company.RepositoryMemory) *RepositoryMemory {
+	r := &RepositoryMemory{
+		users:     users,
+		companies: companies,
+		events:    map[int]Event{},
+		shared:    map[int][]int{},
+		series:    map[int]Series{},
+		sessions:  map[int][]Session{},
+	}
+	companies.OnDelete(r.hasCompany, r.unshareCompany)
+	users.OnDelete(r.deleteUserRows)
+	return r
+}
+
+func (r *RepositoryMemory) hasCompany(companyId int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.events {
+		if e.CompanyId != nil && *e.CompanyId == companyId {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RepositoryMemory) unshareCompany(companyId int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for eventId, ids := range r.shared {
+		r.shared[eventId] = slices.DeleteFunc(ids, func(id int) bool { return id == companyId })
+	}
+}
+
+func (r *RepositoryMemory) deleteUserRows(userId int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.registrations = slices.DeleteFunc(r.registrations, func(reg memoryRegistration) bool { return reg.UserId == userId })
+	r.waitlist = slices.DeleteFunc(r.waitlist, func(w memoryWaitlistEntry) bool { return w.userId == userId })
+}
+
+// load returns a copy of the stored event with the columns of eventColumns.
+func (r *RepositoryMemory) load(id int) Event {
+	e := r.events[id]
+	e.CheckinOpensAt = cloneTime(e.CheckinOpensAt)
+	e.CheckinClosesAt = cloneTime(e.CheckinClosesAt)
+	e.SeriesId = cloneInt(e.SeriesId)
+	e.CompanyId = cloneInt(e.CompanyId)
+	e.Companies = slices.Clone(r.shared[id])
+	if e.Companies == nil {
+		e.Companies = []int{}
+	}
+	return e
+}
+
+// visibleTo mirrors the SQL condition of the same name, a nil company sees everything.
+func (r *RepositoryMemory) visibleTo(e Event, companyId *int) bool {
+	return companyId == nil ||
+		e.Visibility == VISIBILITY_PUBLIC ||
+		(e.CompanyId != nil && *e.CompanyId == *companyId) ||
+		(e.Visibility == VISIBILITY_SELECTED && slices.Contains(r.shared[e.Id], *companyId))
+}
+
+// find returns the events matching keep, ordered by date.
+func (r *RepositoryMemory) find(keep func(e Event) bool) []Event {
+	var events []Event
+	for id := range r.events {
+		if e := r.load(id); keep(e) {
+			events = append(events, e)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Date.Equal(events[j].Date) {
+			return events[i].Id < events[j].Id
+		}
+		return events[i].Date.Before(events[j].Date)
+	})
+	return events
+}
+
+func (r *RepositoryMemory) FindById(ctx context.Context, id int, viewerCompanyId *int) (*Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[id]; !ok {
+		return nil, fmt.Errorf("event_repository: find by id: %w", ErrEventNotFound)
+	}
+
+	e := r.load(id)
+	if !r.visibleTo(e, viewerCompanyId) {
+		return nil, fmt.Errorf("event_repository: find by id: %w", ErrEventNotFound)
+	}
+
+	return &e, nil
+}
+
+func (r *RepositoryMemory) FindAll(ctx context.Context) (*[]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.find(func(Event) bool { return true })
+	return &events, nil
+}
+
+// checkForeignKeys reports a company or series of e that doesn't exist.
+func (r *RepositoryMemory) checkForeignKeys(ctx context.Context, e *Event) error {
+	if e.SeriesId != nil {
+		if _, ok := r.series[*e.SeriesId]; !ok {
+			return ErrSeriesNotFound
+		}
+	}
+
+	if e.CompanyId != nil {
+		if exists, _ := r.companies.Exists(ctx, *e.CompanyId); !exists {
+			return company.ErrCompanyNotFound
+		}
+	}
+
+	return nil
+}
+
+// store saves the columns of eventColumns, the sessions and companies have their own methods.
+func (r *RepositoryMemory) store(id int, e *Event) {
+	r.events[id] = Event{
+		Id:                   id,
+		Description:          e.Description,
+		Name:                 e.Name,
+		Date:                 e.Date,
+		EndDate:              e.EndDate,
+		Capacity:             e.Capacity,
+		CheckinOpensAt:       cloneTime(e.CheckinOpensAt),
+		CheckinClosesAt:      cloneTime(e.CheckinClosesAt),
+		MinAttendanceMinutes: e.MinAttendanceMinutes,
+		SeriesId:             cloneInt(e.SeriesId),
+		CompanyId:            cloneInt(e.CompanyId),
+		Visibility:           e.Visibility,
+	}
+}
+
+func (r *RepositoryMemory) Insert(ctx context.Context, e *Event) (*Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkForeignKeys(ctx, e); err != nil {
+		return nil, fmt.Errorf("event_repository: insert: %w", err)
+	}
+
+	r.lastId++
+	r.store(r.lastId, e)
+
+	newEvent := r.load(r.lastId)
+	return &newEvent, nil
+}
+
+func (r *RepositoryMemory) Update(ctx context.Context, e *Event) (*Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.events[e.Id]
+	if !ok {
+		return nil, fmt.Errorf("event_repository: update: %w", ErrEventNotFound)
+	}
+
+	// Like the Postgres query, the series can't be changed.
+	updated := *e
+	updated.SeriesId = old.SeriesId
+	if err := r.checkForeignKeys(ctx, &updated); err != nil {
+		return nil, fmt.Errorf("event_repository: update: %w", err)
+	}
+
+	r.store(e.Id, &updated)
+
+	updatedEvent := r.load(e.Id)
+	return &updatedEvent, nil
+}
+
+func (r *RepositoryMemory) DeleteById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteEvent(id)
+	return nil
+}
+
+// deleteEvent removes the event and the rows that cascade with it.
+func (r *RepositoryMemory) deleteEvent(id int) {
+	delete(r.events, id)
+	delete(r.shared, id)
+	delete(r.sessions, id)
+	r.registrations = slices.DeleteFunc(r.registrations, func(reg memoryRegistration) bool { return reg.EventId == id })
+	r.waitlist = slices.DeleteFunc(r.waitlist, func(w memoryWaitlistEntry) bool { return w.eventId == id })
+}
+
+func (r *RepositoryMemory) Exists(ctx context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.events[id]
+	return ok, nil
+}
+
+// LockById only checks the event exists, TransactorMemory already runs one
+// transaction at a time.
+func (r *RepositoryMemory) LockById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[id]; !ok {
+		return fmt.Errorf("event_repository: lock by id: %w", ErrEventNotFound)
+	}
+	return nil
+}
+
+func (r *RepositoryMemory) FindUpcoming(ctx context.Context, viewerCompanyId *int) (*[]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	events := r.find(func(e Event) bool {
+		return e.EndDate.After(now) && r.visibleTo(e, viewerCompanyId)
+	})
+	return &events, nil
+}
+
+func (r *RepositoryMemory) InsertSeries(ctx context.Context, series *Series) (*Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastSeriesId++
+	newSeries := Series{Id: r.lastSeriesId, Name: series.Name, Rule: series.Rule}
+	r.series[newSeries.Id] = newSeries
+
+	return &newSeries, nil
+}
+
+func (r *RepositoryMemory) FindSeriesById(ctx context.Context, id int) (*Series, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	series, ok := r.series[id]
+	if !ok {
+		return nil, fmt.Errorf("event_repository: find series by id: %w", ErrSeriesNotFound)
+	}
+
+	return &series, nil
+}
+
+func (r *RepositoryMemory) FindSeriesEvents(ctx context.Context, seriesId int, from time.Time, viewerCompanyId *int) (*[]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.find(func(e Event) bool {
+		return e.SeriesId != nil && *e.SeriesId == seriesId && !e.Date.Before(from) && r.visibleTo(e, viewerCompanyId)
+	})
+	if events == nil {
+		events = []Event{}
+	}
+	return &events, nil
+}
+
+func (r *RepositoryMemory) DeleteSeriesById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.series[id]; !ok {
+		return fmt.Errorf("event_repository: delete series: %w", ErrSeriesNotFound)
+	}
+
+	delete(r.series, id)
+	for eventId, e := range r.events {
+		if e.SeriesId != nil && *e.SeriesId == id {
+			r.deleteEvent(eventId)
+		}
+	}
+
+	return nil
+}
+
+func (r *RepositoryMemory) FindSessions(ctx context.Context, e *Event) (*[]Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := slices.Clone(r.sessions[e.Id])
+	if sessions == nil {
+		sessions = []Session{}
+	}
+	return &sessions, nil
+}
+
+func (r *RepositoryMemory) ReplaceSessions(ctx context.Context, e *Event, sessions []Session) (*[]Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[e.Id]; !ok && len(sessions) > 0 {
+		return nil, fmt.Errorf("event_repository: replace sessions: %w", ErrForeignKeyViolation)
+	}
+
+	newSessions := []Session{}
+	for _, session := range sessions {
+		r.lastSessionId++
+		newSessions = append(newSessions, Session{Id: r.lastSessionId, Name: session.Name, StartsAt: session.StartsAt, EndsAt: session.EndsAt})
+	}
+
+	stored := slices.Clone(newSessions)
+	sort.SliceStable(stored, func(i, j int) bool {
+		return stored[i].StartsAt.Before(stored[j].StartsAt)
+	})
+	delete(r.sessions, e.Id)
+	if len(stored) > 0 {
+		r.sessions[e.Id] = stored
+	}
+
+	return &newSessions, nil
+}
+
+func (r *RepositoryMemory) ReplaceCompanies(ctx context.Context, e *Event, companyIds []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []int{}
+	for _, companyId := range companyIds {
+		if exists, _ := r.companies.Exists(ctx, companyId); !exists {
+			return fmt.Errorf("event_repository: replace companies: %w", company.ErrCompanyNotFound)
+		}
+		if _, ok := r.events[e.Id]; !ok {
+			return fmt.Errorf("event_repository: replace companies: %w", company.ErrCompanyNotFound)
+		}
+		if !slices.Contains(ids, companyId) {
+			ids = append(ids, companyId)
+		}
+	}
+
+	sort.Ints(ids)
+	delete(r.shared, e.Id)
+	if len(ids) > 0 {
+		r.shared[e.Id] = ids
+	}
+
+	return nil
+}
+
+// registrationsOf returns the registrations matching keep, ordered like they were registered.
+func (r *RepositoryMemory) registrationsOf(keep func(reg memoryRegistration) bool) []memoryRegistration {
+	var regs []memoryRegistration
+	for _, reg := range r.registrations {
+		if keep(reg) {
+			regs = append(regs, reg)
+		}
+	}
+
+	sort.SliceStable(regs, func(i, j int) bool {
+		if regs[i].RegisteredAt.Equal(regs[j].RegisteredAt) {
+			return regs[i].id < regs[j].id
+		}
+		return regs[i].RegisteredAt.Before(regs[j].RegisteredAt)
+	})
+	return regs
+}
+
+// registrationRow returns a copy of the registration fields, without the user or event.
+func registrationRow(reg memoryRegistration) Registration {
+	return Registration{
+		UserId:       reg.UserId,
+		EventId:      reg.EventId,
+		Status:       reg.Status,
+		RegisteredAt: reg.RegisteredAt,
+		CancelledAt:  cloneTime(reg.CancelledAt),
+		CheckedInAt:  cloneTime(reg.CheckedInAt),
+		CheckedOutAt: cloneTime(reg.CheckedOutAt),
+	}
+}
+
+// summary returns the user columns the Postgres queries join on registrations and waitlists.
+func (r *RepositoryMemory) summary(ctx context.Context, userId int) *user.User {
+	u, err := r.users.FindById(ctx, userId)
+	if err != nil {
+		return &user.User{Id: userId}
+	}
+	return &user.User{Id: u.Id, Email: u.Email, Company: company.Company{Id: u.Company.Id}, Name: u.Name}
+}
+
+func (r *RepositoryMemory) FindCheckedUsers(ctx context.Context, e *Event, statuses ...RegistrationStatus) (*[]Registration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var registrations []Registration
+	for _, reg := range r.registrationsOf(func(reg memoryRegistration) bool {
+		return reg.EventId == e.Id && (len(statuses) == 0 || slices.Contains(statuses, reg.Status))
+	}) {
+		row := registrationRow(reg)
+		row.User = r.summary(ctx, reg.UserId)
+		registrations = append(registrations, row)
+	}
+
+	return &registrations, nil
+}
+
+func (r *RepositoryMemory) FindRegistrationsByUser(ctx context.Context, u *user.User, from, to *time.Time) (*[]Registration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registrations := []Registration{}
+	for _, reg := range r.registrations {
+		if reg.UserId != u.Id {
+			continue
+		}
+
+		e := r.load(reg.EventId)
+		if (from != nil && !e.EndDate.After(*from)) || (to != nil && !e.Date.Before(*to)) {
+			continue
+		}
+
+		row := registrationRow(reg)
+		row.Event = &e
+		registrations = append(registrations, row)
+	}
+
+	sort.SliceStable(registrations, func(i, j int) bool {
+		a, b := registrations[i].Event, registrations[j].Event
+		if a.Date.Equal(b.Date) {
+			return a.Id < b.Id
+		}
+		return a.Date.Before(b.Date)
+	})
+
+	return &registrations, nil
+}
+
+// registration returns the index of the registration of the user in the event, or -1.
+func (r *RepositoryMemory) registration(eventId, userId int) int {
+	return slices.IndexFunc(r.registrations, func(reg memoryRegistration) bool {
+		return reg.EventId == eventId && reg.UserId == userId
+	})
+}
+
+func (r *RepositoryMemory) Register(ctx context.Context, e *Event, u *user.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.registration(e.Id, u.Id); i >= 0 {
+		// Only cancelled registrations can be taken again.
+		if r.registrations[i].Status != STATUS_CANCELLED {
+			return fmt.Errorf("event_repository: register: %w", ErrUniqueViolation)
+		}
+
+		r.registrations[i].Registration = Registration{
+			UserId:       u.Id,
+			EventId:      e.Id,
+			Status:       STATUS_REGISTERED,
+			RegisteredAt: time.Now(),
+		}
+		return nil
+	}
+
+	if _, ok := r.events[e.Id]; !ok {
+		return fmt.Errorf("event_repository: register: %w", ErrForeignKeyViolation)
+	}
+	if exists, _ := r.users.Exists(ctx, u.Id); !exists {
+		return fmt.Errorf("event_repository: register: %w", ErrForeignKeyViolation)
+	}
+
+	r.lastRegistrationId++
+	r.registrations = append(r.registrations, memoryRegistration{
+		id: r.lastRegistrationId,
+		Registration: Registration{
+			UserId:       u.Id,
+			EventId:      e.Id,
+			Status:       STATUS_REGISTERED,
+			RegisteredAt: time.Now(),
+		},
+	})
+
+	return nil
+}
+
+func (r *RepositoryMemory) FindRegistration(ctx context.Context, e *Event, u *user.User) (*Registration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.registration(e.Id, u.Id)
+	if i < 0 {
+		return nil, fmt.Errorf("event_repository: find registration: %w", ErrRegistrationNotFound)
+	}
+
+	reg := registrationRow(r.registrations[i])
+	reg.User = u
+	return &reg, nil
+}
+
+func (r *RepositoryMemory) UpdateRegistration(ctx context.Context, reg *Registration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.registration(reg.EventId, reg.UserId)
+	if i < 0 {
+		return fmt.Errorf("event_repository: update registration: %w", ErrRegistrationNotFound)
+	}
+
+	stored := &r.registrations[i]
+	stored.Status = reg.Status
+	stored.CancelledAt = cloneTime(reg.CancelledAt)
+	stored.CheckedInAt = cloneTime(reg.CheckedInAt)
+	stored.CheckedOutAt = cloneTime(reg.CheckedOutAt)
+
+	return nil
+}
+
+func (r *RepositoryMemory) CheckinUser(ctx context.Context, reg *Registration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.registration(reg.EventId, reg.UserId)
+	if i < 0 {
+		return fmt.Errorf("event_repository: checkin user: %w", ErrEventNotVisible)
+	}
+
+	u, err := r.users.FindById(ctx, reg.UserId)
+	if err != nil || !r.visibleTo(r.load(reg.EventId), &u.Company.Id) {
+		return fmt.Errorf("event_repository: checkin user: %w", ErrEventNotVisible)
+	}
+
+	stored := &r.registrations[i]
+	stored.Status = reg.Status
+	stored.CheckedInAt = cloneTime(reg.CheckedInAt)
+
+	return nil
+}
+
+func (r *RepositoryMemory) CountActiveRegistrations(ctx context.Context, e *Event) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, reg := range r.registrations {
+		if reg.EventId == e.Id && reg.Status != STATUS_CANCELLED {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *RepositoryMemory) AddToWaitlist(ctx context.Context, e *Event, u *user.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.waitlist {
+		if w.eventId == e.Id && w.userId == u.Id {
+			return fmt.Errorf("event_repository: add to waitlist: %w", ErrUniqueViolation)
+		}
+	}
+
+	if _, ok := r.events[e.Id]; !ok {
+		return fmt.Errorf("event_repository: add to waitlist: %w", ErrForeignKeyViolation)
+	}
+	if exists, _ := r.users.Exists(ctx, u.Id); !exists {
+		return fmt.Errorf("event_repository: add to waitlist: %w", ErrForeignKeyViolation)
+	}
+
+	r.lastWaitlistId++
+	r.waitlist = append(r.waitlist, memoryWaitlistEntry{id: r.lastWaitlistId, userId: u.Id, eventId: e.Id, createdAt: time.Now()})
+
+	return nil
+}
+
+func (r *RepositoryMemory) RemoveFromWaitlist(ctx context.Context, e *Event, u *user.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := len(r.waitlist)
+	r.waitlist = slices.DeleteFunc(r.waitlist, func(w memoryWaitlistEntry) bool { return w.eventId == e.Id && w.userId == u.Id })
+
+	if len(r.waitlist) == before {
+		return fmt.Errorf("event_repository: remove from waitlist: %w", ErrRegistrationNotFound)
+	}
+
+	return nil
+}
+
+// waitlistOf returns the waitlist of the event, oldest entry first. Entries are
+// appended in creation order, which already is that order.
+func (r *RepositoryMemory) waitlistOf(eventId int) []memoryWaitlistEntry {
+	var entries []memoryWaitlistEntry
+	for _, w := range r.waitlist {
+		if w.eventId == eventId {
+			entries = append(entries, w)
+		}
+	}
+	return entries
+}
+
+func (r *RepositoryMemory) PopWaitlist(ctx context.Context, e *Event) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := r.waitlistOf(e.Id)
+	if len(entries) == 0 {
+		return 0, fmt.Errorf("event_repository: pop waitlist: %w", ErrWaitlistEmpty)
+	}
+
+	first := entries[0]
+	r.waitlist = slices.DeleteFunc(r.waitlist, func(w memoryWaitlistEntry) bool { return w.id == first.id })
+
+	return first.userId, nil
+}
+
+func (r *RepositoryMemory) FindWaitlist(ctx context.Context, e *Event) (*[]user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []user.User
+	for _, w := range r.waitlistOf(e.Id) {
+		users = append(users, *r.summary(ctx, w.userId))
+	}
+
+	return &users, nil
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func cloneInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	c := *i
+	return &c
+}
@@ -0,0 +1,291 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps how many events a single series can expand into.
+const MaxOccurrences = 200
+
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+type Frequency string
+
+const (
+	FREQ_WEEKLY  Frequency = "WEEKLY"
+	FREQ_MONTHLY Frequency = "MONTHLY"
+)
+
+// WeekdayRule is a BYDAY entry. Ordinal picks the nth weekday of the month,
+// negative counts from the end and 0 means every such weekday.
+type WeekdayRule struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// Recurrence is the subset of RFC 5545 RRULE supported by event series: weekly
+// on some weekdays, monthly on a day of the month or on the nth weekday,
+// bounded by COUNT or UNTIL.
+type Recurrence struct {
+	Frequency  Frequency
+	Interval   int
+	ByDay      []WeekdayRule
+	ByMonthDay int
+	Count      int
+	Until      *time.Time
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRecurrence parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10" or
+// "FREQ=MONTHLY;BYDAY=2TU;UNTIL=20261231".
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rec := &Recurrence{Interval: 1}
+
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	for part := range strings.SplitSeq(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a KEY=VALUE pair", ErrInvalidRecurrence, part)
+		}
+
+		var err error
+		switch key {
+		case "FREQ":
+			rec.Frequency = Frequency(value)
+			if rec.Frequency != FREQ_WEEKLY && rec.Frequency != FREQ_MONTHLY {
+				return nil, fmt.Errorf("%w: FREQ must be WEEKLY or MONTHLY", ErrInvalidRecurrence)
+			}
+		case "INTERVAL":
+			rec.Interval, err = strconv.Atoi(value)
+			if err != nil || rec.Interval < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive int", ErrInvalidRecurrence)
+			}
+		case "COUNT":
+			rec.Count, err = strconv.Atoi(value)
+			if err != nil || rec.Count < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive int", ErrInvalidRecurrence)
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rec.Until = &until
+		case "BYMONTHDAY":
+			rec.ByMonthDay, err = strconv.Atoi(value)
+			if err != nil || rec.ByMonthDay < 1 || rec.ByMonthDay > 31 {
+				return nil, fmt.Errorf("%w: BYMONTHDAY must be between 1 and 31", ErrInvalidRecurrence)
+			}
+		case "BYDAY":
+			for day := range strings.SplitSeq(value, ",") {
+				wr, err := parseWeekdayRule(day)
+				if err != nil {
+					return nil, err
+				}
+				rec.ByDay = append(rec.ByDay, wr)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s is not supported", ErrInvalidRecurrence, key)
+		}
+	}
+
+	if rec.Frequency == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	}
+
+	if (rec.Count == 0) == (rec.Until == nil) {
+		return nil, fmt.Errorf("%w: exactly one of COUNT or UNTIL is required", ErrInvalidRecurrence)
+	}
+
+	if rec.Count > MaxOccurrences {
+		return nil, fmt.Errorf("%w: COUNT can't be over %d", ErrInvalidRecurrence, MaxOccurrences)
+	}
+
+	if rec.ByMonthDay != 0 && (rec.Frequency != FREQ_MONTHLY || len(rec.ByDay) > 0) {
+		return nil, fmt.Errorf("%w: BYMONTHDAY only applies to MONTHLY rules without BYDAY", ErrInvalidRecurrence)
+	}
+
+	for _, wr := range rec.ByDay {
+		if wr.Ordinal != 0 && rec.Frequency != FREQ_MONTHLY {
+			return nil, fmt.Errorf("%w: BYDAY ordinals only apply to MONTHLY rules", ErrInvalidRecurrence)
+		}
+	}
+
+	return rec, nil
+}
+
+func parseWeekdayRule(s string) (WeekdayRule, error) {
+	if len(s) < 2 {
+		return WeekdayRule{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRecurrence, s)
+	}
+
+	weekday, ok := weekdayCodes[s[len(s)-2:]]
+	if !ok {
+		return WeekdayRule{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRecurrence, s)
+	}
+
+	ordinal := 0
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayRule{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRecurrence, s)
+		}
+		ordinal = n
+	}
+
+	return WeekdayRule{Ordinal: ordinal, Weekday: weekday}, nil
+}
+
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if layout == "20060102" {
+				// A date only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: UNTIL must look like 20261231 or 20261231T235959Z", ErrInvalidRecurrence)
+}
+
+// String formats the rule back to its RRULE form.
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + string(r.Frequency)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wr := range r.ByDay {
+			code := strings.ToUpper(wr.Weekday.String()[:2])
+			if wr.Ordinal != 0 {
+				code = strconv.Itoa(wr.Ordinal) + code
+			}
+			days[i] = code
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if r.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Occurrences expands the rule into start times, beginning with the first one
+// at or after start. Every occurrence keeps the wall clock time of start.
+func (r *Recurrence) Occurrences(start time.Time) ([]time.Time, error) {
+	var result []time.Time
+
+	// Each period is a week or a month, the limit stops rules that never match, like BYMONTHDAY=31 with a long INTERVAL.
+	for period := 0; period < MaxOccurrences*12; period += r.Interval {
+		candidates := r.candidates(start, period)
+		for _, c := range candidates {
+			if c.Before(start) {
+				continue
+			}
+
+			if r.Until != nil && c.After(*r.Until) {
+				return result, nil
+			}
+
+			result = append(result, c)
+			if len(result) == r.Count {
+				return result, nil
+			}
+
+			if len(result) > MaxOccurrences {
+				return nil, fmt.Errorf("%w: rule expands to more than %d occurrences", ErrInvalidRecurrence, MaxOccurrences)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// candidates returns the sorted start times within the period-th week or month after start.
+func (r *Recurrence) candidates(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	var result []time.Time
+	switch r.Frequency {
+	case FREQ_WEEKLY:
+		// Weeks start on monday, as with the RRULE default WKST=MO.
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := at(start.Year(), start.Month(), start.Day()-offset+7*period)
+
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []WeekdayRule{{Weekday: start.Weekday()}}
+		}
+		for _, wr := range days {
+			result = append(result, monday.AddDate(0, 0, (int(wr.Weekday)+6)%7))
+		}
+	case FREQ_MONTHLY:
+		first := at(start.Year(), start.Month()+time.Month(period), 1)
+		year, month := first.Year(), first.Month()
+		daysInMonth := at(year, month+1, 0).Day()
+
+		if len(r.ByDay) == 0 {
+			day := r.ByMonthDay
+			if day == 0 {
+				day = start.Day()
+			}
+			// Months without that day are skipped, as RFC 5545 does.
+			if day <= daysInMonth {
+				result = append(result, at(year, month, day))
+			}
+			break
+		}
+
+		for _, wr := range r.ByDay {
+			var matches []time.Time
+			for day := 1; day <= daysInMonth; day++ {
+				if t := at(year, month, day); t.Weekday() == wr.Weekday {
+					matches = append(matches, t)
+				}
+			}
+
+			switch {
+			case wr.Ordinal == 0:
+				result = append(result, matches...)
+			case wr.Ordinal > 0 && wr.Ordinal <= len(matches):
+				result = append(result, matches[wr.Ordinal-1])
+			case wr.Ordinal < 0 && -wr.Ordinal <= len(matches):
+				result = append(result, matches[len(matches)+wr.Ordinal])
+			}
+		}
+	}
+
+	slices.SortFunc(result, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(result, func(a, b time.Time) bool { return a.Equal(b) })
+}
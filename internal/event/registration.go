@@ -0,0 +1,76 @@
+package event
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type RegistrationStatus string
+
+const (
+	STATUS_REGISTERED RegistrationStatus = "REGISTERED"
+	STATUS_CANCELLED  RegistrationStatus = "CANCELLED"
+	STATUS_ATTENDED   RegistrationStatus = "ATTENDED"
+	STATUS_NO_SHOW    RegistrationStatus = "NO_SHOW"
+)
+
+func (s RegistrationStatus) String() string {
+	return string(s)
+}
+
+func (s RegistrationStatus) Valid() bool {
+	switch s {
+	case STATUS_REGISTERED, STATUS_CANCELLED, STATUS_ATTENDED, STATUS_NO_SHOW:
+		return true
+	default:
+		return false
+	}
+}
+
+func StringToRegistrationStatus(s string) (RegistrationStatus, bool) {
+	status := RegistrationStatus(strings.ToUpper(strings.TrimSpace(s)))
+	return status, status.Valid()
+}
+
+// Registration is the link between a user and an event, from sign up to attendance.
+// User is loaded when listing the registrations of an event and Event when listing
+// the ones of a user.
+type Registration struct {
+	UserId       int                `json:"user_id"`
+	EventId      int                `json:"event_id"`
+	User         *user.User         `json:"user,omitempty"`
+	Event        *Event             `json:"event,omitempty"`
+	Status       RegistrationStatus `json:"status"`
+	RegisteredAt time.Time          `json:"registered_at"`
+	CancelledAt  *time.Time         `json:"cancelled_at"`
+	CheckedInAt  *time.Time         `json:"checked_in_at"`
+	CheckedOutAt *time.Time         `json:"checked_out_at"`
+	// DurationMinutes and Compliant are derived from the timestamps, see setAttendance.
+	DurationMinutes *int `json:"duration_minutes"`
+	Compliant       bool `json:"compliant"`
+}
+
+// Duration returns how long the user stayed, it is only known after check-out.
+func (r *Registration) Duration() (time.Duration, bool) {
+	if r.CheckedInAt == nil || r.CheckedOutAt == nil {
+		return 0, false
+	}
+
+	return r.CheckedOutAt.Sub(*r.CheckedInAt), true
+}
+
+// setAttendance fills the derived attendance fields. An attendance counts toward
+// compliance once the user attended for at least the event's minimum duration.
+func (r *Registration) setAttendance(e *Event) {
+	r.DurationMinutes = nil
+	d, ok := r.Duration()
+	if ok {
+		minutes := int(d / time.Minute)
+		r.DurationMinutes = &minutes
+	}
+
+	minimum := time.Duration(e.MinAttendanceMinutes) * time.Minute
+	r.Compliant = r.Status == STATUS_ATTENDED && (minimum == 0 || (ok && d >= minimum))
+}
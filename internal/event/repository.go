@@ -1,33 +1,97 @@
 package event
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db"
 	"github.com/mthsgimenez/participe/internal/user"
 )
 
 var (
-	ErrEventNotFound       = errors.New("event not found")
-	ErrForeignKeyViolation = errors.New("foreign key constraint violated")
-	ErrUniqueViolation     = errors.New("unique constraint violated")
+	ErrEventNotFound        = errors.New("event not found")
+	ErrForeignKeyViolation  = errors.New("foreign key constraint violated")
+	ErrUniqueViolation      = errors.New("unique constraint violated")
+	ErrRegistrationNotFound = errors.New("registration not found")
+	ErrWaitlistEmpty        = errors.New("waitlist is empty")
+	ErrSeriesNotFound       = errors.New("series not found")
+	ErrEventNotVisible      = errors.New("event not visible to the user's company")
 )
 
+const eventColumns = `id, description, "name", "date", end_date, capacity, checkin_opens_at, checkin_closes_at, min_attendance_minutes, series_id,
+	company_id, visibility, ARRAY(SELECT ec.company_id FROM event_companies ec WHERE ec.event_id = events.id ORDER BY ec.company_id) AS companies`
+
+// visibleTo is the condition matching the events the users of the company
+// companyId, an SQL expression, can see. A NULL company matches every event.
+// The events table must not be aliased.
+func visibleTo(companyId string) string {
+	return `(` + companyId + ` IS NULL
+		OR events.visibility = '` + VISIBILITY_PUBLIC.String() + `'
+		OR events.company_id = ` + companyId + `
+		OR (events.visibility = '` + VISIBILITY_SELECTED.String() + `' AND EXISTS (
+			SELECT 1 FROM event_companies ec WHERE ec.event_id = events.id AND ec.company_id = ` + companyId + `)))`
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanEvent reads a row selected with eventColumns into e.
+func scanEvent(row scanner, e *Event) error {
+	return row.Scan(eventFields(e)...)
+}
+
+// eventFields returns the scan destinations matching eventColumns.
+func eventFields(e *Event) []any {
+	return []any{&e.Id, &e.Description, &e.Name, &e.Date, &e.EndDate, &e.Capacity, &e.CheckinOpensAt, &e.CheckinClosesAt, &e.MinAttendanceMinutes, &e.SeriesId,
+		&e.CompanyId, &e.Visibility, companyIds{&e.Companies}}
+}
+
+// companyIds scans an int array column into a []int, which pq.Array doesn't support.
+type companyIds struct {
+	dest *[]int
+}
+
+func (c companyIds) Scan(src any) error {
+	var ids pq.Int64Array
+	if err := ids.Scan(src); err != nil {
+		return err
+	}
+
+	*c.dest = make([]int, len(ids))
+	for i, id := range ids {
+		(*c.dest)[i] = int(id)
+	}
+	return nil
+}
+
 type RepositoryPostgres struct {
-	db *sql.DB
+	db db.DBTX
 }
 
-func NewRepositoryPostgres(db *sql.DB) *RepositoryPostgres {
-	return &RepositoryPostgres{db}
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
 }
 
-func (r *RepositoryPostgres) FindById(id int) (*Event, error) {
+// NewTransactorPostgres runs transactions on conn with a RepositoryPostgres bound to each.
+func NewTransactorPostgres(conn *sql.DB) *db.TransactorPostgres[Repository] {
+	return db.NewTransactorPostgres(conn, func(tx db.DBTX) Repository {
+		return NewRepositoryPostgres(tx)
+	})
+}
+
+// FindById returns the event when the users of company viewerCompanyId can see
+// it, a nil viewerCompanyId skips the check.
+func (r *RepositoryPostgres) FindById(ctx context.Context, id int, viewerCompanyId *int) (*Event, error) {
 	event := &Event{}
 
-	row := r.db.QueryRow(`SELECT id, description, "name", "date" FROM events WHERE id = $1`, id)
-	if err := row.Scan(&event.Id, &event.Description, &event.Name, &event.Date); err != nil {
+	row := r.db.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events WHERE id = $1 AND `+visibleTo("$2::int"), id, viewerCompanyId)
+	if err := scanEvent(row, event); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("event_repository: find by id: %w", ErrEventNotFound)
 		}
@@ -37,8 +101,8 @@ func (r *RepositoryPostgres) FindById(id int) (*Event, error) {
 	return event, nil
 }
 
-func (r *RepositoryPostgres) FindAll() (*[]Event, error) {
-	rows, err := r.db.Query(`SELECT id, description, "name", "date" FROM events`)
+func (r *RepositoryPostgres) FindAll(ctx context.Context) (*[]Event, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+eventColumns+` FROM events`)
 	if err != nil {
 		return nil, fmt.Errorf("event_repository: find all: %w", err)
 	}
@@ -47,7 +111,7 @@ func (r *RepositoryPostgres) FindAll() (*[]Event, error) {
 	var events []Event
 	for rows.Next() {
 		var e Event
-		if err := rows.Scan(&e.Id, &e.Description, &e.Name, &e.Date); err != nil {
+		if err := scanEvent(rows, &e); err != nil {
 			return nil, fmt.Errorf("event_repository: find all: %w", err)
 		}
 		events = append(events, e)
@@ -60,19 +124,25 @@ func (r *RepositoryPostgres) FindAll() (*[]Event, error) {
 	return &events, nil
 }
 
-func (r *RepositoryPostgres) Insert(e *Event) (*Event, error) {
-	row := r.db.QueryRow(`INSERT INTO events (description, "name", "date") 
-		VALUES ($1, $2, $3) 
-		RETURNING id, description, "name", "date"`,
-		e.Description, e.Name, e.Date)
+func (r *RepositoryPostgres) Insert(ctx context.Context, e *Event) (*Event, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO events (description, "name", "date", end_date, capacity, checkin_opens_at, checkin_closes_at, min_attendance_minutes, series_id, company_id, visibility) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+		RETURNING `+eventColumns,
+		e.Description, e.Name, e.Date, e.EndDate, e.Capacity, e.CheckinOpensAt, e.CheckinClosesAt, e.MinAttendanceMinutes, e.SeriesId, e.CompanyId, e.Visibility.String())
 
 	var newEvent Event
-	if err := row.Scan(&newEvent.Id, &newEvent.Description, &newEvent.Name, &newEvent.Date); err != nil {
+	if err := scanEvent(row, &newEvent); err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == "23505" {
 				return nil, fmt.Errorf("event_repository: insert: %w", ErrUniqueViolation)
 			}
+			if pqErr.Code == "23503" && pqErr.Constraint == "events_event_series_fk" {
+				return nil, fmt.Errorf("event_repository: insert: %w", ErrSeriesNotFound)
+			}
+			if pqErr.Code == "23503" {
+				return nil, fmt.Errorf("event_repository: insert: %w", company.ErrCompanyNotFound)
+			}
 		}
 		return nil, fmt.Errorf("event_repository: insert: %w", err)
 	}
@@ -80,20 +150,26 @@ func (r *RepositoryPostgres) Insert(e *Event) (*Event, error) {
 	return &newEvent, nil
 }
 
-func (r *RepositoryPostgres) Update(e *Event) (*Event, error) {
-	row := r.db.QueryRow(`UPDATE events 
-		SET description = $1, "name" = $2, "date" = $3 
-		WHERE id = $4 
-		RETURNING id, description, "name", "date"`,
-		e.Description, e.Name, e.Date, e.Id)
+func (r *RepositoryPostgres) Update(ctx context.Context, e *Event) (*Event, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE events 
+		SET description = $1, "name" = $2, "date" = $3, end_date = $4, capacity = $5, checkin_opens_at = $6, checkin_closes_at = $7, min_attendance_minutes = $8, company_id = $9, visibility = $10 
+		WHERE id = $11 
+		RETURNING `+eventColumns,
+		e.Description, e.Name, e.Date, e.EndDate, e.Capacity, e.CheckinOpensAt, e.CheckinClosesAt, e.MinAttendanceMinutes, e.CompanyId, e.Visibility.String(), e.Id)
 
 	var updatedEvent Event
-	if err := row.Scan(&updatedEvent.Id, &updatedEvent.Description, &updatedEvent.Name, &updatedEvent.Date); err != nil {
+	if err := scanEvent(row, &updatedEvent); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("event_repository: update: %w", ErrEventNotFound)
+		}
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == "23505" {
 				return nil, fmt.Errorf("event_repository: update: %w", ErrUniqueViolation)
 			}
+			if pqErr.Code == "23503" {
+				return nil, fmt.Errorf("event_repository: update: %w", company.ErrCompanyNotFound)
+			}
 		}
 		return nil, fmt.Errorf("event_repository: update: %w", err)
 	}
@@ -101,8 +177,8 @@ func (r *RepositoryPostgres) Update(e *Event) (*Event, error) {
 	return &updatedEvent, nil
 }
 
-func (r *RepositoryPostgres) DeleteById(id int) error {
-	_, err := r.db.Exec(`DELETE FROM events WHERE id = $1`, id)
+func (r *RepositoryPostgres) DeleteById(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM events WHERE id = $1`, id)
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
@@ -115,8 +191,8 @@ func (r *RepositoryPostgres) DeleteById(id int) error {
 	return nil
 }
 
-func (r *RepositoryPostgres) Exists(id int) (bool, error) {
-	row := r.db.QueryRow(`SELECT COUNT(*) FROM events WHERE id = $1`, id)
+func (r *RepositoryPostgres) Exists(ctx context.Context, id int) (bool, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM events WHERE id = $1`, id)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return false, fmt.Errorf("event_repository: exists: %w", err)
@@ -124,8 +200,25 @@ func (r *RepositoryPostgres) Exists(id int) (bool, error) {
 	return count > 0, nil
 }
 
-func (r *RepositoryPostgres) FindUpcoming() (*[]Event, error) {
-	rows, err := r.db.Query(`SELECT id, description, "name", "date" FROM events WHERE "date" > NOW() ORDER BY "date" ASC`)
+// LockById locks the event until the transaction ends, so checks like the one on
+// capacity before registering don't interleave. Outside a transaction the lock is
+// released right away.
+func (r *RepositoryPostgres) LockById(ctx context.Context, id int) error {
+	row := r.db.QueryRowContext(ctx, `SELECT id FROM events WHERE id = $1 FOR UPDATE`, id)
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("event_repository: lock by id: %w", ErrEventNotFound)
+		}
+		return fmt.Errorf("event_repository: lock by id: %w", err)
+	}
+	return nil
+}
+
+// FindUpcoming returns the events that haven't ended yet, including the ones in
+// progress, that the users of company viewerCompanyId can see. A nil
+// viewerCompanyId returns all of them.
+func (r *RepositoryPostgres) FindUpcoming(ctx context.Context, viewerCompanyId *int) (*[]Event, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+eventColumns+` FROM events WHERE end_date > NOW() AND `+visibleTo("$1::int")+` ORDER BY "date" ASC`, viewerCompanyId)
 	if err != nil {
 		return nil, fmt.Errorf("event_repository: find upcoming: %w", err)
 	}
@@ -134,7 +227,7 @@ func (r *RepositoryPostgres) FindUpcoming() (*[]Event, error) {
 	var events []Event
 	for rows.Next() {
 		var ev Event
-		if err := rows.Scan(&ev.Id, &ev.Description, &ev.Name, &ev.Date); err != nil {
+		if err := scanEvent(rows, &ev); err != nil {
 			return nil, fmt.Errorf("event_repository: find upcoming: %w", err)
 		}
 		events = append(events, ev)
@@ -147,38 +240,396 @@ func (r *RepositoryPostgres) FindUpcoming() (*[]Event, error) {
 	return &events, nil
 }
 
-func (r *RepositoryPostgres) FindCheckedUsers(e *Event) (*[]user.User, error) {
-	rows, err := r.db.Query(`SELECT u.id, u.email, u.company_id, u.name FROM events_users eu JOIN users u ON eu.user_id = u.id WHERE eu.event_id = $1`, e.Id)
+func (r *RepositoryPostgres) InsertSeries(ctx context.Context, series *Series) (*Series, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO event_series ("name", rule) VALUES ($1, $2) RETURNING id, "name", rule`, series.Name, series.Rule)
+
+	var newSeries Series
+	if err := row.Scan(&newSeries.Id, &newSeries.Name, &newSeries.Rule); err != nil {
+		return nil, fmt.Errorf("event_repository: insert series: %w", err)
+	}
+
+	return &newSeries, nil
+}
+
+func (r *RepositoryPostgres) FindSeriesById(ctx context.Context, id int) (*Series, error) {
+	series := &Series{}
+
+	row := r.db.QueryRowContext(ctx, `SELECT id, "name", rule FROM event_series WHERE id = $1`, id)
+	if err := row.Scan(&series.Id, &series.Name, &series.Rule); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("event_repository: find series by id: %w", ErrSeriesNotFound)
+		}
+		return nil, fmt.Errorf("event_repository: find series by id: %w", err)
+	}
+
+	return series, nil
+}
+
+// FindSeriesEvents returns the occurrences of the series starting at or after
+// from that the users of company viewerCompanyId can see, nil returns all of them.
+func (r *RepositoryPostgres) FindSeriesEvents(ctx context.Context, seriesId int, from time.Time, viewerCompanyId *int) (*[]Event, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+eventColumns+` FROM events WHERE series_id = $1 AND "date" >= $2 AND `+visibleTo("$3::int")+` ORDER BY "date" ASC`, seriesId, from, viewerCompanyId)
+	if err != nil {
+		return nil, fmt.Errorf("event_repository: find series events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, fmt.Errorf("event_repository: find series events: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event_repository: find series events: %w", err)
+	}
+
+	return &events, nil
+}
+
+func (r *RepositoryPostgres) DeleteSeriesById(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM event_series WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("event_repository: delete series: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("event_repository: delete series: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event_repository: delete series: %w", ErrSeriesNotFound)
+	}
+
+	return nil
+}
+
+func (r *RepositoryPostgres) FindSessions(ctx context.Context, e *Event) (*[]Session, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, "name", starts_at, ends_at FROM event_sessions WHERE event_id = $1 ORDER BY starts_at ASC, id ASC`, e.Id)
+	if err != nil {
+		return nil, fmt.Errorf("event_repository: find sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.Id, &session.Name, &session.StartsAt, &session.EndsAt); err != nil {
+			return nil, fmt.Errorf("event_repository: find sessions: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event_repository: find sessions: %w", err)
+	}
+
+	return &sessions, nil
+}
+
+// ReplaceSessions deletes the sessions of the event and inserts the given ones.
+func (r *RepositoryPostgres) ReplaceSessions(ctx context.Context, e *Event, sessions []Session) (*[]Session, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM event_sessions WHERE event_id = $1`, e.Id); err != nil {
+		return nil, fmt.Errorf("event_repository: replace sessions: %w", err)
+	}
+
+	newSessions := []Session{}
+	for _, session := range sessions {
+		row := r.db.QueryRowContext(ctx, `INSERT INTO event_sessions (event_id, "name", starts_at, ends_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, "name", starts_at, ends_at`,
+			e.Id, session.Name, session.StartsAt, session.EndsAt)
+
+		var newSession Session
+		if err := row.Scan(&newSession.Id, &newSession.Name, &newSession.StartsAt, &newSession.EndsAt); err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				if pqErr.Code == "23503" {
+					return nil, fmt.Errorf("event_repository: replace sessions: %w", ErrForeignKeyViolation)
+				}
+			}
+			return nil, fmt.Errorf("event_repository: replace sessions: %w", err)
+		}
+		newSessions = append(newSessions, newSession)
+	}
+
+	return &newSessions, nil
+}
+
+// ReplaceCompanies deletes the companies the event is shared with and inserts the given ones.
+func (r *RepositoryPostgres) ReplaceCompanies(ctx context.Context, e *Event, companyIds []int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM event_companies WHERE event_id = $1`, e.Id); err != nil {
+		return fmt.Errorf("event_repository: replace companies: %w", err)
+	}
+
+	for _, companyId := range companyIds {
+		_, err := r.db.ExecContext(ctx, `INSERT INTO event_companies (event_id, company_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, e.Id, companyId)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				if pqErr.Code == "23503" {
+					return fmt.Errorf("event_repository: replace companies: %w", company.ErrCompanyNotFound)
+				}
+			}
+			return fmt.Errorf("event_repository: replace companies: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RepositoryPostgres) FindCheckedUsers(ctx context.Context, e *Event, statuses ...RegistrationStatus) (*[]Registration, error) {
+	filter := pq.StringArray{}
+	for _, s := range statuses {
+		filter = append(filter, s.String())
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT u.id, u.email, u.company_id, u.name, eu.event_id, eu.status, eu.registered_at, eu.cancelled_at, eu.checked_in_at, eu.checked_out_at
+		FROM events_users eu JOIN users u ON eu.user_id = u.id
+		WHERE eu.event_id = $1 AND (cardinality($2::text[]) = 0 OR eu.status = ANY($2::text[]))
+		ORDER BY eu.registered_at ASC, eu.id ASC`, e.Id, filter)
 	if err != nil {
 		return nil, fmt.Errorf("event_repository: find checked users: %w", err)
 	}
+	defer rows.Close()
 
-	var users []user.User
+	var registrations []Registration
 	for rows.Next() {
-		var u user.User
-		if err := rows.Scan(&u.Id, &u.Email, &u.Company.Id, &u.Name); err != nil {
+		reg := Registration{User: &user.User{}}
+		var status string
+		if err := rows.Scan(&reg.User.Id, &reg.User.Email, &reg.User.Company.Id, &reg.User.Name,
+			&reg.EventId, &status, &reg.RegisteredAt, &reg.CancelledAt, &reg.CheckedInAt, &reg.CheckedOutAt); err != nil {
 			return nil, fmt.Errorf("event_repository: find checked users: %w", err)
 		}
-		users = append(users, u)
+		reg.UserId = reg.User.Id
+		reg.Status = RegistrationStatus(status)
+		registrations = append(registrations, reg)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("event_repository: find checked users: %w", err)
 	}
 
-	return &users, nil
+	return &registrations, nil
 }
 
-func (r *RepositoryPostgres) CheckinUser(e *Event, u *user.User) error {
-	_, err := r.db.Exec(`INSERT INTO events_users (user_id, event_id) VALUES ($1, $2)`, u.Id, e.Id)
+// FindRegistrationsByUser lists every registration of the user with its event, ordered by event date.
+// When set, from and to keep only the events that overlap that range.
+func (r *RepositoryPostgres) FindRegistrationsByUser(ctx context.Context, u *user.User, from, to *time.Time) (*[]Registration, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT eu.status, eu.registered_at, eu.cancelled_at, eu.checked_in_at, eu.checked_out_at, ev.*
+		FROM events_users eu
+		JOIN LATERAL (SELECT `+eventColumns+` FROM events WHERE id = eu.event_id) ev ON true
+		WHERE eu.user_id = $1
+		AND ($2::timestamptz IS NULL OR ev.end_date > $2)
+		AND ($3::timestamptz IS NULL OR ev."date" < $3)
+		ORDER BY ev."date" ASC, ev.id ASC`, u.Id, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("event_repository: find registrations by user: %w", err)
+	}
+	defer rows.Close()
+
+	registrations := []Registration{}
+	for rows.Next() {
+		reg := Registration{UserId: u.Id, Event: &Event{}}
+		var status string
+		dest := append([]any{&status, &reg.RegisteredAt, &reg.CancelledAt, &reg.CheckedInAt, &reg.CheckedOutAt}, eventFields(reg.Event)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("event_repository: find registrations by user: %w", err)
+		}
+		reg.EventId = reg.Event.Id
+		reg.Status = RegistrationStatus(status)
+		registrations = append(registrations, reg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event_repository: find registrations by user: %w", err)
+	}
+
+	return &registrations, nil
+}
+
+// Register creates a registration for the user, or reactivates a cancelled one.
+func (r *RepositoryPostgres) Register(ctx context.Context, e *Event, u *user.User) error {
+	res, err := r.db.ExecContext(ctx, `INSERT INTO events_users (user_id, event_id, status, registered_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, event_id) DO UPDATE
+		SET status = EXCLUDED.status, registered_at = EXCLUDED.registered_at, cancelled_at = NULL, checked_in_at = NULL, checked_out_at = NULL
+		WHERE events_users.status = $4`,
+		u.Id, e.Id, STATUS_REGISTERED.String(), STATUS_CANCELLED.String())
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
-			if pqErr.Code == "23505" {
-				return fmt.Errorf("event_repository: checkin user: %w", ErrUniqueViolation)
+			if pqErr.Code == "23503" {
+				return fmt.Errorf("event_repository: register: %w", ErrForeignKeyViolation)
 			}
 		}
+		return fmt.Errorf("event_repository: register: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("event_repository: register: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event_repository: register: %w", ErrUniqueViolation)
+	}
+
+	return nil
+}
+
+func (r *RepositoryPostgres) FindRegistration(ctx context.Context, e *Event, u *user.User) (*Registration, error) {
+	reg := &Registration{UserId: u.Id, User: u}
+	var status string
+
+	row := r.db.QueryRowContext(ctx, `SELECT event_id, status, registered_at, cancelled_at, checked_in_at, checked_out_at
+		FROM events_users WHERE event_id = $1 AND user_id = $2`, e.Id, u.Id)
+	if err := row.Scan(&reg.EventId, &status, &reg.RegisteredAt, &reg.CancelledAt, &reg.CheckedInAt, &reg.CheckedOutAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("event_repository: find registration: %w", ErrRegistrationNotFound)
+		}
+		return nil, fmt.Errorf("event_repository: find registration: %w", err)
+	}
+	reg.Status = RegistrationStatus(status)
+
+	return reg, nil
+}
+
+func (r *RepositoryPostgres) UpdateRegistration(ctx context.Context, reg *Registration) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE events_users
+		SET status = $1, cancelled_at = $2, checked_in_at = $3, checked_out_at = $4
+		WHERE event_id = $5 AND user_id = $6`,
+		reg.Status.String(), reg.CancelledAt, reg.CheckedInAt, reg.CheckedOutAt, reg.EventId, reg.UserId)
+	if err != nil {
+		return fmt.Errorf("event_repository: update registration: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("event_repository: update registration: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event_repository: update registration: %w", ErrRegistrationNotFound)
+	}
+
+	return nil
+}
+
+// CheckinUser saves the check-in of reg, as long as the event is still visible
+// to the company of the registered user. It can have changed since they registered.
+func (r *RepositoryPostgres) CheckinUser(ctx context.Context, reg *Registration) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE events_users
+		SET status = $1, checked_in_at = $2
+		FROM events, users u
+		WHERE events_users.event_id = $3 AND events_users.user_id = $4
+		AND events.id = events_users.event_id AND u.id = events_users.user_id
+		AND `+visibleTo("u.company_id"),
+		reg.Status.String(), reg.CheckedInAt, reg.EventId, reg.UserId)
+	if err != nil {
 		return fmt.Errorf("event_repository: checkin user: %w", err)
 	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("event_repository: checkin user: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event_repository: checkin user: %w", ErrEventNotVisible)
+	}
+
 	return nil
 }
+
+// CountActiveRegistrations counts the registrations that hold a seat, that is every one not cancelled.
+func (r *RepositoryPostgres) CountActiveRegistrations(ctx context.Context, e *Event) (int, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM events_users WHERE event_id = $1 AND status <> $2`, e.Id, STATUS_CANCELLED.String())
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, fmt.Errorf("event_repository: count active registrations: %w", err)
+	}
+	return count, nil
+}
+
+func (r *RepositoryPostgres) AddToWaitlist(ctx context.Context, e *Event, u *user.User) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO events_waitlist (user_id, event_id) VALUES ($1, $2)`, u.Id, e.Id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			if pqErr.Code == "23505" {
+				return fmt.Errorf("event_repository: add to waitlist: %w", ErrUniqueViolation)
+			}
+			if pqErr.Code == "23503" {
+				return fmt.Errorf("event_repository: add to waitlist: %w", ErrForeignKeyViolation)
+			}
+		}
+		return fmt.Errorf("event_repository: add to waitlist: %w", err)
+	}
+	return nil
+}
+
+func (r *RepositoryPostgres) RemoveFromWaitlist(ctx context.Context, e *Event, u *user.User) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM events_waitlist WHERE event_id = $1 AND user_id = $2`, e.Id, u.Id)
+	if err != nil {
+		return fmt.Errorf("event_repository: remove from waitlist: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("event_repository: remove from waitlist: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("event_repository: remove from waitlist: %w", ErrRegistrationNotFound)
+	}
+
+	return nil
+}
+
+// PopWaitlist removes the oldest waitlist entry of the event and returns its user id.
+func (r *RepositoryPostgres) PopWaitlist(ctx context.Context, e *Event) (int, error) {
+	row := r.db.QueryRowContext(ctx, `DELETE FROM events_waitlist WHERE id = (
+			SELECT id FROM events_waitlist WHERE event_id = $1 ORDER BY created_at ASC, id ASC LIMIT 1
+		) RETURNING user_id`, e.Id)
+
+	var userId int
+	if err := row.Scan(&userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("event_repository: pop waitlist: %w", ErrWaitlistEmpty)
+		}
+		return 0, fmt.Errorf("event_repository: pop waitlist: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (r *RepositoryPostgres) FindWaitlist(ctx context.Context, e *Event) (*[]user.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT u.id, u.email, u.company_id, u.name FROM events_waitlist ew
+		JOIN users u ON ew.user_id = u.id
+		WHERE ew.event_id = $1
+		ORDER BY ew.created_at ASC, ew.id ASC`, e.Id)
+	if err != nil {
+		return nil, fmt.Errorf("event_repository: find waitlist: %w", err)
+	}
+	defer rows.Close()
+
+	var users []user.User
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.Id, &u.Email, &u.Company.Id, &u.Name); err != nil {
+			return nil, fmt.Errorf("event_repository: find waitlist: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event_repository: find waitlist: %w", err)
+	}
+
+	return &users, nil
+}
@@ -0,0 +1,591 @@
+package event
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db/dbtest"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+func TestRepositoryMemory(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, user.Repository, company.Repository) {
+		companies := company.NewRepositoryMemory()
+		users := user.NewRepositoryMemory(companies)
+		return NewRepositoryMemory(users, companies), users, companies
+	})
+}
+
+func TestRepositoryPostgres(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, user.Repository, company.Repository) {
+		conn := dbtest.Open(t)
+		return NewRepositoryPostgres(conn), user.NewRepositoryPostgres(conn), company.NewRepositoryPostgres(conn)
+	})
+}
+
+// fixture holds the rows most tests start from: two companies with a user each.
+type fixture struct {
+	repo           Repository
+	users          user.Repository
+	companies      company.Repository
+	acme, other    *company.Company
+	ana, caio      *user.User
+	tomorrow, week time.Time
+}
+
+// newEvent returns an unsaved public event starting at start.
+func newEvent(name string, start time.Time) *Event {
+	e := &Event{Name: name, Description: name + " description", Date: start, EndDate: start.Add(2 * time.Hour)}
+	e.setDefaults()
+	return e
+}
+
+// testRepository checks the behaviour every Repository implementation must share.
+// newRepos returns an empty one along with the user and company repositories it references.
+func testRepository(t *testing.T, newRepos func(t *testing.T) (Repository, user.Repository, company.Repository)) {
+	ctx := t.Context()
+
+	setup := func(t *testing.T) *fixture {
+		t.Helper()
+
+		f := &fixture{}
+		f.repo, f.users, f.companies = newRepos(t)
+
+		var err error
+		if f.acme, err = f.companies.Insert(ctx, &company.Company{Name: "Acme"}); err != nil {
+			t.Fatalf("insert company: %v", err)
+		}
+		f.other, _ = f.companies.Insert(ctx, &company.Company{Name: "Other"})
+
+		if f.ana, err = f.users.Insert(ctx, &user.User{Email: "ana@acme.com", Name: "Ana", Company: *f.acme}); err != nil {
+			t.Fatalf("insert user: %v", err)
+		}
+		f.caio, _ = f.users.Insert(ctx, &user.User{Email: "caio@other.com", Name: "Caio", Company: *f.other})
+
+		// Postgres keeps microseconds.
+		now := time.Now().Truncate(time.Microsecond)
+		f.tomorrow = now.Add(24 * time.Hour)
+		f.week = now.Add(7 * 24 * time.Hour)
+		return f
+	}
+
+	insert := func(t *testing.T, f *fixture, e *Event) *Event {
+		t.Helper()
+
+		created, err := f.repo.Insert(ctx, e)
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		return created
+	}
+
+	t.Run("insert and find", func(t *testing.T) {
+		f := setup(t)
+
+		opens := f.tomorrow.Add(-30 * time.Minute)
+		e := newEvent("Kickoff", f.tomorrow)
+		e.Capacity = 10
+		e.MinAttendanceMinutes = 30
+		e.CheckinOpensAt = &opens
+		e.CompanyId = &f.acme.Id
+		e.Visibility = VISIBILITY_COMPANY
+
+		created := insert(t, f, e)
+		if created.Id == 0 || created.Companies == nil {
+			t.Fatalf("Insert returned %+v", created)
+		}
+
+		found, err := f.repo.FindById(ctx, created.Id, nil)
+		if err != nil {
+			t.Fatalf("FindById: %v", err)
+		}
+		if found.Name != "Kickoff" || found.Description != e.Description || !found.Date.Equal(e.Date) || !found.EndDate.Equal(e.EndDate) ||
+			found.Capacity != 10 || found.MinAttendanceMinutes != 30 || found.CheckinOpensAt == nil || !found.CheckinOpensAt.Equal(opens) ||
+			found.CheckinClosesAt != nil || found.SeriesId != nil || found.CompanyId == nil || *found.CompanyId != f.acme.Id ||
+			found.Visibility != VISIBILITY_COMPANY || len(found.Companies) != 0 {
+			t.Errorf("FindById returned %+v", found)
+		}
+
+		if exists, err := f.repo.Exists(ctx, created.Id); err != nil || !exists {
+			t.Errorf("Exists = %v, %v, want true", exists, err)
+		}
+		if err := f.repo.LockById(ctx, created.Id); err != nil {
+			t.Errorf("LockById: %v", err)
+		}
+
+		all, _ := f.repo.FindAll(ctx)
+		if len(*all) != 1 {
+			t.Errorf("FindAll returned %d events", len(*all))
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		f := setup(t)
+
+		if _, err := f.repo.FindById(ctx, 404, nil); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("FindById error = %v, want ErrEventNotFound", err)
+		}
+		missing := newEvent("Missing", f.tomorrow)
+		missing.Id = 404
+		if _, err := f.repo.Update(ctx, missing); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("Update error = %v, want ErrEventNotFound", err)
+		}
+		if exists, err := f.repo.Exists(ctx, 404); err != nil || exists {
+			t.Errorf("Exists = %v, %v, want false", exists, err)
+		}
+		if err := f.repo.LockById(ctx, 404); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("LockById error = %v, want ErrEventNotFound", err)
+		}
+		if _, err := f.repo.FindSeriesById(ctx, 404); !errors.Is(err, ErrSeriesNotFound) {
+			t.Errorf("FindSeriesById error = %v, want ErrSeriesNotFound", err)
+		}
+		if err := f.repo.DeleteSeriesById(ctx, 404); !errors.Is(err, ErrSeriesNotFound) {
+			t.Errorf("DeleteSeriesById error = %v, want ErrSeriesNotFound", err)
+		}
+		if _, err := f.repo.FindRegistration(ctx, missing, f.ana); !errors.Is(err, ErrRegistrationNotFound) {
+			t.Errorf("FindRegistration error = %v, want ErrRegistrationNotFound", err)
+		}
+		if err := f.repo.UpdateRegistration(ctx, &Registration{EventId: 404, UserId: f.ana.Id, Status: STATUS_CANCELLED}); !errors.Is(err, ErrRegistrationNotFound) {
+			t.Errorf("UpdateRegistration error = %v, want ErrRegistrationNotFound", err)
+		}
+		if err := f.repo.RemoveFromWaitlist(ctx, missing, f.ana); !errors.Is(err, ErrRegistrationNotFound) {
+			t.Errorf("RemoveFromWaitlist error = %v, want ErrRegistrationNotFound", err)
+		}
+		if _, err := f.repo.PopWaitlist(ctx, missing); !errors.Is(err, ErrWaitlistEmpty) {
+			t.Errorf("PopWaitlist error = %v, want ErrWaitlistEmpty", err)
+		}
+		if err := f.repo.DeleteById(ctx, 404); err != nil {
+			t.Errorf("DeleteById of a missing event: %v", err)
+		}
+	})
+
+	t.Run("foreign keys", func(t *testing.T) {
+		f := setup(t)
+
+		missingCompany := 404
+		e := newEvent("Orphan", f.tomorrow)
+		e.CompanyId = &missingCompany
+		e.Visibility = VISIBILITY_COMPANY
+		if _, err := f.repo.Insert(ctx, e); !errors.Is(err, company.ErrCompanyNotFound) {
+			t.Errorf("Insert with a missing company: error = %v, want ErrCompanyNotFound", err)
+		}
+
+		missingSeries := 404
+		e = newEvent("Orphan", f.tomorrow)
+		e.SeriesId = &missingSeries
+		if _, err := f.repo.Insert(ctx, e); !errors.Is(err, ErrSeriesNotFound) {
+			t.Errorf("Insert with a missing series: error = %v, want ErrSeriesNotFound", err)
+		}
+
+		created := insert(t, f, newEvent("Real", f.tomorrow))
+		created.CompanyId = &missingCompany
+		created.Visibility = VISIBILITY_COMPANY
+		if _, err := f.repo.Update(ctx, created); !errors.Is(err, company.ErrCompanyNotFound) {
+			t.Errorf("Update with a missing company: error = %v, want ErrCompanyNotFound", err)
+		}
+
+		if err := f.repo.ReplaceCompanies(ctx, created, []int{missingCompany}); !errors.Is(err, company.ErrCompanyNotFound) {
+			t.Errorf("ReplaceCompanies with a missing company: error = %v, want ErrCompanyNotFound", err)
+		}
+
+		ghost := &user.User{Id: 404}
+		if err := f.repo.Register(ctx, created, ghost); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Register of a missing user: error = %v, want ErrForeignKeyViolation", err)
+		}
+		if err := f.repo.AddToWaitlist(ctx, created, ghost); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("AddToWaitlist of a missing user: error = %v, want ErrForeignKeyViolation", err)
+		}
+
+		// Events hold on to their company.
+		owned := newEvent("Owned", f.tomorrow)
+		owned.CompanyId = &f.other.Id
+		owned.Visibility = VISIBILITY_COMPANY
+		insert(t, f, owned)
+		f.users.DeleteById(ctx, f.caio.Id)
+		if err := f.companies.DeleteById(ctx, f.other.Id); !errors.Is(err, company.ErrForeignKeyViolation) {
+			t.Errorf("deleting a company with events: error = %v, want ErrForeignKeyViolation", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		f := setup(t)
+
+		created := insert(t, f, newEvent("Before", f.tomorrow))
+		created.Name = "After"
+		created.Date = f.week
+		created.EndDate = f.week.Add(time.Hour)
+		created.CompanyId = &f.acme.Id
+		created.Visibility = VISIBILITY_SELECTED
+
+		updated, err := f.repo.Update(ctx, created)
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if updated.Name != "After" || !updated.Date.Equal(f.week) || updated.Visibility != VISIBILITY_SELECTED || *updated.CompanyId != f.acme.Id {
+			t.Errorf("Update returned %+v", updated)
+		}
+
+		if err := f.repo.ReplaceCompanies(ctx, created, []int{f.other.Id, f.acme.Id}); err != nil {
+			t.Fatalf("ReplaceCompanies: %v", err)
+		}
+		found, _ := f.repo.FindById(ctx, created.Id, nil)
+		if !slices.Equal(found.Companies, []int{f.acme.Id, f.other.Id}) {
+			t.Errorf("companies = %v, want them sorted", found.Companies)
+		}
+
+		if err := f.repo.ReplaceCompanies(ctx, created, nil); err != nil {
+			t.Fatalf("ReplaceCompanies: %v", err)
+		}
+		found, _ = f.repo.FindById(ctx, created.Id, nil)
+		if len(found.Companies) != 0 {
+			t.Errorf("companies = %v, want none", found.Companies)
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		f := setup(t)
+
+		public := insert(t, f, newEvent("Public", f.tomorrow))
+
+		own := newEvent("Own", f.tomorrow.Add(time.Hour))
+		own.CompanyId = &f.acme.Id
+		own.Visibility = VISIBILITY_COMPANY
+		own = insert(t, f, own)
+
+		selected := newEvent("Selected", f.tomorrow.Add(2*time.Hour))
+		selected.CompanyId = &f.acme.Id
+		selected.Visibility = VISIBILITY_SELECTED
+		selected = insert(t, f, selected)
+
+		if _, err := f.repo.FindById(ctx, public.Id, &f.other.Id); err != nil {
+			t.Errorf("public event hidden: %v", err)
+		}
+		if _, err := f.repo.FindById(ctx, own.Id, &f.other.Id); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("company event of another company: error = %v, want ErrEventNotFound", err)
+		}
+		if _, err := f.repo.FindById(ctx, own.Id, &f.acme.Id); err != nil {
+			t.Errorf("company event hidden from its company: %v", err)
+		}
+
+		names := func(viewer *int) []string {
+			events, err := f.repo.FindUpcoming(ctx, viewer)
+			if err != nil {
+				t.Fatalf("FindUpcoming: %v", err)
+			}
+			var names []string
+			for _, e := range *events {
+				names = append(names, e.Name)
+			}
+			return names
+		}
+
+		if got := names(&f.other.Id); !slices.Equal(got, []string{"Public"}) {
+			t.Errorf("upcoming for another company = %v", got)
+		}
+
+		f.repo.ReplaceCompanies(ctx, selected, []int{f.other.Id})
+		if got := names(&f.other.Id); !slices.Equal(got, []string{"Public", "Selected"}) {
+			t.Errorf("upcoming for a selected company = %v", got)
+		}
+		if got := names(nil); !slices.Equal(got, []string{"Public", "Own", "Selected"}) {
+			t.Errorf("upcoming for everyone = %v", got)
+		}
+	})
+
+	t.Run("upcoming", func(t *testing.T) {
+		f := setup(t)
+
+		past := newEvent("Past", f.tomorrow.Add(-72*time.Hour))
+		insert(t, f, past)
+		insert(t, f, newEvent("Later", f.week))
+		insert(t, f, newEvent("Sooner", f.tomorrow))
+
+		events, _ := f.repo.FindUpcoming(ctx, nil)
+		if len(*events) != 2 || (*events)[0].Name != "Sooner" || (*events)[1].Name != "Later" {
+			t.Errorf("FindUpcoming returned %+v", *events)
+		}
+	})
+
+	t.Run("series", func(t *testing.T) {
+		f := setup(t)
+
+		series, err := f.repo.InsertSeries(ctx, &Series{Name: "Weekly", Rule: "FREQ=WEEKLY;COUNT=2"})
+		if err != nil {
+			t.Fatalf("InsertSeries: %v", err)
+		}
+
+		found, err := f.repo.FindSeriesById(ctx, series.Id)
+		if err != nil || found.Name != "Weekly" || found.Rule != series.Rule {
+			t.Errorf("FindSeriesById = %+v, %v", found, err)
+		}
+
+		var occurrences []*Event
+		for _, start := range []time.Time{f.week, f.tomorrow} {
+			e := newEvent("Weekly", start)
+			e.SeriesId = &series.Id
+			occurrences = append(occurrences, insert(t, f, e))
+		}
+
+		events, _ := f.repo.FindSeriesEvents(ctx, series.Id, f.tomorrow, nil)
+		if len(*events) != 2 || !(*events)[0].Date.Equal(f.tomorrow) {
+			t.Errorf("FindSeriesEvents returned %+v", *events)
+		}
+
+		events, _ = f.repo.FindSeriesEvents(ctx, series.Id, f.tomorrow.Add(time.Second), nil)
+		if len(*events) != 1 || (*events)[0].Id != occurrences[0].Id {
+			t.Errorf("FindSeriesEvents from the second occurrence returned %+v", *events)
+		}
+
+		// The series of an event can't be changed by an update.
+		occurrences[0].SeriesId = nil
+		updated, err := f.repo.Update(ctx, occurrences[0])
+		if err != nil || updated.SeriesId == nil {
+			t.Errorf("Update = %+v, %v, want the series kept", updated, err)
+		}
+
+		if err := f.repo.DeleteSeriesById(ctx, series.Id); err != nil {
+			t.Fatalf("DeleteSeriesById: %v", err)
+		}
+		for _, e := range occurrences {
+			if exists, _ := f.repo.Exists(ctx, e.Id); exists {
+				t.Errorf("occurrence %d outlived its series", e.Id)
+			}
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		f := setup(t)
+
+		e := insert(t, f, newEvent("Conference", f.tomorrow))
+		second := Session{Name: "Day 2", StartsAt: f.tomorrow.Add(time.Hour), EndsAt: f.tomorrow.Add(2 * time.Hour)}
+		first := Session{Name: "Day 1", StartsAt: f.tomorrow, EndsAt: f.tomorrow.Add(time.Hour)}
+
+		created, err := f.repo.ReplaceSessions(ctx, e, []Session{second, first})
+		if err != nil {
+			t.Fatalf("ReplaceSessions: %v", err)
+		}
+		if len(*created) != 2 || (*created)[0].Name != "Day 2" || (*created)[0].Id == 0 {
+			t.Errorf("ReplaceSessions returned %+v", *created)
+		}
+
+		sessions, _ := f.repo.FindSessions(ctx, e)
+		if len(*sessions) != 2 || (*sessions)[0].Name != "Day 1" || !(*sessions)[0].StartsAt.Equal(first.StartsAt) {
+			t.Errorf("FindSessions returned %+v, want them by start", *sessions)
+		}
+
+		f.repo.ReplaceSessions(ctx, e, nil)
+		sessions, _ = f.repo.FindSessions(ctx, e)
+		if sessions == nil || len(*sessions) != 0 {
+			t.Errorf("FindSessions after clearing returned %+v", sessions)
+		}
+
+		missing := &Event{Id: 404}
+		if _, err := f.repo.ReplaceSessions(ctx, missing, []Session{first}); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("ReplaceSessions of a missing event: error = %v, want ErrForeignKeyViolation", err)
+		}
+	})
+
+	t.Run("registrations", func(t *testing.T) {
+		f := setup(t)
+
+		e := insert(t, f, newEvent("Training", f.tomorrow))
+		if err := f.repo.Register(ctx, e, f.ana); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if err := f.repo.Register(ctx, e, f.ana); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("registering twice: error = %v, want ErrUniqueViolation", err)
+		}
+		if err := f.repo.Register(ctx, e, f.caio); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+
+		reg, err := f.repo.FindRegistration(ctx, e, f.ana)
+		if err != nil {
+			t.Fatalf("FindRegistration: %v", err)
+		}
+		if reg.Status != STATUS_REGISTERED || reg.EventId != e.Id || reg.UserId != f.ana.Id || reg.User != f.ana || reg.RegisteredAt.IsZero() {
+			t.Errorf("FindRegistration returned %+v", reg)
+		}
+
+		if count, _ := f.repo.CountActiveRegistrations(ctx, e); count != 2 {
+			t.Errorf("CountActiveRegistrations = %d, want 2", count)
+		}
+
+		cancelledAt := time.Now().Truncate(time.Microsecond)
+		reg.Status = STATUS_CANCELLED
+		reg.CancelledAt = &cancelledAt
+		if err := f.repo.UpdateRegistration(ctx, reg); err != nil {
+			t.Fatalf("UpdateRegistration: %v", err)
+		}
+		if count, _ := f.repo.CountActiveRegistrations(ctx, e); count != 1 {
+			t.Errorf("CountActiveRegistrations after cancelling = %d, want 1", count)
+		}
+
+		cancelled, _ := f.repo.FindCheckedUsers(ctx, e, STATUS_CANCELLED)
+		if len(*cancelled) != 1 || (*cancelled)[0].User.Email != "ana@acme.com" || !(*cancelled)[0].CancelledAt.Equal(cancelledAt) {
+			t.Errorf("FindCheckedUsers(CANCELLED) returned %+v", *cancelled)
+		}
+
+		// A cancelled registration can be taken again, from scratch.
+		if err := f.repo.Register(ctx, e, f.ana); err != nil {
+			t.Fatalf("registering again after cancelling: %v", err)
+		}
+		reg, _ = f.repo.FindRegistration(ctx, e, f.ana)
+		if reg.Status != STATUS_REGISTERED || reg.CancelledAt != nil {
+			t.Errorf("registration after registering again = %+v", reg)
+		}
+
+		all, _ := f.repo.FindCheckedUsers(ctx, e)
+		if len(*all) != 2 || (*all)[0].User.Name != "Caio" || (*all)[0].User.Company.Id != f.other.Id || (*all)[0].UserId != f.caio.Id {
+			t.Errorf("FindCheckedUsers returned %+v, want them by registration", *all)
+		}
+
+		// Deleting a user deletes their registrations.
+		f.users.DeleteById(ctx, f.caio.Id)
+		if count, _ := f.repo.CountActiveRegistrations(ctx, e); count != 1 {
+			t.Errorf("CountActiveRegistrations after deleting a user = %d, want 1", count)
+		}
+	})
+
+	t.Run("registrations by user", func(t *testing.T) {
+		f := setup(t)
+
+		later := insert(t, f, newEvent("Later", f.week))
+		sooner := insert(t, f, newEvent("Sooner", f.tomorrow))
+		f.repo.Register(ctx, later, f.ana)
+		f.repo.Register(ctx, sooner, f.ana)
+		f.repo.Register(ctx, sooner, f.caio)
+
+		regs, err := f.repo.FindRegistrationsByUser(ctx, f.ana, nil, nil)
+		if err != nil {
+			t.Fatalf("FindRegistrationsByUser: %v", err)
+		}
+		if len(*regs) != 2 || (*regs)[0].Event.Name != "Sooner" || (*regs)[0].EventId != sooner.Id || (*regs)[0].UserId != f.ana.Id {
+			t.Errorf("FindRegistrationsByUser returned %+v", *regs)
+		}
+
+		from := f.tomorrow.Add(3 * time.Hour)
+		regs, _ = f.repo.FindRegistrationsByUser(ctx, f.ana, &from, nil)
+		if len(*regs) != 1 || (*regs)[0].Event.Name != "Later" {
+			t.Errorf("FindRegistrationsByUser from %v returned %+v", from, *regs)
+		}
+
+		to := f.tomorrow.Add(time.Hour)
+		regs, _ = f.repo.FindRegistrationsByUser(ctx, f.ana, nil, &to)
+		if len(*regs) != 1 || (*regs)[0].Event.Name != "Sooner" {
+			t.Errorf("FindRegistrationsByUser to %v returned %+v", to, *regs)
+		}
+
+		regs, _ = f.repo.FindRegistrationsByUser(ctx, &user.User{Id: 404}, nil, nil)
+		if regs == nil || len(*regs) != 0 {
+			t.Errorf("FindRegistrationsByUser of nobody returned %+v", regs)
+		}
+	})
+
+	t.Run("checkin", func(t *testing.T) {
+		f := setup(t)
+
+		e := newEvent("Selected", f.tomorrow)
+		e.CompanyId = &f.acme.Id
+		e.Visibility = VISIBILITY_SELECTED
+		e = insert(t, f, e)
+		f.repo.ReplaceCompanies(ctx, e, []int{f.other.Id})
+		f.repo.Register(ctx, e, f.ana)
+		f.repo.Register(ctx, e, f.caio)
+
+		checkedIn := f.tomorrow.Add(5 * time.Minute)
+		reg := &Registration{EventId: e.Id, UserId: f.ana.Id, Status: STATUS_ATTENDED, CheckedInAt: &checkedIn}
+		if err := f.repo.CheckinUser(ctx, reg); err != nil {
+			t.Fatalf("CheckinUser: %v", err)
+		}
+
+		found, _ := f.repo.FindRegistration(ctx, e, f.ana)
+		if found.Status != STATUS_ATTENDED || found.CheckedInAt == nil || !found.CheckedInAt.Equal(checkedIn) {
+			t.Errorf("registration after check-in = %+v", found)
+		}
+
+		// The event stopped being shared with the company of Caio after he registered.
+		f.repo.ReplaceCompanies(ctx, e, nil)
+		reg = &Registration{EventId: e.Id, UserId: f.caio.Id, Status: STATUS_ATTENDED, CheckedInAt: &checkedIn}
+		if err := f.repo.CheckinUser(ctx, reg); !errors.Is(err, ErrEventNotVisible) {
+			t.Errorf("CheckinUser of a company that lost access: error = %v, want ErrEventNotVisible", err)
+		}
+
+		reg = &Registration{EventId: e.Id, UserId: 404, Status: STATUS_ATTENDED, CheckedInAt: &checkedIn}
+		if err := f.repo.CheckinUser(ctx, reg); !errors.Is(err, ErrEventNotVisible) {
+			t.Errorf("CheckinUser without a registration: error = %v, want ErrEventNotVisible", err)
+		}
+	})
+
+	t.Run("waitlist", func(t *testing.T) {
+		f := setup(t)
+
+		e := insert(t, f, newEvent("Full", f.tomorrow))
+		if err := f.repo.AddToWaitlist(ctx, e, f.caio); err != nil {
+			t.Fatalf("AddToWaitlist: %v", err)
+		}
+		if err := f.repo.AddToWaitlist(ctx, e, f.ana); err != nil {
+			t.Fatalf("AddToWaitlist: %v", err)
+		}
+		if err := f.repo.AddToWaitlist(ctx, e, f.ana); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("joining the waitlist twice: error = %v, want ErrUniqueViolation", err)
+		}
+
+		waitlist, _ := f.repo.FindWaitlist(ctx, e)
+		if len(*waitlist) != 2 || (*waitlist)[0].Email != "caio@other.com" || (*waitlist)[1].Company.Id != f.acme.Id {
+			t.Errorf("FindWaitlist returned %+v", *waitlist)
+		}
+
+		userId, err := f.repo.PopWaitlist(ctx, e)
+		if err != nil || userId != f.caio.Id {
+			t.Errorf("PopWaitlist = %d, %v, want the oldest entry", userId, err)
+		}
+
+		if err := f.repo.RemoveFromWaitlist(ctx, e, f.ana); err != nil {
+			t.Fatalf("RemoveFromWaitlist: %v", err)
+		}
+		if _, err := f.repo.PopWaitlist(ctx, e); !errors.Is(err, ErrWaitlistEmpty) {
+			t.Errorf("PopWaitlist of an empty waitlist: error = %v, want ErrWaitlistEmpty", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		f := setup(t)
+
+		e := newEvent("Doomed", f.tomorrow)
+		e.CompanyId = &f.acme.Id
+		e.Visibility = VISIBILITY_SELECTED
+		e = insert(t, f, e)
+		f.repo.ReplaceCompanies(ctx, e, []int{f.other.Id})
+		f.repo.ReplaceSessions(ctx, e, []Session{{Name: "Only", StartsAt: f.tomorrow, EndsAt: f.tomorrow.Add(time.Hour)}})
+		f.repo.Register(ctx, e, f.ana)
+		f.repo.AddToWaitlist(ctx, e, f.caio)
+
+		if err := f.repo.DeleteById(ctx, e.Id); err != nil {
+			t.Fatalf("DeleteById: %v", err)
+		}
+
+		if _, err := f.repo.FindById(ctx, e.Id, nil); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("FindById after delete: error = %v, want ErrEventNotFound", err)
+		}
+		if _, err := f.repo.FindRegistration(ctx, e, f.ana); !errors.Is(err, ErrRegistrationNotFound) {
+			t.Errorf("registration outlived its event: %v", err)
+		}
+		if _, err := f.repo.PopWaitlist(ctx, e); !errors.Is(err, ErrWaitlistEmpty) {
+			t.Errorf("waitlist outlived its event: %v", err)
+		}
+		sessions, _ := f.repo.FindSessions(ctx, e)
+		if len(*sessions) != 0 {
+			t.Errorf("sessions outlived their event: %+v", *sessions)
+		}
+
+		// With the event gone its company can be deleted, once it has no users.
+		f.users.DeleteById(ctx, f.ana.Id)
+		if err := f.companies.DeleteById(ctx, f.acme.Id); err != nil {
+			t.Errorf("deleting a company without events: %v", err)
+		}
+	})
+}
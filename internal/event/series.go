@@ -0,0 +1,55 @@
+package event
+
+import "time"
+
+// Series groups the events created from one recurrence rule.
+type Series struct {
+	Id     int     `json:"id"`
+	Name   string  `json:"name"`
+	Rule   string  `json:"rule"`
+	Events []Event `json:"events"`
+}
+
+// shifted returns a copy of the event with every timestamp moved by d.
+func (e Event) shifted(d time.Duration) *Event {
+	e.Date = e.Date.Add(d)
+	e.EndDate = e.EndDate.Add(d)
+	e.CheckinOpensAt = shiftTime(e.CheckinOpensAt, d)
+	e.CheckinClosesAt = shiftTime(e.CheckinClosesAt, d)
+
+	sessions := make([]Session, len(e.Sessions))
+	for i, s := range e.Sessions {
+		sessions[i] = Session{Name: s.Name, StartsAt: s.StartsAt.Add(d), EndsAt: s.EndsAt.Add(d)}
+	}
+	e.Sessions = sessions
+
+	return &e
+}
+
+// shifted returns a copy of the patch with every timestamp moved by d, so a patch
+// written for one occurrence can be applied to another one of the series.
+func (p EventPatch) shifted(d time.Duration) *EventPatch {
+	p.Date = shiftTime(p.Date, d)
+	p.EndDate = shiftTime(p.EndDate, d)
+	p.CheckinOpensAt = shiftTime(p.CheckinOpensAt, d)
+	p.CheckinClosesAt = shiftTime(p.CheckinClosesAt, d)
+
+	if p.Sessions != nil {
+		sessions := make([]Session, len(*p.Sessions))
+		for i, s := range *p.Sessions {
+			sessions[i] = Session{Name: s.Name, StartsAt: s.StartsAt.Add(d), EndsAt: s.EndsAt.Add(d)}
+		}
+		p.Sessions = &sessions
+	}
+
+	return &p
+}
+
+func shiftTime(t *time.Time, d time.Duration) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	shifted := t.Add(d)
+	return &shifted
+}
@@ -1,60 +1,174 @@
 package event
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/db"
 	"github.com/mthsgimenez/participe/internal/user"
 )
 
 type Repository interface {
-	FindById(id int) (*Event, error)
-	FindAll() (*[]Event, error)
-	Insert(e *Event) (*Event, error)
-	Update(e *Event) (*Event, error)
-	DeleteById(id int) error
-	Exists(id int) (bool, error)
-	FindUpcoming() (*[]Event, error)
-	CheckinUser(e *Event, u *user.User) error
-	FindCheckedUsers(e *Event) (*[]user.User, error)
+	FindById(ctx context.Context, id int, viewerCompanyId *int) (*Event, error)
+	FindAll(ctx context.Context) (*[]Event, error)
+	Insert(ctx context.Context, e *Event) (*Event, error)
+	Update(ctx context.Context, e *Event) (*Event, error)
+	DeleteById(ctx context.Context, id int) error
+	Exists(ctx context.Context, id int) (bool, error)
+	LockById(ctx context.Context, id int) error
+	FindUpcoming(ctx context.Context, viewerCompanyId *int) (*[]Event, error)
+	InsertSeries(ctx context.Context, series *Series) (*Series, error)
+	FindSeriesById(ctx context.Context, id int) (*Series, error)
+	FindSeriesEvents(ctx context.Context, seriesId int, from time.Time, viewerCompanyId *int) (*[]Event, error)
+	DeleteSeriesById(ctx context.Context, id int) error
+	FindSessions(ctx context.Context, e *Event) (*[]Session, error)
+	ReplaceSessions(ctx context.Context, e *Event, sessions []Session) (*[]Session, error)
+	ReplaceCompanies(ctx context.Context, e *Event, companyIds []int) error
+	FindCheckedUsers(ctx context.Context, e *Event, statuses ...RegistrationStatus) (*[]Registration, error)
+	Register(ctx context.Context, e *Event, u *user.User) error
+	FindRegistration(ctx context.Context, e *Event, u *user.User) (*Registration, error)
+	FindRegistrationsByUser(ctx context.Context, u *user.User, from, to *time.Time) (*[]Registration, error)
+	UpdateRegistration(ctx context.Context, reg *Registration) error
+	CheckinUser(ctx context.Context, reg *Registration) error
+	CountActiveRegistrations(ctx context.Context, e *Event) (int, error)
+	AddToWaitlist(ctx context.Context, e *Event, u *user.User) error
+	RemoveFromWaitlist(ctx context.Context, e *Event, u *user.User) error
+	PopWaitlist(ctx context.Context, e *Event) (int, error)
+	FindWaitlist(ctx context.Context, e *Event) (*[]user.User, error)
 }
 
+const (
+	CheckinTokenTTL     = 5 * time.Minute
+	checkinTokenPurpose = "event-checkin"
+)
+
+var (
+	ErrInvalidCheckinToken  = errors.New("invalid checkin token")
+	ErrAlreadyRegistered    = errors.New("user already registered")
+	ErrAlreadyCheckedIn     = errors.New("user already checked in")
+	ErrNotCheckedIn         = errors.New("user not checked in")
+	ErrAlreadyCheckedOut    = errors.New("user already checked out")
+	ErrInvalidStatus        = errors.New("invalid registration status")
+	ErrRegistrationFinished = errors.New("registration already finished")
+)
+
 type Service struct {
-	eventRepo Repository
+	eventRepo  Repository
+	transactor db.Transactor[Repository]
+}
+
+func NewService(eventRepo Repository, transactor db.Transactor[Repository]) *Service {
+	return &Service{eventRepo, transactor}
+}
+
+// inTx runs fn with a copy of the service bound to a single transaction. The copy
+// has no transactor, so the service methods fn calls join that transaction.
+func (s *Service) inTx(ctx context.Context, fn func(tx *Service) error) error {
+	if s.transactor == nil {
+		return fn(s)
+	}
+
+	return s.transactor.InTx(ctx, func(repo Repository) error {
+		return fn(&Service{eventRepo: repo})
+	})
 }
 
-func NewService(eventRepo Repository) *Service {
-	return &Service{eventRepo}
+// viewerCompany is the company whose visibility rules apply to u, nil for the
+// users who manage events and see all of them.
+func viewerCompany(u *user.User) *int {
+	if u.Can(user.PERM_MANAGE_EVENTS) {
+		return nil
+	}
+	return &u.Company.Id
 }
 
-func (s *Service) GetEvent(id int) (*Event, error) {
-	e, err := s.eventRepo.FindById(id)
+// GetEvent returns the event whatever its visibility, GetVisibleEvent is the one to
+// use on behalf of a user.
+func (s *Service) GetEvent(ctx context.Context, id int) (*Event, error) {
+	e, err := s.eventRepo.FindById(ctx, id, nil)
 	if err != nil {
 		return nil, fmt.Errorf("event_service: get event by id: %w", err)
 	}
 
+	if err := s.loadSessions(ctx, e); err != nil {
+		return nil, fmt.Errorf("event_service: get event by id: %w", err)
+	}
+
+	return e, nil
+}
+
+// GetVisibleEvent returns the event if u can see it, events hidden from u are
+// reported as not found.
+func (s *Service) GetVisibleEvent(ctx context.Context, id int, u *user.User) (*Event, error) {
+	e, err := s.eventRepo.FindById(ctx, id, viewerCompany(u))
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get visible event: %w", err)
+	}
+
+	if err := s.loadSessions(ctx, e); err != nil {
+		return nil, fmt.Errorf("event_service: get visible event: %w", err)
+	}
+
 	return e, nil
 }
 
-func (s *Service) GetEvents() (*[]Event, error) {
-	eList, err := s.eventRepo.FindAll()
+func (s *Service) GetEvents(ctx context.Context) (*[]Event, error) {
+	eList, err := s.eventRepo.FindAll(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("event_service: get events: %w", err)
 	}
 
+	for i := range *eList {
+		if err := s.loadSessions(ctx, &(*eList)[i]); err != nil {
+			return nil, fmt.Errorf("event_service: get events: %w", err)
+		}
+	}
+
 	return eList, nil
 }
 
-func (s *Service) GetUpcomingEvents() (*[]Event, error) {
-	eList, err := s.eventRepo.FindUpcoming()
+// GetUpcomingEvents lists the events that haven't ended yet among the ones u can see.
+func (s *Service) GetUpcomingEvents(ctx context.Context, u *user.User) (*[]Event, error) {
+	eList, err := s.eventRepo.FindUpcoming(ctx, viewerCompany(u))
 	if err != nil {
 		return nil, fmt.Errorf("event_service: get upcoming events: %w", err)
 	}
 
+	for i := range *eList {
+		if err := s.loadSessions(ctx, &(*eList)[i]); err != nil {
+			return nil, fmt.Errorf("event_service: get upcoming events: %w", err)
+		}
+	}
+
 	return eList, nil
 }
 
-func (s *Service) CreateEvent(e *Event) (*Event, error) {
-	newEvent, err := s.eventRepo.Insert(e)
+func (s *Service) CreateEvent(ctx context.Context, e *Event) (*Event, error) {
+	e.setDefaults()
+
+	var newEvent *Event
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		if newEvent, err = tx.eventRepo.Insert(ctx, e); err != nil {
+			return err
+		}
+
+		sessions, err := tx.eventRepo.ReplaceSessions(ctx, newEvent, e.Sessions)
+		if err != nil {
+			return err
+		}
+		newEvent.Sessions = *sessions
+
+		if err := tx.eventRepo.ReplaceCompanies(ctx, newEvent, e.Companies); err != nil {
+			return err
+		}
+		newEvent.Companies = e.Companies
+
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("event_service: create event: %w", err)
 	}
@@ -62,26 +176,311 @@ func (s *Service) CreateEvent(e *Event) (*Event, error) {
 	return newEvent, nil
 }
 
-func (s *Service) UpdateEvent(id int, newData *Event) (*Event, error) {
-	event, err := s.eventRepo.FindById(id)
+func (s *Service) UpdateEvent(ctx context.Context, id int, newData *Event) (*Event, error) {
+	var updatedEvent *Event
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		updatedEvent, err = tx.updateEvent(ctx, id, newData)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("event_service: update event: %w", err)
 	}
 
+	return updatedEvent, nil
+}
+
+func (s *Service) updateEvent(ctx context.Context, id int, newData *Event) (*Event, error) {
+	if err := s.eventRepo.LockById(ctx, id); err != nil {
+		return nil, err
+	}
+
+	event, err := s.eventRepo.FindById(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	event.Description = newData.Description
 	event.Name = newData.Name
 	event.Date = newData.Date
+	event.EndDate = newData.EndDate
+	event.Sessions = newData.Sessions
+	event.Capacity = newData.Capacity
+	event.CheckinOpensAt = newData.CheckinOpensAt
+	event.CheckinClosesAt = newData.CheckinClosesAt
+	event.MinAttendanceMinutes = newData.MinAttendanceMinutes
+	event.CompanyId = newData.CompanyId
+	event.Visibility = newData.Visibility
+	event.Companies = newData.Companies
+	event.setDefaults()
 
-	updatedEvent, err := s.eventRepo.Update(event)
+	updatedEvent, err := s.saveEvent(ctx, event)
 	if err != nil {
-		return nil, fmt.Errorf("event_service: update event: %w", err)
+		return nil, err
+	}
+
+	if err := s.promoteWaitlisted(ctx, updatedEvent); err != nil {
+		return nil, err
+	}
+
+	return updatedEvent, nil
+}
+
+func (s *Service) PatchEvent(ctx context.Context, id int, patch *EventPatch) (*Event, error) {
+	var updatedEvent *Event
+	err := s.inTx(ctx, func(tx *Service) error {
+		var err error
+		updatedEvent, err = tx.patchEvent(ctx, id, patch)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: patch event: %w", err)
+	}
+
+	return updatedEvent, nil
+}
+
+func (s *Service) patchEvent(ctx context.Context, id int, patch *EventPatch) (*Event, error) {
+	if err := s.eventRepo.LockById(ctx, id); err != nil {
+		return nil, err
+	}
+
+	event, err := s.eventRepo.FindById(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadSessions(ctx, event); err != nil {
+		return nil, err
+	}
+
+	patch.Apply(event)
+	event.setDefaults()
+
+	if problems := event.Validate(); len(problems) > 0 {
+		return nil, &ValidationError{problems}
+	}
+
+	updatedEvent, err := s.saveEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.promoteWaitlisted(ctx, updatedEvent); err != nil {
+		return nil, err
 	}
 
 	return updatedEvent, nil
 }
 
-func (s *Service) DeleteEvent(id int) error {
-	exists, err := s.eventRepo.Exists(id)
+// CreateSeries expands the rule starting at the template's date and creates one
+// event per occurrence, each keeping the template's duration and sessions.
+func (s *Service) CreateSeries(ctx context.Context, template *Event, rule string) (*Series, error) {
+	rec, err := ParseRecurrence(rule)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: create series: %w", err)
+	}
+
+	occurrences, err := rec.Occurrences(template.Date)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: create series: %w", err)
+	}
+
+	if len(occurrences) == 0 {
+		return nil, fmt.Errorf("event_service: create series: %w: rule has no occurrences", ErrInvalidRecurrence)
+	}
+
+	template.setDefaults()
+
+	var series *Series
+	err = s.inTx(ctx, func(tx *Service) error {
+		var err error
+		if series, err = tx.eventRepo.InsertSeries(ctx, &Series{Name: template.Name, Rule: rec.String()}); err != nil {
+			return err
+		}
+
+		series.Events = []Event{}
+		for _, start := range occurrences {
+			e := template.shifted(start.Sub(template.Date))
+			e.SeriesId = &series.Id
+
+			newEvent, err := tx.CreateEvent(ctx, e)
+			if err != nil {
+				return err
+			}
+			series.Events = append(series.Events, *newEvent)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: create series: %w", err)
+	}
+
+	return series, nil
+}
+
+// GetSeries returns the series with the occurrences u can see.
+func (s *Service) GetSeries(ctx context.Context, id int, u *user.User) (*Series, error) {
+	series, err := s.eventRepo.FindSeriesById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get series: %w", err)
+	}
+
+	events, err := s.eventRepo.FindSeriesEvents(ctx, id, time.Time{}, viewerCompany(u))
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get series: %w", err)
+	}
+
+	for i := range *events {
+		if err := s.loadSessions(ctx, &(*events)[i]); err != nil {
+			return nil, fmt.Errorf("event_service: get series: %w", err)
+		}
+	}
+	series.Events = *events
+
+	return series, nil
+}
+
+// DeleteSeries deletes the series along with all of its occurrences.
+func (s *Service) DeleteSeries(ctx context.Context, id int) error {
+	if err := s.eventRepo.DeleteSeriesById(ctx, id); err != nil {
+		return fmt.Errorf("event_service: delete series: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateFollowingEvents replaces the event and the occurrences after it in its
+// series. Timestamps in newData are relative to the event with the given id, the
+// other occurrences keep their distance to it.
+func (s *Service) UpdateFollowingEvents(ctx context.Context, id int, newData *Event) (*[]Event, error) {
+	updatedEvents := []Event{}
+	err := s.inTx(ctx, func(tx *Service) error {
+		events, ref, err := tx.followingEvents(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range *events {
+			updatedEvent, err := tx.UpdateEvent(ctx, e.Id, newData.shifted(e.Date.Sub(ref.Date)))
+			if err != nil {
+				return err
+			}
+			updatedEvents = append(updatedEvents, *updatedEvent)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: update following events: %w", err)
+	}
+
+	return &updatedEvents, nil
+}
+
+// PatchFollowingEvents is the partial update counterpart of UpdateFollowingEvents.
+func (s *Service) PatchFollowingEvents(ctx context.Context, id int, patch *EventPatch) (*[]Event, error) {
+	updatedEvents := []Event{}
+	err := s.inTx(ctx, func(tx *Service) error {
+		events, ref, err := tx.followingEvents(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range *events {
+			updatedEvent, err := tx.PatchEvent(ctx, e.Id, patch.shifted(e.Date.Sub(ref.Date)))
+			if err != nil {
+				return err
+			}
+			updatedEvents = append(updatedEvents, *updatedEvent)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: patch following events: %w", err)
+	}
+
+	return &updatedEvents, nil
+}
+
+// DeleteFollowingEvents deletes the event and the occurrences after it in its series.
+func (s *Service) DeleteFollowingEvents(ctx context.Context, id int) error {
+	err := s.inTx(ctx, func(tx *Service) error {
+		events, _, err := tx.followingEvents(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range *events {
+			if err := tx.DeleteEvent(ctx, e.Id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("event_service: delete following events: %w", err)
+	}
+
+	return nil
+}
+
+// followingEvents returns the event with the given id and the later occurrences
+// of its series, or only the event when it doesn't belong to one.
+func (s *Service) followingEvents(ctx context.Context, id int) (*[]Event, *Event, error) {
+	ref, err := s.eventRepo.FindById(ctx, id, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ref.SeriesId == nil {
+		return &[]Event{*ref}, ref, nil
+	}
+
+	events, err := s.eventRepo.FindSeriesEvents(ctx, *ref.SeriesId, ref.Date, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return events, ref, nil
+}
+
+// saveEvent updates the event along with its sessions and the companies it is shared with.
+func (s *Service) saveEvent(ctx context.Context, e *Event) (*Event, error) {
+	updatedEvent, err := s.eventRepo.Update(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.eventRepo.ReplaceSessions(ctx, updatedEvent, e.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	updatedEvent.Sessions = *sessions
+
+	if err := s.eventRepo.ReplaceCompanies(ctx, updatedEvent, e.Companies); err != nil {
+		return nil, err
+	}
+	updatedEvent.Companies = e.Companies
+
+	return updatedEvent, nil
+}
+
+func (s *Service) loadSessions(ctx context.Context, e *Event) error {
+	sessions, err := s.eventRepo.FindSessions(ctx, e)
+	if err != nil {
+		return fmt.Errorf("load sessions: %w", err)
+	}
+
+	e.Sessions = *sessions
+	return nil
+}
+
+func (s *Service) DeleteEvent(ctx context.Context, id int) error {
+	exists, err := s.eventRepo.Exists(ctx, id)
 	if err != nil {
 		return fmt.Errorf("event_service: delete event: %w", err)
 	}
@@ -90,26 +489,362 @@ func (s *Service) DeleteEvent(id int) error {
 		return fmt.Errorf("event_service: delete event: %w", ErrEventNotFound)
 	}
 
-	if err := s.eventRepo.DeleteById(id); err != nil {
+	if err := s.eventRepo.DeleteById(ctx, id); err != nil {
 		return fmt.Errorf("event_service: delete event: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Service) CheckinUserInEvent(e *Event, u *user.User) error {
-	if err := s.eventRepo.CheckinUser(e, u); err != nil {
-		return fmt.Errorf("event_service: %w", err)
+// RegisterUserInEvent registers the user, or puts them on the waitlist when the
+// event is already full. The returned bool reports whether the user was waitlisted.
+func (s *Service) RegisterUserInEvent(ctx context.Context, e *Event, u *user.User) (bool, error) {
+	var waitlisted bool
+	err := s.inTx(ctx, func(tx *Service) error {
+		// Concurrent registrations would all see the last free seat.
+		if err := tx.eventRepo.LockById(ctx, e.Id); err != nil {
+			return err
+		}
+
+		// The capacity may have changed since e was read, only the locked row counts.
+		current, err := tx.eventRepo.FindById(ctx, e.Id, nil)
+		if err != nil {
+			return err
+		}
+
+		reg, err := tx.eventRepo.FindRegistration(ctx, current, u)
+		if err != nil && !errors.Is(err, ErrRegistrationNotFound) {
+			return err
+		}
+
+		if reg != nil && reg.Status != STATUS_CANCELLED {
+			return ErrAlreadyRegistered
+		}
+
+		if current.Capacity > 0 {
+			count, err := tx.eventRepo.CountActiveRegistrations(ctx, current)
+			if err != nil {
+				return err
+			}
+
+			if count >= current.Capacity {
+				waitlisted = true
+				return tx.eventRepo.AddToWaitlist(ctx, current, u)
+			}
+		}
+
+		return tx.eventRepo.Register(ctx, current, u)
+	})
+	if err != nil {
+		return false, fmt.Errorf("event_service: register user: %w", err)
+	}
+
+	return waitlisted, nil
+}
+
+// CancelRegistration cancels the user's registration, or removes them from the
+// waitlist. Freeing a seat promotes the first waitlisted user.
+func (s *Service) CancelRegistration(ctx context.Context, e *Event, u *user.User) error {
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.eventRepo.LockById(ctx, e.Id); err != nil {
+			return err
+		}
+
+		// Promoting from the waitlist goes by the capacity of the locked row.
+		current, err := tx.eventRepo.FindById(ctx, e.Id, nil)
+		if err != nil {
+			return err
+		}
+
+		reg, err := tx.eventRepo.FindRegistration(ctx, current, u)
+		if err != nil && !errors.Is(err, ErrRegistrationNotFound) {
+			return err
+		}
+
+		if reg == nil || reg.Status == STATUS_CANCELLED {
+			return tx.eventRepo.RemoveFromWaitlist(ctx, current, u)
+		}
+
+		if reg.Status != STATUS_REGISTERED {
+			return ErrRegistrationFinished
+		}
+
+		now := time.Now()
+		reg.Status = STATUS_CANCELLED
+		reg.CancelledAt = &now
+
+		if err := tx.eventRepo.UpdateRegistration(ctx, reg); err != nil {
+			return err
+		}
+
+		return tx.promoteWaitlisted(ctx, current)
+	})
+	if err != nil {
+		return fmt.Errorf("event_service: cancel registration: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Service) GetCheckedUsers(e *Event) (*[]user.User, error) {
-	uList, err := s.eventRepo.FindCheckedUsers(e)
+// CheckinUserInEvent records that a registered user is present at the event.
+func (s *Service) CheckinUserInEvent(ctx context.Context, e *Event, u *user.User) (*Registration, error) {
+	var reg *Registration
+	err := s.inTx(ctx, func(tx *Service) error {
+		// A cancellation running at the same time must not be overwritten by the check-in.
+		if err := tx.eventRepo.LockById(ctx, e.Id); err != nil {
+			return err
+		}
+
+		var err error
+		reg, err = tx.eventRepo.FindRegistration(ctx, e, u)
+		if err != nil {
+			return err
+		}
+
+		switch reg.Status {
+		case STATUS_CANCELLED:
+			return ErrRegistrationNotFound
+		case STATUS_ATTENDED:
+			return ErrAlreadyCheckedIn
+		}
+
+		now := time.Now()
+		if err := e.checkCheckinWindow(now); err != nil {
+			return err
+		}
+
+		reg.Status = STATUS_ATTENDED
+		reg.CheckedInAt = &now
+
+		return tx.eventRepo.CheckinUser(ctx, reg)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("event_service: get checked users: %w", err)
+		return nil, fmt.Errorf("event_service: checkin user: %w", err)
+	}
+	reg.setAttendance(e)
+
+	return reg, nil
+}
+
+// CheckoutUserFromEvent records that a checked in user left the event.
+func (s *Service) CheckoutUserFromEvent(ctx context.Context, e *Event, u *user.User) (*Registration, error) {
+	var reg *Registration
+	err := s.inTx(ctx, func(tx *Service) error {
+		// Two check-outs, or a check-out and a cancellation, must not interleave.
+		if err := tx.eventRepo.LockById(ctx, e.Id); err != nil {
+			return err
+		}
+
+		var err error
+		reg, err = tx.eventRepo.FindRegistration(ctx, e, u)
+		if err != nil {
+			return err
+		}
+
+		if reg.Status != STATUS_ATTENDED || reg.CheckedInAt == nil {
+			return ErrNotCheckedIn
+		}
+
+		if reg.CheckedOutAt != nil {
+			return ErrAlreadyCheckedOut
+		}
+
+		now := time.Now()
+		reg.CheckedOutAt = &now
+
+		return tx.eventRepo.UpdateRegistration(ctx, reg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: checkout user: %w", err)
+	}
+	reg.setAttendance(e)
+
+	return reg, nil
+}
+
+// IssueCheckinToken signs a short lived token the user presents on site to be
+// checked in, and once checked in, to be checked out.
+func (s *Service) IssueCheckinToken(ctx context.Context, e *Event, u *user.User) (string, time.Time, error) {
+	if !u.Verified {
+		return "", time.Time{}, fmt.Errorf("event_service: issue checkin token: %w", user.ErrUserNotVerified)
+	}
+
+	reg, err := s.eventRepo.FindRegistration(ctx, e, u)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("event_service: issue checkin token: %w", err)
+	}
+
+	switch {
+	case reg.Status == STATUS_CANCELLED:
+		return "", time.Time{}, fmt.Errorf("event_service: issue checkin token: %w", ErrRegistrationNotFound)
+	case reg.CheckedOutAt != nil:
+		return "", time.Time{}, fmt.Errorf("event_service: issue checkin token: %w", ErrAlreadyCheckedOut)
+	case reg.Status != STATUS_ATTENDED:
+		// Checking out is allowed after the window closes, only checking in is bound to it.
+		if err := e.checkCheckinWindow(time.Now()); err != nil {
+			return "", time.Time{}, fmt.Errorf("event_service: issue checkin token: %w", err)
+		}
+	}
+
+	expiresAt := time.Now().Add(CheckinTokenTTL)
+	token := auth.SignToken(checkinTokenPurpose, fmt.Sprintf("%d.%d", e.Id, u.Id), expiresAt)
+
+	return token, expiresAt, nil
+}
+
+// RedeemCheckinToken checks in the user a token from IssueCheckinToken was issued to.
+func (s *Service) RedeemCheckinToken(ctx context.Context, e *Event, token string) (*Registration, error) {
+	userId, err := parseCheckinToken(e, token)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: redeem checkin token: %w", err)
+	}
+
+	reg, err := s.CheckinUserInEvent(ctx, e, &user.User{Id: userId})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: redeem checkin token: %w", err)
+	}
+
+	return reg, nil
+}
+
+// RedeemCheckoutToken checks out the user a token from IssueCheckinToken was issued to.
+func (s *Service) RedeemCheckoutToken(ctx context.Context, e *Event, token string) (*Registration, error) {
+	userId, err := parseCheckinToken(e, token)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: redeem checkout token: %w", err)
+	}
+
+	reg, err := s.CheckoutUserFromEvent(ctx, e, &user.User{Id: userId})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: redeem checkout token: %w", err)
+	}
+
+	return reg, nil
+}
+
+// parseCheckinToken verifies the token was issued for e and returns the user id it carries.
+func parseCheckinToken(e *Event, token string) (int, error) {
+	payload, err := auth.VerifySignedToken(checkinTokenPurpose, token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidCheckinToken, err)
+	}
+
+	var eventId, userId int
+	if _, err := fmt.Sscanf(payload, "%d.%d", &eventId, &userId); err != nil || eventId != e.Id {
+		return 0, ErrInvalidCheckinToken
+	}
+
+	return userId, nil
+}
+
+// MarkAttendance lets an admin record whether a registered user attended the event.
+func (s *Service) MarkAttendance(ctx context.Context, e *Event, u *user.User, status RegistrationStatus) (*Registration, error) {
+	if status != STATUS_ATTENDED && status != STATUS_NO_SHOW {
+		return nil, fmt.Errorf("event_service: mark attendance: %w", ErrInvalidStatus)
+	}
+
+	var reg *Registration
+	err := s.inTx(ctx, func(tx *Service) error {
+		if err := tx.eventRepo.LockById(ctx, e.Id); err != nil {
+			return err
+		}
+
+		var err error
+		reg, err = tx.eventRepo.FindRegistration(ctx, e, u)
+		if err != nil {
+			return err
+		}
+
+		if reg.Status == STATUS_CANCELLED {
+			return ErrRegistrationNotFound
+		}
+
+		reg.Status = status
+		if status == STATUS_ATTENDED && reg.CheckedInAt == nil {
+			now := time.Now()
+			reg.CheckedInAt = &now
+		}
+		if status == STATUS_NO_SHOW {
+			reg.CheckedInAt = nil
+			reg.CheckedOutAt = nil
+		}
+
+		return tx.eventRepo.UpdateRegistration(ctx, reg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event_service: mark attendance: %w", err)
+	}
+	reg.setAttendance(e)
+
+	return reg, nil
+}
+
+// GetUserRegistrations lists the user's registrations, cancelled ones included, each with its event.
+// from and to are optional and limit the result to the events happening in that range.
+func (s *Service) GetUserRegistrations(ctx context.Context, u *user.User, from, to *time.Time) (*[]Registration, error) {
+	regs, err := s.eventRepo.FindRegistrationsByUser(ctx, u, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get user registrations: %w", err)
+	}
+
+	for i := range *regs {
+		reg := &(*regs)[i]
+		if err := s.loadSessions(ctx, reg.Event); err != nil {
+			return nil, fmt.Errorf("event_service: get user registrations: %w", err)
+		}
+		reg.setAttendance(reg.Event)
+	}
+
+	return regs, nil
+}
+
+func (s *Service) GetWaitlist(ctx context.Context, e *Event) (*[]user.User, error) {
+	uList, err := s.eventRepo.FindWaitlist(ctx, e)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get waitlist: %w", err)
 	}
 
 	return uList, nil
 }
+
+// promoteWaitlisted registers waitlisted users, oldest first, while the event has free seats.
+func (s *Service) promoteWaitlisted(ctx context.Context, e *Event) error {
+	for {
+		if e.Capacity > 0 {
+			count, err := s.eventRepo.CountActiveRegistrations(ctx, e)
+			if err != nil {
+				return fmt.Errorf("promote waitlisted: %w", err)
+			}
+
+			if count >= e.Capacity {
+				return nil
+			}
+		}
+
+		userId, err := s.eventRepo.PopWaitlist(ctx, e)
+		if err != nil {
+			if errors.Is(err, ErrWaitlistEmpty) {
+				return nil
+			}
+			return fmt.Errorf("promote waitlisted: %w", err)
+		}
+
+		if err := s.eventRepo.Register(ctx, e, &user.User{Id: userId}); err != nil && !errors.Is(err, ErrUniqueViolation) {
+			return fmt.Errorf("promote waitlisted: %w", err)
+		}
+	}
+}
+
+// GetCheckedUsers lists the event registrations, optionally only those in one of the given statuses.
+func (s *Service) GetCheckedUsers(ctx context.Context, e *Event, statuses ...RegistrationStatus) (*[]Registration, error) {
+	regList, err := s.eventRepo.FindCheckedUsers(ctx, e, statuses...)
+	if err != nil {
+		return nil, fmt.Errorf("event_service: get checked users: %w", err)
+	}
+
+	for i := range *regList {
+		(*regList)[i].setAttendance(e)
+	}
+
+	return regList, nil
+}
@@ -0,0 +1,33 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session is one time slot of an event, multi-day events usually have one per day.
+type Session struct {
+	Id       int       `json:"id"`
+	Name     string    `json:"name"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// validateSessions checks every session lies within the event, reporting problems as sessions[i].
+func validateSessions(e *Event, problems map[string]string) {
+	for i, s := range e.Sessions {
+		key := fmt.Sprintf("sessions[%d]", i)
+
+		switch {
+		case strings.TrimSpace(s.Name) == "":
+			problems[key] = "name cannot be empty"
+		case s.StartsAt.IsZero() || s.EndsAt.IsZero():
+			problems[key] = "starts_at and ends_at cannot be empty"
+		case !s.EndsAt.After(s.StartsAt):
+			problems[key] = "ends_at must be after starts_at"
+		case s.StartsAt.Before(e.Date) || s.EndsAt.After(e.end()):
+			problems[key] = "session must be within the event date and end_date"
+		}
+	}
+}
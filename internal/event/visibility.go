@@ -0,0 +1,58 @@
+package event
+
+// Visibility decides which users can see and attend an event.
+type Visibility string
+
+const (
+	// VISIBILITY_PUBLIC events are seen by every user.
+	VISIBILITY_PUBLIC Visibility = "PUBLIC"
+	// VISIBILITY_COMPANY events are only seen by the users of the owning company.
+	VISIBILITY_COMPANY Visibility = "COMPANY"
+	// VISIBILITY_SELECTED events are seen by the users of the owning company and
+	// of the companies listed in Event.Companies.
+	VISIBILITY_SELECTED Visibility = "SELECTED"
+)
+
+func (v Visibility) String() string {
+	return string(v)
+}
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VISIBILITY_PUBLIC, VISIBILITY_COMPANY, VISIBILITY_SELECTED:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateVisibility adds the problems of the owner and visibility fields of e to problems.
+func validateVisibility(e *Event, problems map[string]string) {
+	if e.Visibility != "" && !e.Visibility.Valid() {
+		problems["visibility"] = "visibility must be PUBLIC, COMPANY or SELECTED"
+		return
+	}
+
+	if e.CompanyId != nil && *e.CompanyId <= 0 {
+		problems["company_id"] = "company_id must be a positive int"
+	}
+
+	if e.Visibility != "" && e.Visibility != VISIBILITY_PUBLIC && e.CompanyId == nil {
+		problems["company_id"] = "company_id is required unless the event is PUBLIC"
+	}
+
+	if e.Visibility == VISIBILITY_SELECTED && len(e.Companies) == 0 {
+		problems["companies"] = "companies cant be empty for SELECTED events"
+	}
+
+	if e.Visibility != VISIBILITY_SELECTED && len(e.Companies) > 0 {
+		problems["companies"] = "companies can only be set on SELECTED events"
+	}
+
+	for _, id := range e.Companies {
+		if id <= 0 {
+			problems["companies"] = "companies must only hold positive ints"
+			break
+		}
+	}
+}
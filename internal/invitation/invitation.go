@@ -0,0 +1,34 @@
+package invitation
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+// TokenTTL is how long an invitation can be accepted.
+const TokenTTL = 7 * 24 * time.Hour
+
+// Invitation lets someone who doesn't have an account join a company with a
+// role chosen by the admin or company manager who invited them.
+type Invitation struct {
+	Id         int           `json:"id"`
+	Email      string        `json:"email"`
+	CompanyId  int           `json:"company_id"`
+	Role       user.UserRole `json:"role"`
+	InvitedBy  *int          `json:"invited_by"`
+	CreatedAt  time.Time     `json:"created_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	AcceptedAt *time.Time    `json:"accepted_at"`
+	RevokedAt  *time.Time    `json:"revoked_at"`
+}
+
+// Pending reports whether the invitation can still be accepted at now.
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
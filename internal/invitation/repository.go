@@ -0,0 +1,156 @@
+package invitation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+var (
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrForeignKeyViolation = errors.New("foreign key constraint violated")
+)
+
+const invitationColumns = `id, email, company_id, "role", invited_by, created_at, expires_at, accepted_at, revoked_at`
+
+type RepositoryPostgres struct {
+	db db.DBTX
+}
+
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
+}
+
+// NewTransactorPostgres runs transactions on conn with the Postgres repositories bound to each.
+func NewTransactorPostgres(conn *sql.DB) *db.TransactorPostgres[Repositories] {
+	return db.NewTransactorPostgres(conn, func(tx db.DBTX) Repositories {
+		return Repositories{NewRepositoryPostgres(tx), user.NewRepositoryPostgres(tx)}
+	})
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row scanner, inv *Invitation) error {
+	var role string
+	if err := row.Scan(&inv.Id, &inv.Email, &inv.CompanyId, &role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt, &inv.RevokedAt); err != nil {
+		return err
+	}
+	inv.Role = user.StringToUserRole(role)
+	return nil
+}
+
+func (r *RepositoryPostgres) FindById(ctx context.Context, id int) (*Invitation, error) {
+	inv := &Invitation{}
+	row := r.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE id = $1`, id)
+	if err := scanInvitation(row, inv); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation_repository: find by id: %w", ErrInvitationNotFound)
+		}
+		return nil, fmt.Errorf("invitation_repository: find by id: %w", err)
+	}
+	return inv, nil
+}
+
+// FindPending lists the invitations that can still be accepted, newest first.
+func (r *RepositoryPostgres) FindPending(ctx context.Context) (*[]Invitation, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+invitationColumns+` FROM invitations
+		WHERE accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_repository: find pending: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		if err := scanInvitation(rows, &inv); err != nil {
+			return nil, fmt.Errorf("invitation_repository: find pending: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("invitation_repository: find pending: %w", err)
+	}
+
+	return &invitations, nil
+}
+
+func (r *RepositoryPostgres) Insert(ctx context.Context, inv *Invitation) (*Invitation, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO invitations (email, company_id, "role", invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+invitationColumns,
+		inv.Email, inv.CompanyId, inv.Role.String(), inv.InvitedBy, inv.ExpiresAt)
+
+	var newInv Invitation
+	if err := scanInvitation(row, &newInv); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			if pqErr.Code == "23503" { // Foreign key violation
+				return nil, fmt.Errorf("invitation_repository: insert: %w", ErrForeignKeyViolation)
+			}
+		}
+		return nil, fmt.Errorf("invitation_repository: insert: %w", err)
+	}
+
+	return &newInv, nil
+}
+
+// RevokePendingByEmail revokes the open invitations sent to email, so only the newest one works.
+func (r *RepositoryPostgres) RevokePendingByEmail(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE invitations SET revoked_at = NOW()
+		WHERE email = $1 AND accepted_at IS NULL AND revoked_at IS NULL`, email)
+	if err != nil {
+		return fmt.Errorf("invitation_repository: revoke pending by email: %w", err)
+	}
+	return nil
+}
+
+// Revoke revokes an invitation that wasn't accepted or revoked yet.
+func (r *RepositoryPostgres) Revoke(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE invitations SET revoked_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("invitation_repository: revoke: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("invitation_repository: revoke: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("invitation_repository: revoke: %w", ErrInvitationNotFound)
+	}
+
+	return nil
+}
+
+// MarkAccepted marks a pending invitation as accepted. It fails with
+// ErrInvitationNotFound when it was accepted, revoked or expired in the meantime.
+func (r *RepositoryPostgres) MarkAccepted(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE invitations SET accepted_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()`, id)
+	if err != nil {
+		return fmt.Errorf("invitation_repository: mark accepted: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("invitation_repository: mark accepted: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("invitation_repository: mark accepted: %w", ErrInvitationNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/mail"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type Repository interface {
+	FindById(ctx context.Context, id int) (*Invitation, error)
+	FindPending(ctx context.Context) (*[]Invitation, error)
+	Insert(ctx context.Context, inv *Invitation) (*Invitation, error)
+	RevokePendingByEmail(ctx context.Context, email string) error
+	Revoke(ctx context.Context, id int) error
+	MarkAccepted(ctx context.Context, id int) error
+}
+
+const tokenPurpose = "invitation"
+
+var (
+	ErrInvalidToken      = errors.New("invalid or expired invitation")
+	ErrAlreadyRegistered = errors.New("email already has an account")
+)
+
+// Repositories are the ones the service changes together in a transaction.
+type Repositories struct {
+	Invitations Repository
+	Users       user.Repository
+}
+
+type Service struct {
+	repo        Repository
+	userRepo    user.Repository
+	companyRepo company.Repository
+	transactor  db.Transactor[Repositories]
+	mailer      mail.Mailer
+}
+
+func NewService(repo Repository, userRepo user.Repository, companyRepo company.Repository, transactor db.Transactor[Repositories], mailer mail.Mailer) *Service {
+	return &Service{repo, userRepo, companyRepo, transactor, mailer}
+}
+
+// Invite creates an invitation for email and mails its link, replacing any
+// invitation still open for the same address. link builds the URL from the token.
+func (s *Service) Invite(ctx context.Context, inviter *user.User, email string, companyId int, role user.UserRole, link func(token string) string) (*Invitation, error) {
+	email = normalizeEmail(email)
+
+	if _, err := s.userRepo.FindByEmail(ctx, email); err == nil {
+		return nil, fmt.Errorf("invitation_service: invite: %w", ErrAlreadyRegistered)
+	} else if !errors.Is(err, user.ErrUserNotFound) {
+		return nil, fmt.Errorf("invitation_service: invite: %w", err)
+	}
+
+	cmp, err := s.companyRepo.FindById(ctx, companyId)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: invite: %w", err)
+	}
+
+	var inv *Invitation
+	err = s.transactor.InTx(ctx, func(repos Repositories) error {
+		if err := repos.Invitations.RevokePendingByEmail(ctx, email); err != nil {
+			return err
+		}
+
+		var err error
+		inv, err = repos.Invitations.Insert(ctx, &Invitation{
+			Email:     email,
+			CompanyId: cmp.Id,
+			Role:      role,
+			InvitedBy: &inviter.Id,
+			ExpiresAt: time.Now().Add(TokenTTL),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: invite: %w", err)
+	}
+
+	token := auth.SignToken(tokenPurpose, strconv.Itoa(inv.Id), inv.ExpiresAt)
+	msg := mail.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("You're invited to join %s on Participe", cmp.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join %s on Participe. Use the link below to create your account, it expires in %d days.\n\n%s\n",
+			inviter.Name, cmp.Name, int(TokenTTL.Hours()/24), link(token)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		return nil, fmt.Errorf("invitation_service: invite: %w", err)
+	}
+
+	return inv, nil
+}
+
+func (s *Service) GetPendingInvitations(ctx context.Context) (*[]Invitation, error) {
+	invitations, err := s.repo.FindPending(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: get pending invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+func (s *Service) GetInvitation(ctx context.Context, id int) (*Invitation, error) {
+	inv, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: get invitation: %w", err)
+	}
+
+	return inv, nil
+}
+
+// Revoke voids a pending invitation, its link stops working.
+func (s *Service) Revoke(ctx context.Context, id int) error {
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return fmt.Errorf("invitation_service: revoke: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvitationByToken returns the pending invitation a token was issued for.
+func (s *Service) GetInvitationByToken(ctx context.Context, token string) (*Invitation, error) {
+	payload, err := auth.VerifySignedToken(tokenPurpose, token)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: get invitation by token: %w: %w", ErrInvalidToken, err)
+	}
+
+	id, err := strconv.Atoi(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: get invitation by token: %w", ErrInvalidToken)
+	}
+
+	inv, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			return nil, fmt.Errorf("invitation_service: get invitation by token: %w", ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("invitation_service: get invitation by token: %w", err)
+	}
+
+	if !inv.Pending(time.Now()) {
+		return nil, fmt.Errorf("invitation_service: get invitation by token: %w", ErrInvalidToken)
+	}
+
+	return inv, nil
+}
+
+// Accept creates the account of an invited person, in the company and with the
+// role of the invitation. The email is considered verified since the link was sent to it.
+func (s *Service) Accept(ctx context.Context, token, name, password string) (*user.User, error) {
+	inv, err := s.GetInvitationByToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_service: accept: %w", err)
+	}
+
+	u := &user.User{
+		Email:    inv.Email,
+		Name:     name,
+		Role:     inv.Role,
+		Company:  company.Company{Id: inv.CompanyId},
+		Verified: true,
+	}
+	if err := u.SetPassword(password); err != nil {
+		return nil, fmt.Errorf("invitation_service: accept: %w", err)
+	}
+
+	// Accepted twice at the same time, or revoked in between: the account isn't kept.
+	var newUser *user.User
+	err = s.transactor.InTx(ctx, func(repos Repositories) error {
+		var err error
+		if newUser, err = repos.Users.Insert(ctx, u); err != nil {
+			return err
+		}
+
+		return repos.Invitations.MarkAccepted(ctx, inv.Id)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrUniqueViolation):
+			return nil, fmt.Errorf("invitation_service: accept: %w", ErrAlreadyRegistered)
+		case errors.Is(err, ErrInvitationNotFound):
+			return nil, fmt.Errorf("invitation_service: accept: %w", ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("invitation_service: accept: %w", err)
+	}
+
+	return newUser, nil
+}
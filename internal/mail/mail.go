@@ -0,0 +1,77 @@
+// Package mail sends the emails the API needs, through SMTP or, for local
+// development, by writing them to a log.
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mthsgimenez/participe/internal/env"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewFromEnv builds the mailer selected by MAIL_DRIVER, "smtp" or "log" (the default).
+func NewFromEnv() (Mailer, error) {
+	switch driver := env.GetStringFallback("MAIL_DRIVER", "log"); driver {
+	case "smtp":
+		host, err := env.GetString("SMTP_HOST")
+		if err != nil {
+			return nil, fmt.Errorf("mail: %w", err)
+		}
+
+		from, err := env.GetString("MAIL_FROM")
+		if err != nil {
+			return nil, fmt.Errorf("mail: %w", err)
+		}
+
+		return &SMTPMailer{
+			Host:     host,
+			Port:     env.GetStringFallback("SMTP_PORT", "587"),
+			Username: env.GetStringFallback("SMTP_USERNAME", ""),
+			Password: env.GetStringFallback("SMTP_PASSWORD", ""),
+			From:     from,
+		}, nil
+	case "log":
+		path := env.GetStringFallback("MAIL_LOG_FILE", "")
+		if path == "" {
+			return NewLogMailer(os.Stdout), nil
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("mail: open log file: %w", err)
+		}
+
+		return NewLogMailer(f), nil
+	default:
+		return nil, fmt.Errorf("mail: unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// LogMailer writes messages to w instead of delivering them.
+type LogMailer struct {
+	w io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	_, err := fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n----\n", msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return fmt.Errorf("mail: log message: %w", err)
+	}
+
+	return nil
+}
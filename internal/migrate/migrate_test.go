@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(sql string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(sql)}
+	}
+
+	t.Run("sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0010_sessions.up.sql":         file("CREATE TABLE sessions ();"),
+			"migrations/0010_sessions.down.sql":       file("DROP TABLE sessions;"),
+			"migrations/0002_capacity.up.sql":         file("ALTER TABLE events ADD COLUMN capacity int;"),
+			"migrations/0002_capacity.down.sql":       file("ALTER TABLE events DROP COLUMN capacity;"),
+			"migrations/0001_initial_schema.up.sql":   file("CREATE TABLE events ();"),
+			"migrations/0001_initial_schema.down.sql": file("DROP TABLE events;"),
+			"migrations/README.md":                    file("not a migration"),
+		}
+
+		migrations, err := Load(fsys, "migrations")
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+
+		want := []Migration{
+			{1, "initial_schema", "CREATE TABLE events ();", "DROP TABLE events;"},
+			{2, "capacity", "ALTER TABLE events ADD COLUMN capacity int;", "ALTER TABLE events DROP COLUMN capacity;"},
+			{10, "sessions", "CREATE TABLE sessions ();", "DROP TABLE sessions;"},
+		}
+		if len(migrations) != len(want) {
+			t.Fatalf("Load = %+v, want %+v", migrations, want)
+		}
+		for i := range want {
+			if migrations[i] != want[i] {
+				t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "missing up",
+			fsys: fstest.MapFS{
+				"migrations/0001_initial_schema.up.sql":   file("CREATE TABLE events ();"),
+				"migrations/0001_initial_schema.down.sql": file("DROP TABLE events;"),
+				"migrations/0002_capacity.down.sql":       file("ALTER TABLE events DROP COLUMN capacity;"),
+			},
+			want: "2_capacity needs both an up and a down file",
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"migrations/0001_initial_schema.up.sql": file("CREATE TABLE events ();"),
+			},
+			want: "1_initial_schema needs both an up and a down file",
+		},
+		{
+			name: "duplicate version with another name",
+			fsys: fstest.MapFS{
+				"migrations/0002_capacity.up.sql":   file("ALTER TABLE events ADD COLUMN capacity int;"),
+				"migrations/0002_capacity.down.sql": file("ALTER TABLE events DROP COLUMN capacity;"),
+				"migrations/0002_sessions.up.sql":   file("CREATE TABLE sessions ();"),
+				"migrations/0002_sessions.down.sql": file("DROP TABLE sessions;"),
+			},
+			want: `version 2 is used by "capacity" and "sessions"`,
+		},
+		{
+			name: "duplicate version with the same name",
+			fsys: fstest.MapFS{
+				"migrations/0002_capacity.up.sql":   file("ALTER TABLE events ADD COLUMN capacity int;"),
+				"migrations/0002_capacity.down.sql": file("ALTER TABLE events DROP COLUMN capacity;"),
+				"migrations/2_capacity.up.sql":      file("ALTER TABLE events ADD COLUMN capacity int;"),
+				"migrations/2_capacity.down.sql":    file("ALTER TABLE events DROP COLUMN capacity;"),
+			},
+			want: "version 2 has more than one down file",
+		},
+		{
+			name: "no version",
+			fsys: fstest.MapFS{
+				"migrations/initial_schema.up.sql": file("CREATE TABLE events ();"),
+			},
+			want: "doesn't start with a version number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys, "migrations")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("embedded", func(t *testing.T) {
+		migrations, err := Load(migrationFiles, "migrations")
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("migration %d_%s, want version %d, versions should have no gaps", m.Version, m.Name, i+1)
+			}
+		}
+	})
+}
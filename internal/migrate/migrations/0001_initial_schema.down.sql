@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS events_users;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS companies;
@@ -0,0 +1,34 @@
+CREATE TABLE companies (
+	id serial NOT NULL,
+	"name" varchar(100) NOT NULL,
+	CONSTRAINT companies_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE events (
+	id serial NOT NULL,
+	description text NULL,
+	"name" varchar(100) NOT NULL,
+	"date" timestamptz NOT NULL,
+	CONSTRAINT events_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE users (
+	id serial NOT NULL,
+	email varchar(100) NOT NULL,
+	company_id int NOT NULL,
+	"name" varchar(60) NOT NULL,
+	"role" text NOT NULL DEFAULT 'ROLE_USER',
+	"password" text NOT NULL,
+	CONSTRAINT users_pk PRIMARY KEY (id),
+	CONSTRAINT users_unique UNIQUE (email),
+	CONSTRAINT users_companies_fk FOREIGN KEY (company_id) REFERENCES public.companies(id) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE TABLE events_users (
+	id serial NOT NULL,
+	user_id int NOT NULL,
+	event_id int NOT NULL,
+	CONSTRAINT events_users_pk PRIMARY KEY (id),
+	CONSTRAINT events_users_events_fk FOREIGN KEY (event_id) REFERENCES public.events(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT events_users_users_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS events_waitlist;
+
+ALTER TABLE events_users DROP CONSTRAINT IF EXISTS events_users_unique;
+
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_capacity_check,
+	DROP COLUMN IF EXISTS capacity;
@@ -0,0 +1,22 @@
+ALTER TABLE events
+	ADD COLUMN capacity int NOT NULL DEFAULT 0,
+	ADD CONSTRAINT events_capacity_check CHECK (capacity >= 0);
+
+-- The baseline allowed signing up for the same event twice, keep the first row.
+DELETE FROM events_users eu
+	USING events_users older
+	WHERE older.user_id = eu.user_id AND older.event_id = eu.event_id AND older.id < eu.id;
+
+ALTER TABLE events_users
+	ADD CONSTRAINT events_users_unique UNIQUE (user_id, event_id);
+
+CREATE TABLE events_waitlist (
+	id serial NOT NULL,
+	user_id int NOT NULL,
+	event_id int NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	CONSTRAINT events_waitlist_pk PRIMARY KEY (id),
+	CONSTRAINT events_waitlist_unique UNIQUE (user_id, event_id),
+	CONSTRAINT events_waitlist_events_fk FOREIGN KEY (event_id) REFERENCES public.events(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT events_waitlist_users_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
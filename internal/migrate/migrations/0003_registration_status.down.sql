@@ -0,0 +1,6 @@
+ALTER TABLE events_users
+	DROP CONSTRAINT IF EXISTS events_users_status_check,
+	DROP COLUMN IF EXISTS checked_in_at,
+	DROP COLUMN IF EXISTS cancelled_at,
+	DROP COLUMN IF EXISTS registered_at,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+-- Existing rows are sign-ups, nobody was checked in on site yet.
+ALTER TABLE events_users
+	ADD COLUMN status text NOT NULL DEFAULT 'REGISTERED',
+	ADD COLUMN registered_at timestamptz NOT NULL DEFAULT NOW(),
+	ADD COLUMN cancelled_at timestamptz NULL,
+	ADD COLUMN checked_in_at timestamptz NULL,
+	ADD CONSTRAINT events_users_status_check CHECK (status IN ('REGISTERED', 'CANCELLED', 'ATTENDED', 'NO_SHOW'));
@@ -0,0 +1,4 @@
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_checkin_window_check,
+	DROP COLUMN IF EXISTS checkin_closes_at,
+	DROP COLUMN IF EXISTS checkin_opens_at;
@@ -0,0 +1,4 @@
+ALTER TABLE events
+	ADD COLUMN checkin_opens_at timestamptz NULL,
+	ADD COLUMN checkin_closes_at timestamptz NULL,
+	ADD CONSTRAINT events_checkin_window_check CHECK (checkin_closes_at IS NULL OR checkin_opens_at IS NULL OR checkin_closes_at > checkin_opens_at);
@@ -0,0 +1,6 @@
+ALTER TABLE events_users
+	DROP COLUMN IF EXISTS checked_out_at;
+
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_min_attendance_check,
+	DROP COLUMN IF EXISTS min_attendance_minutes;
@@ -0,0 +1,6 @@
+ALTER TABLE events
+	ADD COLUMN min_attendance_minutes int NOT NULL DEFAULT 0,
+	ADD CONSTRAINT events_min_attendance_check CHECK (min_attendance_minutes >= 0);
+
+ALTER TABLE events_users
+	ADD COLUMN checked_out_at timestamptz NULL;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS event_sessions;
+
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_end_date_check,
+	DROP COLUMN IF EXISTS end_date;
@@ -0,0 +1,17 @@
+-- Events created before end dates existed get the default duration of an hour.
+ALTER TABLE events ADD COLUMN end_date timestamptz NULL;
+UPDATE events SET end_date = "date" + interval '1 hour';
+ALTER TABLE events
+	ALTER COLUMN end_date SET NOT NULL,
+	ADD CONSTRAINT events_end_date_check CHECK (end_date > "date");
+
+CREATE TABLE event_sessions (
+	id serial NOT NULL,
+	event_id int NOT NULL,
+	"name" varchar(100) NOT NULL,
+	starts_at timestamptz NOT NULL,
+	ends_at timestamptz NOT NULL,
+	CONSTRAINT event_sessions_pk PRIMARY KEY (id),
+	CONSTRAINT event_sessions_check CHECK (ends_at > starts_at),
+	CONSTRAINT event_sessions_events_fk FOREIGN KEY (event_id) REFERENCES public.events(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
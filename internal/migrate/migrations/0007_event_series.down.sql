@@ -0,0 +1,5 @@
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_event_series_fk,
+	DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS event_series;
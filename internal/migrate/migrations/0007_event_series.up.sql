@@ -0,0 +1,10 @@
+CREATE TABLE event_series (
+	id serial NOT NULL,
+	"name" varchar(100) NOT NULL,
+	rule text NOT NULL,
+	CONSTRAINT event_series_pk PRIMARY KEY (id)
+);
+
+ALTER TABLE events
+	ADD COLUMN series_id int NULL,
+	ADD CONSTRAINT events_event_series_fk FOREIGN KEY (series_id) REFERENCES public.event_series(id) ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+	DROP CONSTRAINT IF EXISTS users_calendar_token_unique,
+	DROP COLUMN IF EXISTS calendar_token;
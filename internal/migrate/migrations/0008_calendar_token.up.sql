@@ -0,0 +1,3 @@
+ALTER TABLE users
+	ADD COLUMN calendar_token char(64) NULL,
+	ADD CONSTRAINT users_calendar_token_unique UNIQUE (calendar_token);
@@ -0,0 +1,11 @@
+CREATE TABLE password_reset_tokens (
+	id serial NOT NULL,
+	user_id int NOT NULL,
+	token_hash char(64) NOT NULL,
+	expires_at timestamptz NOT NULL,
+	used_at timestamptz NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	CONSTRAINT password_reset_tokens_pk PRIMARY KEY (id),
+	CONSTRAINT password_reset_tokens_unique UNIQUE (token_hash),
+	CONSTRAINT password_reset_tokens_users_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
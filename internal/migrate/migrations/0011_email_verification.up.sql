@@ -0,0 +1,15 @@
+-- Accounts created before verification existed keep working, new ones start unverified.
+ALTER TABLE users ADD COLUMN verified boolean NOT NULL DEFAULT true;
+ALTER TABLE users ALTER COLUMN verified SET DEFAULT false;
+
+CREATE TABLE email_verification_tokens (
+	id serial NOT NULL,
+	user_id int NOT NULL,
+	email varchar(100) NOT NULL,
+	token_hash char(64) NOT NULL,
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	CONSTRAINT email_verification_tokens_pk PRIMARY KEY (id),
+	CONSTRAINT email_verification_tokens_unique UNIQUE (token_hash),
+	CONSTRAINT email_verification_tokens_users_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
@@ -0,0 +1,8 @@
+CREATE TABLE company_domains (
+	id serial NOT NULL,
+	company_id int NOT NULL,
+	"domain" varchar(255) NOT NULL,
+	CONSTRAINT company_domains_pk PRIMARY KEY (id),
+	CONSTRAINT company_domains_unique UNIQUE ("domain"),
+	CONSTRAINT company_domains_companies_fk FOREIGN KEY (company_id) REFERENCES public.companies(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
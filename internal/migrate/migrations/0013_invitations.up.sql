@@ -0,0 +1,16 @@
+CREATE TABLE invitations (
+	id serial NOT NULL,
+	email varchar(100) NOT NULL,
+	company_id int NOT NULL,
+	"role" text NOT NULL DEFAULT 'ROLE_USER',
+	invited_by int NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	expires_at timestamptz NOT NULL,
+	accepted_at timestamptz NULL,
+	revoked_at timestamptz NULL,
+	CONSTRAINT invitations_pk PRIMARY KEY (id),
+	CONSTRAINT invitations_companies_fk FOREIGN KEY (company_id) REFERENCES public.companies(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT invitations_users_fk FOREIGN KEY (invited_by) REFERENCES public.users(id) ON DELETE SET NULL ON UPDATE CASCADE
+);
+
+CREATE INDEX invitations_email_idx ON invitations (email);
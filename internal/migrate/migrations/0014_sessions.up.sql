@@ -0,0 +1,18 @@
+CREATE TABLE sessions (
+	id serial NOT NULL,
+	user_id int NOT NULL,
+	refresh_hash char(64) NOT NULL,
+	previous_refresh_hash char(64) NULL,
+	user_agent text NOT NULL DEFAULT '',
+	ip text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	last_used_at timestamptz NOT NULL DEFAULT NOW(),
+	expires_at timestamptz NOT NULL,
+	revoked_at timestamptz NULL,
+	CONSTRAINT sessions_pk PRIMARY KEY (id),
+	CONSTRAINT sessions_refresh_hash_unique UNIQUE (refresh_hash),
+	CONSTRAINT sessions_users_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX sessions_previous_refresh_hash_idx ON sessions (previous_refresh_hash);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS event_companies;
+
+DROP INDEX IF EXISTS events_company_id_idx;
+
+ALTER TABLE events
+	DROP CONSTRAINT IF EXISTS events_visibility_check,
+	DROP CONSTRAINT IF EXISTS events_companies_fk,
+	DROP COLUMN IF EXISTS visibility,
+	DROP COLUMN IF EXISTS company_id;
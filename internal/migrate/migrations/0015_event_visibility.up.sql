@@ -0,0 +1,16 @@
+ALTER TABLE events
+	ADD COLUMN company_id int NULL,
+	ADD COLUMN visibility text NOT NULL DEFAULT 'PUBLIC',
+	ADD CONSTRAINT events_companies_fk FOREIGN KEY (company_id) REFERENCES public.companies(id) ON DELETE RESTRICT ON UPDATE CASCADE,
+	ADD CONSTRAINT events_visibility_check CHECK (visibility IN ('PUBLIC', 'COMPANY', 'SELECTED') AND (visibility = 'PUBLIC' OR company_id IS NOT NULL));
+
+CREATE INDEX events_company_id_idx ON events (company_id);
+
+-- Companies, besides the owner, that can see an event with SELECTED visibility.
+CREATE TABLE event_companies (
+	event_id int NOT NULL,
+	company_id int NOT NULL,
+	CONSTRAINT event_companies_pk PRIMARY KEY (event_id, company_id),
+	CONSTRAINT event_companies_events_fk FOREIGN KEY (event_id) REFERENCES public.events(id) ON DELETE CASCADE ON UPDATE CASCADE,
+	CONSTRAINT event_companies_companies_fk FOREIGN KEY (company_id) REFERENCES public.companies(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
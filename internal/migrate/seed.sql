@@ -0,0 +1,73 @@
+-- Development data, loaded into an empty database with `go run ./cmd/migrate seed`.
+-- It has no admin account, create one with `participe-admin create-admin`.
+
+-- ===========================
+-- EMPRESAS
+-- ===========================
+INSERT INTO companies (name) VALUES
+('TechNova Solutions'),
+('Alfa Sistemas'),
+('Inova Digital');
+
+INSERT INTO company_domains (company_id, "domain") VALUES
+(1, 'technova.com'),
+(2, 'alfasistemas.com'),
+(3, 'inovadigital.com');
+
+-- ===========================
+-- USUÁRIOS
+-- ===========================
+INSERT INTO users (email, company_id, name, role, password, verified) VALUES
+('joao.silva@technova.com', 1, 'João Silva', 'ROLE_USER', '$2a$12$ONVS.jkh8u6EO0pb1o/41uOOj7oD5DCmDlkSeL7VEwOsa0EgGLzhm', true),
+('maria.souza@technova.com', 1, 'Maria Souza', 'ROLE_USER', '$2a$12$ONVS.jkh8u6EO0pb1o/41uOOj7oD5DCmDlkSeL7VEwOsa0EgGLzhm', true),
+('pedro.alves@alfasistemas.com', 2, 'Pedro Alves', 'ROLE_USER', '$2a$12$ONVS.jkh8u6EO0pb1o/41uOOj7oD5DCmDlkSeL7VEwOsa0EgGLzhm', true),
+('ana.martins@inovadigital.com', 3, 'Ana Martins', 'ROLE_USER', '$2a$12$ONVS.jkh8u6EO0pb1o/41uOOj7oD5DCmDlkSeL7VEwOsa0EgGLzhm', true);
+
+-- ===========================
+-- EVENTOS (passados e futuros)
+-- ===========================
+INSERT INTO events (name, description, date, end_date, company_id, visibility) VALUES
+('Treinamento de Integração', 'Treinamento inicial para novos colaboradores.', '2024-07-10 09:00:00-03', '2024-07-10 12:00:00-03', NULL, 'PUBLIC'),
+('Workshop de Produtividade', 'Sessão prática sobre ferramentas de produtividade.', '2024-10-15 14:00:00-03', '2024-10-15 17:00:00-03', NULL, 'PUBLIC'),
+('Palestra de Segurança da Informação', 'Apresentação sobre boas práticas de segurança.', '2025-01-20 10:00:00-03', '2025-01-20 11:30:00-03', NULL, 'PUBLIC'),
+('Hackathon Interno', 'Maratona de desenvolvimento entre equipes.', '2025-05-05 08:00:00-03', '2025-05-06 18:00:00-03', 1, 'SELECTED'),
+('Encontro Anual de Estratégia', 'Evento anual para alinhamento estratégico da empresa.', '2025-12-02 09:30:00-03', '2025-12-03 18:00:00-03', 2, 'SELECTED');
+
+-- Hackathon da TechNova aberto à Inova Digital, encontro da Alfa Sistemas aberto à Inova Digital
+INSERT INTO event_companies (event_id, company_id) VALUES
+(4, 3),
+(5, 3);
+
+INSERT INTO event_sessions (event_id, "name", starts_at, ends_at) VALUES
+(4, 'Dia 1', '2025-05-05 08:00:00-03', '2025-05-05 20:00:00-03'),
+(4, 'Dia 2', '2025-05-06 08:00:00-03', '2025-05-06 18:00:00-03'),
+(5, 'Dia 1', '2025-12-02 09:30:00-03', '2025-12-02 18:00:00-03'),
+(5, 'Dia 2', '2025-12-03 09:00:00-03', '2025-12-03 18:00:00-03');
+
+-- ===========================
+-- PRESENÇA DOS USUÁRIOS NOS EVENTOS
+-- ===========================
+INSERT INTO events_users (user_id, event_id, status, checked_in_at) VALUES
+-- Treinamento de Integração (passado)
+(1, 1, 'ATTENDED', '2024-07-10 09:00:00-03'),
+(2, 1, 'NO_SHOW', NULL),
+
+-- Workshop de Produtividade (passado)
+(2, 2, 'ATTENDED', '2024-10-15 14:00:00-03'),
+(3, 2, 'ATTENDED', '2024-10-15 14:05:00-03');
+
+INSERT INTO events_users (user_id, event_id) VALUES
+
+-- Palestra de Segurança da Informação (futuro)
+(1, 3),
+(3, 3),
+(4, 3),
+
+-- Hackathon Interno (futuro)
+(1, 4),
+(2, 4),
+(4, 4),
+
+-- Encontro Anual de Estratégia (futuro)
+(3, 5),
+(4, 5);
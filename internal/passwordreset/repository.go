@@ -0,0 +1,70 @@
+package passwordreset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+var ErrTokenNotFound = errors.New("password reset token not found")
+
+type RepositoryPostgres struct {
+	db db.DBTX
+}
+
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
+}
+
+// NewTransactorPostgres runs transactions on conn with the Postgres repositories bound to each.
+func NewTransactorPostgres(conn *sql.DB) *db.TransactorPostgres[Repositories] {
+	return db.NewTransactorPostgres(conn, func(tx db.DBTX) Repositories {
+		return Repositories{NewRepositoryPostgres(tx), user.NewRepositoryPostgres(tx)}
+	})
+}
+
+func (r *RepositoryPostgres) Insert(ctx context.Context, t *Token) (*Token, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, token_hash, expires_at, used_at, created_at`,
+		t.UserId, t.Hash, t.ExpiresAt)
+
+	var newToken Token
+	if err := row.Scan(&newToken.Id, &newToken.UserId, &newToken.Hash, &newToken.ExpiresAt, &newToken.UsedAt, &newToken.CreatedAt); err != nil {
+		return nil, fmt.Errorf("password_reset_repository: insert: %w", err)
+	}
+
+	return &newToken, nil
+}
+
+// Consume marks the unused, unexpired token with that hash as used and returns it.
+// Doing both in one statement keeps two concurrent requests from redeeming the same token.
+func (r *RepositoryPostgres) Consume(ctx context.Context, hash string) (*Token, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, token_hash, expires_at, used_at, created_at`, hash)
+
+	var t Token
+	if err := row.Scan(&t.Id, &t.UserId, &t.Hash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("password_reset_repository: consume: %w", ErrTokenNotFound)
+		}
+		return nil, fmt.Errorf("password_reset_repository: consume: %w", err)
+	}
+
+	return &t, nil
+}
+
+// DeleteByUser drops every pending token of the user, used ones are kept for the record.
+func (r *RepositoryPostgres) DeleteByUser(ctx context.Context, userId int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userId); err != nil {
+		return fmt.Errorf("password_reset_repository: delete by user: %w", err)
+	}
+
+	return nil
+}
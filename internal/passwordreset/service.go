@@ -0,0 +1,112 @@
+package passwordreset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/mail"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type Repository interface {
+	Insert(ctx context.Context, t *Token) (*Token, error)
+	Consume(ctx context.Context, hash string) (*Token, error)
+	DeleteByUser(ctx context.Context, userId int) error
+}
+
+var ErrInvalidToken = errors.New("invalid or expired password reset token")
+
+// Repositories are the ones ResetPassword changes together in a transaction.
+type Repositories struct {
+	Tokens Repository
+	Users  user.Repository
+}
+
+type Service struct {
+	repo       Repository
+	userRepo   user.Repository
+	transactor db.Transactor[Repositories]
+	mailer     mail.Mailer
+}
+
+func NewService(repo Repository, userRepo user.Repository, transactor db.Transactor[Repositories], mailer mail.Mailer) *Service {
+	return &Service{repo, userRepo, transactor, mailer}
+}
+
+// RequestReset emails a reset link to the user with that email, if there is an active one.
+// Unknown emails are not reported so the endpoint can't be used to find accounts.
+// link builds the URL sent in the email from the token.
+func (s *Service) RequestReset(ctx context.Context, email string, link func(token string) string) error {
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("password_reset_service: request reset: %w", err)
+	}
+
+	if !u.Active {
+		return nil
+	}
+
+	// Only the latest link works.
+	if err := s.repo.DeleteByUser(ctx, u.Id); err != nil {
+		return fmt.Errorf("password_reset_service: request reset: %w", err)
+	}
+
+	token, hash := auth.NewOpaqueToken()
+	if _, err := s.repo.Insert(ctx, &Token{UserId: u.Id, Hash: hash, ExpiresAt: time.Now().Add(TokenTTL)}); err != nil {
+		return fmt.Errorf("password_reset_service: request reset: %w", err)
+	}
+
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			u.Name, int(TokenTTL.Minutes()), link(token)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		return fmt.Errorf("password_reset_service: request reset: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password for the owner of the token, which can't be used again,
+// and returns that user.
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) (*user.User, error) {
+	var u *user.User
+	err := s.transactor.InTx(ctx, func(repos Repositories) error {
+		// The token stays usable if setting the password fails.
+		t, err := repos.Tokens.Consume(ctx, auth.HashOpaqueToken(token))
+		if err != nil {
+			return err
+		}
+
+		if u, err = repos.Users.FindById(ctx, t.UserId); err != nil {
+			return err
+		}
+
+		if err := u.SetPassword(newPassword); err != nil {
+			return err
+		}
+
+		if _, err := repos.Users.Update(ctx, u); err != nil {
+			return err
+		}
+
+		return repos.Tokens.DeleteByUser(ctx, u.Id)
+	})
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil, fmt.Errorf("password_reset_service: reset password: %w", ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("password_reset_service: reset password: %w", err)
+	}
+
+	return u, nil
+}
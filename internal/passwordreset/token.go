@@ -0,0 +1,16 @@
+package passwordreset
+
+import "time"
+
+// TokenTTL is how long a reset link stays valid.
+const TokenTTL = 30 * time.Minute
+
+// Token is a password reset request. Only the hash of the token sent by email is kept.
+type Token struct {
+	Id        int
+	UserId    int
+	Hash      string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,47 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+const quietZone = 4
+
+// Image renders the code with scale pixels per module, surrounded by the quiet zone.
+func (c *Code) Image(scale int) image.Image {
+	scale = max(scale, 1)
+	side := (c.Size + 2*quietZone) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := range c.Size {
+		for x := range c.Size {
+			if !c.Dark(x, y) {
+				continue
+			}
+			for dy := range scale {
+				for dx := range scale {
+					img.SetColorIndex((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// WritePNG encodes data as a QR code and writes it to w as a PNG image.
+func WritePNG(w io.Writer, data []byte, scale int) error {
+	c, err := Encode(data)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(w, c.Image(scale)); err != nil {
+		return fmt.Errorf("qrcode: write png: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/db"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+const sessionColumns = `id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at`
+
+type RepositoryPostgres struct {
+	db db.DBTX
+}
+
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row scanner, s *Session) error {
+	return row.Scan(&s.Id, &s.UserId, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+}
+
+func (r *RepositoryPostgres) Insert(ctx context.Context, s *Session, refreshHash string) (*Session, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO sessions (user_id, refresh_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+sessionColumns,
+		s.UserId, refreshHash, s.UserAgent, s.IP, s.ExpiresAt)
+
+	var newSession Session
+	if err := scanSession(row, &newSession); err != nil {
+		return nil, fmt.Errorf("session_repository: insert: %w", err)
+	}
+
+	return &newSession, nil
+}
+
+// FindActiveById returns the session if it wasn't revoked, didn't expire and its user is still active.
+func (r *RepositoryPostgres) FindActiveById(ctx context.Context, id int) (*Session, error) {
+	s := &Session{}
+	row := r.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		AND EXISTS (SELECT 1 FROM users WHERE users.id = sessions.user_id AND users.active)`, id)
+	if err := scanSession(row, s); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session_repository: find active by id: %w", ErrSessionNotFound)
+		}
+		return nil, fmt.Errorf("session_repository: find active by id: %w", err)
+	}
+	return s, nil
+}
+
+// FindByRefreshHash returns the session whose current refresh token has that hash.
+// reused is true when the hash belongs to the token the session rotated away from.
+func (r *RepositoryPostgres) FindByRefreshHash(ctx context.Context, hash string) (s *Session, reused bool, err error) {
+	s = &Session{}
+	row := r.db.QueryRowContext(ctx, `SELECT `+sessionColumns+`, previous_refresh_hash = $1 FROM sessions
+		WHERE refresh_hash = $1 OR previous_refresh_hash = $1`, hash)
+	if err := row.Scan(&s.Id, &s.UserId, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt, &reused); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, fmt.Errorf("session_repository: find by refresh hash: %w", ErrSessionNotFound)
+		}
+		return nil, false, fmt.Errorf("session_repository: find by refresh hash: %w", err)
+	}
+	return s, reused, nil
+}
+
+func (r *RepositoryPostgres) FindActiveByUser(ctx context.Context, userId int) (*[]Session, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("session_repository: find active by user: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := scanSession(rows, &s); err != nil {
+			return nil, fmt.Errorf("session_repository: find active by user: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("session_repository: find active by user: %w", err)
+	}
+
+	return &sessions, nil
+}
+
+// Rotate swaps the refresh token of an active session, as long as oldHash is
+// still the current one, and extends the session until expiresAt.
+func (r *RepositoryPostgres) Rotate(ctx context.Context, id int, oldHash, newHash string, expiresAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions
+		SET previous_refresh_hash = refresh_hash, refresh_hash = $1, last_used_at = NOW(), expires_at = $2
+		WHERE id = $3 AND refresh_hash = $4 AND revoked_at IS NULL AND expires_at > NOW()`,
+		newHash, expiresAt, id, oldHash)
+	if err != nil {
+		return fmt.Errorf("session_repository: rotate: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("session_repository: rotate: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("session_repository: rotate: %w", ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// Revoke ends a session of the user.
+func (r *RepositoryPostgres) Revoke(ctx context.Context, id, userId int) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userId)
+	if err != nil {
+		return fmt.Errorf("session_repository: revoke: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("session_repository: revoke: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("session_repository: revoke: %w", ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// RevokeAllByUser ends every session of the user except the one with id except, 0 keeps none.
+func (r *RepositoryPostgres) RevokeAllByUser(ctx context.Context, userId, except int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`, userId, except)
+	if err != nil {
+		return fmt.Errorf("session_repository: revoke all by user: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type Repository interface {
+	Insert(ctx context.Context, s *Session, refreshHash string) (*Session, error)
+	FindActiveById(ctx context.Context, id int) (*Session, error)
+	FindByRefreshHash(ctx context.Context, hash string) (*Session, bool, error)
+	FindActiveByUser(ctx context.Context, userId int) (*[]Session, error)
+	Rotate(ctx context.Context, id int, oldHash, newHash string, expiresAt time.Time) error
+	Revoke(ctx context.Context, id, userId int) error
+	RevokeAllByUser(ctx context.Context, userId, except int) error
+}
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+type Service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{repo}
+}
+
+// Start opens a session for u and returns it along with its refresh token.
+func (s *Service) Start(ctx context.Context, u *user.User, userAgent, ip string) (*Session, string, error) {
+	token, hash := auth.NewOpaqueToken()
+
+	sess, err := s.repo.Insert(ctx, &Session{
+		UserId:    u.Id,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}, hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("session_service: start: %w", err)
+	}
+
+	return sess, token, nil
+}
+
+// Refresh trades a refresh token for a new one. A token that was already traded
+// is a sign it leaked, so presenting it revokes the whole session.
+func (s *Service) Refresh(ctx context.Context, token string) (*Session, string, error) {
+	hash := auth.HashOpaqueToken(token)
+
+	sess, reused, err := s.repo.FindByRefreshHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, "", fmt.Errorf("session_service: refresh: %w", ErrInvalidRefreshToken)
+		}
+		return nil, "", fmt.Errorf("session_service: refresh: %w", err)
+	}
+
+	if reused {
+		if err := s.repo.Revoke(ctx, sess.Id, sess.UserId); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, "", fmt.Errorf("session_service: refresh: %w", err)
+		}
+		return nil, "", fmt.Errorf("session_service: refresh: %w", ErrInvalidRefreshToken)
+	}
+
+	newToken, newHash := auth.NewOpaqueToken()
+	if err := s.repo.Rotate(ctx, sess.Id, hash, newHash, time.Now().Add(RefreshTokenTTL)); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, "", fmt.Errorf("session_service: refresh: %w", ErrInvalidRefreshToken)
+		}
+		return nil, "", fmt.Errorf("session_service: refresh: %w", err)
+	}
+
+	return sess, newToken, nil
+}
+
+// Validate checks that the session an access token was issued for is still active.
+func (s *Service) Validate(ctx context.Context, id int) (*Session, error) {
+	sess, err := s.repo.FindActiveById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("session_service: validate: %w", err)
+	}
+
+	return sess, nil
+}
+
+// GetUserSessions lists the active sessions of the user, marking the one with id current.
+func (s *Service) GetUserSessions(ctx context.Context, userId, current int) (*[]Session, error) {
+	sessions, err := s.repo.FindActiveByUser(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("session_service: get user sessions: %w", err)
+	}
+
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].Id == current
+	}
+
+	return sessions, nil
+}
+
+func (s *Service) Revoke(ctx context.Context, id, userId int) error {
+	if err := s.repo.Revoke(ctx, id, userId); err != nil {
+		return fmt.Errorf("session_service: revoke: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeByRefreshToken ends the session a refresh token belongs to.
+func (s *Service) RevokeByRefreshToken(ctx context.Context, token string) error {
+	sess, _, err := s.repo.FindByRefreshHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return fmt.Errorf("session_service: revoke by refresh token: %w", ErrInvalidRefreshToken)
+		}
+		return fmt.Errorf("session_service: revoke by refresh token: %w", err)
+	}
+
+	if err := s.repo.Revoke(ctx, sess.Id, sess.UserId); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("session_service: revoke by refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAll logs the user out everywhere, but for the session with id except when it isn't 0.
+func (s *Service) RevokeAll(ctx context.Context, userId, except int) error {
+	if err := s.repo.RevokeAllByUser(ctx, userId, except); err != nil {
+		return fmt.Errorf("session_service: revoke all: %w", err)
+	}
+
+	return nil
+}
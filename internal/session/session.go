@@ -0,0 +1,21 @@
+package session
+
+import "time"
+
+// RefreshTokenTTL is how long a session lasts without being refreshed.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// Session is a login on one device. The access JWTs it issues carry its id, so
+// revoking the session logs the device out once the middleware sees it.
+type Session struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session of the request when listing a user's sessions.
+	Current bool `json:"current"`
+}
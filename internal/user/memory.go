@@ -0,0 +1,239 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/mthsgimenez/participe/internal/company"
+)
+
+// RepositoryMemory keeps users in memory. It behaves like RepositoryPostgres,
+// errors included, for tests and running without a database.
+type RepositoryMemory struct {
+	mu        sync.Mutex
+	lastId    int
+	users     map[int]User
+	calendars map[int]string
+	companies *company.RepositoryMemory
+
+	cascades []func(id int)
+}
+
+// NewRepositoryMemory returns an empty repository whose users must belong to
+// companies of the given repository, which then can't delete companies with users.
+func NewRepositoryMemory(companies *company.RepositoryMemory) *RepositoryMemory {
+	r := &RepositoryMemory{
+		users:     map[int]User{},
+		calendars: map[int]string{},
+		companies: companies,
+	}
+	companies.OnDelete(r.hasCompany, nil)
+	return r
+}
+
+// OnDelete registers cascade to drop the rows of another repository that are
+// deleted along with a user.
+func (r *RepositoryMemory) OnDelete(cascade func(id int)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cascades = append(r.cascades, cascade)
+}
+
+func (r *RepositoryMemory) hasCompany(companyId int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Company.Id == companyId {
+			return true
+		}
+	}
+	return false
+}
+
+// stored returns the copy of u the repository would load back, with only the company id.
+func stored(u User) User {
+	u.Company = company.Company{Id: u.Company.Id}
+	return u
+}
+
+func (r *RepositoryMemory) FindById(ctx context.Context, id int) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user_repository: find by id: %w", ErrUserNotFound)
+	}
+	return &u, nil
+}
+
+func (r *RepositoryMemory) FindByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user_repository: find by email: %w", ErrUserNotFound)
+}
+
+func (r *RepositoryMemory) FindByCalendarToken(ctx context.Context, hash string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.calendars {
+		if u := r.users[id]; token == hash && u.Active {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user_repository: find by calendar token: %w", ErrUserNotFound)
+}
+
+// sorted returns the users matching keep, ordered by id.
+func (r *RepositoryMemory) sorted(keep func(u User) bool) []User {
+	var users []User
+	for _, u := range r.users {
+		if keep(u) {
+			users = append(users, u)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Id < users[j].Id
+	})
+	return users
+}
+
+func (r *RepositoryMemory) FindAll(ctx context.Context) (*[]User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := r.sorted(func(User) bool { return true })
+	return &users, nil
+}
+
+func (r *RepositoryMemory) FindPage(ctx context.Context, filter Filter) (*[]User, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches := r.sorted(func(u User) bool {
+		return (filter.CompanyId == nil || u.Company.Id == *filter.CompanyId) &&
+			(filter.Role == nil || u.Role == *filter.Role) &&
+			(filter.Active == nil || u.Active == *filter.Active)
+	})
+
+	page := []User{}
+	if filter.Offset < len(matches) {
+		end := min(filter.Offset+filter.Limit, len(matches))
+		page = append(page, matches[filter.Offset:end]...)
+	}
+
+	// The Postgres query counts along with the rows, so it has no total for an empty
+	// first page.
+	total := len(matches)
+	if len(page) == 0 && filter.Offset == 0 {
+		total = 0
+	}
+
+	return &page, total, nil
+}
+
+// checkConstraints reports what would violate the unique email or the company foreign key.
+func (r *RepositoryMemory) checkConstraints(ctx context.Context, u *User) error {
+	for _, other := range r.users {
+		if other.Email == u.Email && other.Id != u.Id {
+			return ErrUniqueViolation
+		}
+	}
+
+	if exists, _ := r.companies.Exists(ctx, u.Company.Id); !exists {
+		return ErrForeignKeyViolation
+	}
+
+	return nil
+}
+
+func (r *RepositoryMemory) Insert(ctx context.Context, u *User) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkConstraints(ctx, u); err != nil {
+		return nil, fmt.Errorf("user_repository: insert user: %w", err)
+	}
+
+	r.lastId++
+	newUser := stored(*u)
+	newUser.Id = r.lastId
+	// Like the Postgres insert, users always start active.
+	newUser.Active = true
+	r.users[newUser.Id] = newUser
+
+	return &newUser, nil
+}
+
+func (r *RepositoryMemory) Update(ctx context.Context, u *User) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[u.Id]; !ok {
+		return nil, fmt.Errorf("user_repository: update user: %w", ErrUserNotFound)
+	}
+
+	if err := r.checkConstraints(ctx, u); err != nil {
+		return nil, fmt.Errorf("user_repository: update user: %w", err)
+	}
+
+	updatedUser := stored(*u)
+	r.users[u.Id] = updatedUser
+
+	return &updatedUser, nil
+}
+
+func (r *RepositoryMemory) SetCalendarToken(ctx context.Context, id int, hash *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return fmt.Errorf("user_repository: set calendar token: %w", ErrUserNotFound)
+	}
+
+	if hash == nil {
+		delete(r.calendars, id)
+	} else {
+		r.calendars[id] = *hash
+	}
+
+	return nil
+}
+
+func (r *RepositoryMemory) DeleteById(ctx context.Context, id int) error {
+	r.mu.Lock()
+	_, ok := r.users[id]
+	delete(r.users, id)
+	delete(r.calendars, id)
+	cascades := slices.Clone(r.cascades)
+	r.mu.Unlock()
+
+	if ok {
+		for _, cascade := range cascades {
+			cascade(id)
+		}
+	}
+
+	return nil
+}
+
+func (r *RepositoryMemory) Exists(ctx context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.users[id]
+	return ok, nil
+}
@@ -0,0 +1,82 @@
+package user
+
+// Permission is something a role can be allowed to do.
+type Permission int
+
+const (
+	PERM_MANAGE_COMPANIES = Permission(iota)
+	PERM_MANAGE_EVENTS
+	PERM_MANAGE_USERS
+	// PERM_RECORD_ATTENDANCE covers redeeming check-in tokens and marking attendance by hand.
+	PERM_RECORD_ATTENDANCE
+	PERM_VIEW_ATTENDANCE
+)
+
+// Scope is how far a permission reaches, scopes are ordered from narrowest to widest.
+type Scope int
+
+const (
+	SCOPE_NONE = Scope(iota)
+	// SCOPE_COMPANY only reaches the users of the user's own company.
+	SCOPE_COMPANY
+	SCOPE_ALL
+)
+
+// rolePermissions lists what each role can do, anything missing is denied.
+var rolePermissions = map[UserRole]map[Permission]Scope{
+	ROLE_ADMIN: {
+		PERM_MANAGE_COMPANIES:  SCOPE_ALL,
+		PERM_MANAGE_EVENTS:     SCOPE_ALL,
+		PERM_MANAGE_USERS:      SCOPE_ALL,
+		PERM_RECORD_ATTENDANCE: SCOPE_ALL,
+		PERM_VIEW_ATTENDANCE:   SCOPE_ALL,
+	},
+	ROLE_COMPANY_MANAGER: {
+		PERM_MANAGE_USERS:    SCOPE_COMPANY,
+		PERM_VIEW_ATTENDANCE: SCOPE_COMPANY,
+	},
+}
+
+// Scope returns how far p reaches for the role, SCOPE_NONE when it isn't granted.
+func (r UserRole) Scope(p Permission) Scope {
+	return rolePermissions[r][p]
+}
+
+// Can reports whether u has p, in any scope.
+func (u *User) Can(p Permission) bool {
+	return u.Role.Scope(p) > SCOPE_NONE
+}
+
+// CanFor reports whether u has p over the users of company companyId.
+func (u *User) CanFor(p Permission, companyId int) bool {
+	switch u.Role.Scope(p) {
+	case SCOPE_ALL:
+		return true
+	case SCOPE_COMPANY:
+		return companyId == u.Company.Id
+	default:
+		return false
+	}
+}
+
+// CanAssign reports whether u can give role to someone. Nobody can grant a
+// permission wider than their own.
+func (u *User) CanAssign(role UserRole) bool {
+	if !u.Can(PERM_MANAGE_USERS) {
+		return false
+	}
+
+	for p, scope := range rolePermissions[role] {
+		if scope > u.Role.Scope(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CanManage reports whether u can change, log out or delete other, who must be
+// in reach and can't hold a role u couldn't assign.
+func (u *User) CanManage(other *User) bool {
+	return u.CanFor(PERM_MANAGE_USERS, other.Company.Id) && u.CanAssign(other.Role)
+}
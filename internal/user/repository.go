@@ -1,11 +1,13 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 
 	"github.com/lib/pq"
+	"github.com/mthsgimenez/participe/internal/db"
 )
 
 var (
@@ -14,44 +16,68 @@ var (
 	ErrUniqueViolation     = errors.New("unique constraint violated")
 )
 
+const userColumns = `id, email, company_id, "name", "role", "password", active, verified`
+
 type RepositoryPostgres struct {
-	db *sql.DB
+	db db.DBTX
 }
 
-func NewRepositoryPostgres(db *sql.DB) *RepositoryPostgres {
-	return &RepositoryPostgres{db}
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
 }
 
-func (r *RepositoryPostgres) FindById(id int) (*User, error) {
-	user := &User{}
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads a row selected with userColumns into u.
+func scanUser(row scanner, u *User) error {
 	var role string
-	row := r.db.QueryRow(`SELECT id, email, company_id, "name", "role", "password" FROM users WHERE id = $1`, id)
-	if err := row.Scan(&user.Id, &user.Email, &user.Company.Id, &user.Name, &role, &user.hash); err != nil {
+	if err := row.Scan(&u.Id, &u.Email, &u.Company.Id, &u.Name, &role, &u.hash, &u.Active, &u.Verified); err != nil {
+		return err
+	}
+	u.Role = StringToUserRole(role)
+	return nil
+}
+
+func (r *RepositoryPostgres) FindById(ctx context.Context, id int) (*User, error) {
+	user := &User{}
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
+	if err := scanUser(row, user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("user_repository: find by id: %w", ErrUserNotFound)
 		}
 		return nil, fmt.Errorf("user_repository: find by id: %w", err)
 	}
-	user.Role = StringToUserRole(role)
 	return user, nil
 }
 
-func (r *RepositoryPostgres) FindByEmail(email string) (*User, error) {
+func (r *RepositoryPostgres) FindByEmail(ctx context.Context, email string) (*User, error) {
 	user := &User{}
-	var role string
-	row := r.db.QueryRow(`SELECT id, email, company_id, "name", "role", "password" FROM users WHERE email = $1`, email)
-	if err := row.Scan(&user.Id, &user.Email, &user.Company.Id, &user.Name, &role, &user.hash); err != nil {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
+	if err := scanUser(row, user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("user_repository: find by email: %w", ErrUserNotFound)
 		}
 		return nil, fmt.Errorf("user_repository: find by email: %w", err)
 	}
-	user.Role = StringToUserRole(role)
 	return user, nil
 }
 
-func (r *RepositoryPostgres) FindAll() (*[]User, error) {
-	rows, err := r.db.Query(`SELECT id, email, company_id, "name", "role", "password" FROM users`)
+func (r *RepositoryPostgres) FindByCalendarToken(ctx context.Context, hash string) (*User, error) {
+	user := &User{}
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE calendar_token = $1 AND active`, hash)
+	if err := scanUser(row, user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user_repository: find by calendar token: %w", ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("user_repository: find by calendar token: %w", err)
+	}
+	return user, nil
+}
+
+func (r *RepositoryPostgres) FindAll(ctx context.Context) (*[]User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users`)
 	if err != nil {
 		return nil, fmt.Errorf("user_repository: find all users: %w", err)
 	}
@@ -60,11 +86,9 @@ func (r *RepositoryPostgres) FindAll() (*[]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		var role string
-		if err := rows.Scan(&u.Id, &u.Email, &u.Company.Id, &u.Name, &role, &u.hash); err != nil {
+		if err := scanUser(rows, &u); err != nil {
 			return nil, fmt.Errorf("user_repository: scan user in find all: %w", err)
 		}
-		u.Role = StringToUserRole(role)
 		users = append(users, u)
 	}
 
@@ -75,53 +99,128 @@ func (r *RepositoryPostgres) FindAll() (*[]User, error) {
 	return &users, nil
 }
 
-func (r *RepositoryPostgres) Insert(u *User) (*User, error) {
-	row := r.db.QueryRow(`INSERT INTO users (email, company_id, "name", "role", "password") 
-		VALUES ($1, $2, $3, $4, $5) 
-		RETURNING id, email, company_id, "name", "role", "password"`,
-		u.Email, u.Company.Id, u.Name, u.Role.String(), u.hash)
+// FindPage returns the users matching the filter, ordered by id, along with how many match in total.
+func (r *RepositoryPostgres) FindPage(ctx context.Context, filter Filter) (*[]User, int, error) {
+	var role *string
+	if filter.Role != nil {
+		s := filter.Role.String()
+		role = &s
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+`, COUNT(*) OVER() FROM users
+		WHERE ($1::int IS NULL OR company_id = $1)
+		AND ($2::text IS NULL OR "role" = $2)
+		AND ($3::boolean IS NULL OR active = $3)
+		ORDER BY id ASC
+		LIMIT $4 OFFSET $5`,
+		filter.CompanyId, role, filter.Active, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("user_repository: find page: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	total := 0
+	for rows.Next() {
+		var u User
+		var roleName string
+		if err := rows.Scan(&u.Id, &u.Email, &u.Company.Id, &u.Name, &roleName, &u.hash, &u.Active, &u.Verified, &total); err != nil {
+			return nil, 0, fmt.Errorf("user_repository: find page: %w", err)
+		}
+		u.Role = StringToUserRole(roleName)
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("user_repository: find page: %w", err)
+	}
+
+	// An offset past the end returns no rows, and with them no window count.
+	if len(users) == 0 && filter.Offset > 0 {
+		row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users
+			WHERE ($1::int IS NULL OR company_id = $1)
+			AND ($2::text IS NULL OR "role" = $2)
+			AND ($3::boolean IS NULL OR active = $3)`,
+			filter.CompanyId, role, filter.Active)
+		if err := row.Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("user_repository: find page: %w", err)
+		}
+	}
+
+	return &users, total, nil
+}
+
+func (r *RepositoryPostgres) Insert(ctx context.Context, u *User) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO users (email, company_id, "name", "role", "password", verified)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+userColumns,
+		u.Email, u.Company.Id, u.Name, u.Role.String(), u.hash, u.Verified)
 
 	var newUser User
-	var role string
-	if err := row.Scan(&newUser.Id, &newUser.Email, &newUser.Company.Id, &newUser.Name, &role, &newUser.hash); err != nil {
+	if err := scanUser(row, &newUser); err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == "23505" { // Unique violation
 				return nil, fmt.Errorf("user_repository: insert user: %w", ErrUniqueViolation)
 			}
+			if pqErr.Code == "23503" { // Foreign key violation
+				return nil, fmt.Errorf("user_repository: insert user: %w", ErrForeignKeyViolation)
+			}
 		}
 		return nil, fmt.Errorf("user_repository: insert user: %w", err)
 	}
-	newUser.Role = StringToUserRole(role)
 
 	return &newUser, nil
 }
 
-func (r *RepositoryPostgres) Update(u *User) (*User, error) {
-	row := r.db.QueryRow(`UPDATE users 
-		SET email = $1, company_id = $2, "name" = $3, "role" = $4, "password" = $5 
-		WHERE id = $6 
-		RETURNING id, email, company_id, "name", "role", "password`,
-		u.Email, u.Company.Id, u.Name, u.Role.String(), u.hash, u.Id)
+func (r *RepositoryPostgres) Update(ctx context.Context, u *User) (*User, error) {
+	row := r.db.QueryRowContext(ctx, `UPDATE users
+		SET email = $1, company_id = $2, "name" = $3, "role" = $4, "password" = $5, active = $6, verified = $7
+		WHERE id = $8
+		RETURNING `+userColumns,
+		u.Email, u.Company.Id, u.Name, u.Role.String(), u.hash, u.Active, u.Verified, u.Id)
 
 	var updatedUser User
-	var role string
-	if err := row.Scan(&updatedUser.Id, &updatedUser.Email, &updatedUser.Company.Id, &updatedUser.Name, &role, &updatedUser.hash); err != nil {
+	if err := scanUser(row, &updatedUser); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user_repository: update user: %w", ErrUserNotFound)
+		}
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
 			if pqErr.Code == "23505" { // Unique violation
 				return nil, fmt.Errorf("user_repository: update user: %w", ErrUniqueViolation)
 			}
+			if pqErr.Code == "23503" { // Foreign key violation
+				return nil, fmt.Errorf("user_repository: update user: %w", ErrForeignKeyViolation)
+			}
 		}
 		return nil, fmt.Errorf("user_repository: update user: %w", err)
 	}
-	updatedUser.Role = StringToUserRole(role)
 
 	return &updatedUser, nil
 }
 
-func (r *RepositoryPostgres) DeleteById(id int) error {
-	_, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+// SetCalendarToken stores the hash of the user's calendar feed token, nil disables the feed.
+func (r *RepositoryPostgres) SetCalendarToken(ctx context.Context, id int, hash *string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET calendar_token = $1 WHERE id = $2`, hash, id)
+	if err != nil {
+		return fmt.Errorf("user_repository: set calendar token: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("user_repository: set calendar token: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("user_repository: set calendar token: %w", ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (r *RepositoryPostgres) DeleteById(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) {
@@ -134,8 +233,8 @@ func (r *RepositoryPostgres) DeleteById(id int) error {
 	return nil
 }
 
-func (r *RepositoryPostgres) Exists(id int) (bool, error) {
-	row := r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = $1`, id)
+func (r *RepositoryPostgres) Exists(ctx context.Context, id int) (bool, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE id = $1`, id)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return false, fmt.Errorf("user_repository: check if user exists: %w", err)
@@ -0,0 +1,245 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mthsgimenez/participe/internal/company"
+	"github.com/mthsgimenez/participe/internal/db/dbtest"
+)
+
+func TestRepositoryMemory(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, company.Repository) {
+		companies := company.NewRepositoryMemory()
+		return NewRepositoryMemory(companies), companies
+	})
+}
+
+func TestRepositoryPostgres(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, company.Repository) {
+		conn := dbtest.Open(t)
+		return NewRepositoryPostgres(conn), company.NewRepositoryPostgres(conn)
+	})
+}
+
+// testRepository checks the behaviour every Repository implementation must share.
+// newRepos returns an empty one along with the company repository it references.
+func testRepository(t *testing.T, newRepos func(t *testing.T) (Repository, company.Repository)) {
+	ctx := t.Context()
+
+	// Hashing is slow, every test starts from the same password.
+	var withPassword User
+	if err := withPassword.SetPassword("secret123"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+
+	// setup returns the repositories with a company, and a user of it ready to insert.
+	setup := func(t *testing.T) (Repository, company.Repository, *User) {
+		t.Helper()
+
+		repo, companies := newRepos(t)
+		cmp, err := companies.Insert(ctx, &company.Company{Name: "Acme"})
+		if err != nil {
+			t.Fatalf("insert company: %v", err)
+		}
+
+		u := &User{Email: "ana@acme.com", Name: "Ana", Company: *cmp, Role: ROLE_USER, hash: withPassword.hash}
+
+		return repo, companies, u
+	}
+
+	t.Run("insert and find", func(t *testing.T) {
+		repo, _, u := setup(t)
+
+		created, err := repo.Insert(ctx, u)
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+		if created.Id == 0 || created.Email != u.Email || created.Company.Id != u.Company.Id || !created.Active || created.Verified {
+			t.Fatalf("Insert returned %+v", created)
+		}
+
+		byId, err := repo.FindById(ctx, created.Id)
+		if err != nil {
+			t.Fatalf("FindById: %v", err)
+		}
+		if byId.Name != "Ana" || byId.Role != ROLE_USER || !byId.CheckPassword("secret123") {
+			t.Errorf("FindById returned %+v", byId)
+		}
+
+		byEmail, err := repo.FindByEmail(ctx, "ana@acme.com")
+		if err != nil || byEmail.Id != created.Id {
+			t.Errorf("FindByEmail = %+v, %v", byEmail, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo, _, _ := setup(t)
+
+		if _, err := repo.FindById(ctx, 404); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindById error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := repo.FindByEmail(ctx, "nobody@acme.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindByEmail error = %v, want ErrUserNotFound", err)
+		}
+		if _, err := repo.FindByCalendarToken(ctx, "nothing"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindByCalendarToken error = %v, want ErrUserNotFound", err)
+		}
+		if err := repo.SetCalendarToken(ctx, 404, nil); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("SetCalendarToken error = %v, want ErrUserNotFound", err)
+		}
+		if exists, err := repo.Exists(ctx, 404); err != nil || exists {
+			t.Errorf("Exists = %v, %v, want false", exists, err)
+		}
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		repo, _, u := setup(t)
+
+		if _, err := repo.Insert(ctx, u); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		if _, err := repo.Insert(ctx, u); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("Insert with a taken email: error = %v, want ErrUniqueViolation", err)
+		}
+
+		orphan := *u
+		orphan.Email = "orphan@acme.com"
+		orphan.Company = company.Company{Id: 404}
+		if _, err := repo.Insert(ctx, &orphan); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Insert with a missing company: error = %v, want ErrForeignKeyViolation", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo, companies, u := setup(t)
+
+		created, _ := repo.Insert(ctx, u)
+		other, _ := repo.Insert(ctx, &User{Email: "bia@acme.com", Name: "Bia", Company: u.Company})
+
+		created.Name = "Ana Maria"
+		created.Role = ROLE_COMPANY_MANAGER
+		created.Active = false
+		created.Verified = true
+		updated, err := repo.Update(ctx, created)
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if updated.Name != "Ana Maria" || updated.Role != ROLE_COMPANY_MANAGER || updated.Active || !updated.Verified {
+			t.Errorf("Update returned %+v", updated)
+		}
+
+		// Only the updated user changes.
+		untouched, _ := repo.FindById(ctx, other.Id)
+		if untouched.Name != "Bia" || untouched.Role != ROLE_USER {
+			t.Errorf("other user changed to %+v", untouched)
+		}
+
+		if _, err := repo.Update(ctx, &User{Id: 404, Email: "x@acme.com", Company: u.Company}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Update of a missing user: error = %v, want ErrUserNotFound", err)
+		}
+
+		taken := *created
+		taken.Email = other.Email
+		if _, err := repo.Update(ctx, &taken); !errors.Is(err, ErrUniqueViolation) {
+			t.Errorf("Update to a taken email: error = %v, want ErrUniqueViolation", err)
+		}
+
+		moved := *created
+		moved.Company = company.Company{Id: 404}
+		if _, err := repo.Update(ctx, &moved); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Update to a missing company: error = %v, want ErrForeignKeyViolation", err)
+		}
+
+		if exists, _ := companies.Exists(ctx, u.Company.Id); !exists {
+			t.Errorf("company disappeared")
+		}
+	})
+
+	t.Run("find page", func(t *testing.T) {
+		repo, companies, u := setup(t)
+		second, _ := companies.Insert(ctx, &company.Company{Name: "Other"})
+
+		repo.Insert(ctx, u)
+		repo.Insert(ctx, &User{Email: "bia@acme.com", Name: "Bia", Company: u.Company, Role: ROLE_ADMIN})
+		repo.Insert(ctx, &User{Email: "caio@other.com", Name: "Caio", Company: *second})
+
+		all, total, err := repo.FindPage(ctx, Filter{Limit: 2})
+		if err != nil {
+			t.Fatalf("FindPage: %v", err)
+		}
+		if len(*all) != 2 || total != 3 || (*all)[0].Email != "ana@acme.com" {
+			t.Errorf("FindPage = %d users, total %d", len(*all), total)
+		}
+
+		role := UserRole(ROLE_ADMIN)
+		admins, total, _ := repo.FindPage(ctx, Filter{Role: &role, Limit: 10})
+		if len(*admins) != 1 || total != 1 || (*admins)[0].Email != "bia@acme.com" {
+			t.Errorf("FindPage by role = %+v, total %d", *admins, total)
+		}
+
+		byCompany, total, _ := repo.FindPage(ctx, Filter{CompanyId: &second.Id, Limit: 10})
+		if len(*byCompany) != 1 || total != 1 {
+			t.Errorf("FindPage by company = %+v, total %d", *byCompany, total)
+		}
+
+		past, total, _ := repo.FindPage(ctx, Filter{Limit: 10, Offset: 10})
+		if len(*past) != 0 || total != 3 {
+			t.Errorf("FindPage past the end = %d users, total %d", len(*past), total)
+		}
+
+		list, _ := repo.FindAll(ctx)
+		if len(*list) != 3 {
+			t.Errorf("FindAll returned %d users", len(*list))
+		}
+	})
+
+	t.Run("calendar token", func(t *testing.T) {
+		repo, _, u := setup(t)
+
+		created, _ := repo.Insert(ctx, u)
+		hash := strings.Repeat("ab", 32)
+		if err := repo.SetCalendarToken(ctx, created.Id, &hash); err != nil {
+			t.Fatalf("SetCalendarToken: %v", err)
+		}
+
+		found, err := repo.FindByCalendarToken(ctx, hash)
+		if err != nil || found.Id != created.Id {
+			t.Errorf("FindByCalendarToken = %+v, %v", found, err)
+		}
+
+		// Deactivated users lose their feed.
+		found.Active = false
+		repo.Update(ctx, found)
+		if _, err := repo.FindByCalendarToken(ctx, hash); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindByCalendarToken of an inactive user: error = %v", err)
+		}
+
+		if err := repo.SetCalendarToken(ctx, created.Id, nil); err != nil {
+			t.Fatalf("SetCalendarToken(nil): %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo, companies, u := setup(t)
+
+		created, _ := repo.Insert(ctx, u)
+
+		if err := companies.DeleteById(ctx, u.Company.Id); !errors.Is(err, company.ErrForeignKeyViolation) {
+			t.Errorf("deleting a company with users: error = %v, want ErrForeignKeyViolation", err)
+		}
+
+		if err := repo.DeleteById(ctx, created.Id); err != nil {
+			t.Fatalf("DeleteById: %v", err)
+		}
+		if exists, _ := repo.Exists(ctx, created.Id); exists {
+			t.Errorf("user still exists after delete")
+		}
+
+		if err := companies.DeleteById(ctx, u.Company.Id); err != nil {
+			t.Errorf("deleting a company without users: %v", err)
+		}
+	})
+}
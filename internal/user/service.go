@@ -1,21 +1,32 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
+	"github.com/mthsgimenez/participe/internal/auth"
 	"github.com/mthsgimenez/participe/internal/company"
 )
 
 type Repository interface {
-	FindById(id int) (*User, error)
-	FindByEmail(email string) (*User, error)
-	FindAll() (*[]User, error)
-	Insert(u *User) (*User, error)
-	Update(u *User) (*User, error)
-	DeleteById(id int) error
-	Exists(id int) (bool, error)
+	FindById(ctx context.Context, id int) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByCalendarToken(ctx context.Context, hash string) (*User, error)
+	FindAll(ctx context.Context) (*[]User, error)
+	FindPage(ctx context.Context, filter Filter) (*[]User, int, error)
+	Insert(ctx context.Context, u *User) (*User, error)
+	Update(ctx context.Context, u *User) (*User, error)
+	DeleteById(ctx context.Context, id int) error
+	Exists(ctx context.Context, id int) (bool, error)
+	SetCalendarToken(ctx context.Context, id int, hash *string) error
 }
 
+var (
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrUserNotVerified = errors.New("user email not verified")
+)
+
 type Service struct {
 	userRepo    Repository
 	companyRepo company.Repository
@@ -25,13 +36,13 @@ func NewService(userRepo Repository, companyRepo company.Repository) *Service {
 	return &Service{userRepo, companyRepo}
 }
 
-func (s *Service) GetUser(id int) (*User, error) {
-	u, err := s.userRepo.FindById(id)
+func (s *Service) GetUser(ctx context.Context, id int) (*User, error) {
+	u, err := s.userRepo.FindById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: get user by id: %w", err)
 	}
 
-	comp, err := s.companyRepo.FindById(u.Company.Id)
+	comp, err := s.companyRepo.FindById(ctx, u.Company.Id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: get user by id (load company): %w", err)
 	}
@@ -40,13 +51,13 @@ func (s *Service) GetUser(id int) (*User, error) {
 	return u, nil
 }
 
-func (s *Service) GetUserByEmail(email string) (*User, error) {
-	u, err := s.userRepo.FindByEmail(email)
+func (s *Service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	u, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: get user by email: %w", err)
 	}
 
-	comp, err := s.companyRepo.FindById(u.Company.Id)
+	comp, err := s.companyRepo.FindById(ctx, u.Company.Id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: get user by email (load company): %w", err)
 	}
@@ -55,14 +66,44 @@ func (s *Service) GetUserByEmail(email string) (*User, error) {
 	return u, nil
 }
 
-func (s *Service) GetUsers() (*[]User, error) {
-	uList, err := s.userRepo.FindAll()
+// GetUserByCalendarToken finds the owner of a calendar feed token.
+func (s *Service) GetUserByCalendarToken(ctx context.Context, token string) (*User, error) {
+	u, err := s.userRepo.FindByCalendarToken(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("user_service: get user by calendar token: %w", err)
+	}
+
+	return u, nil
+}
+
+// RotateCalendarToken issues a new calendar feed token for the user, the previous one stops working.
+// Only the hash is stored, so the token can't be shown again later.
+func (s *Service) RotateCalendarToken(ctx context.Context, id int) (string, error) {
+	token, hash := auth.NewOpaqueToken()
+	if err := s.userRepo.SetCalendarToken(ctx, id, &hash); err != nil {
+		return "", fmt.Errorf("user_service: rotate calendar token: %w", err)
+	}
+
+	return token, nil
+}
+
+// DisableCalendarFeed revokes the user's calendar feed token.
+func (s *Service) DisableCalendarFeed(ctx context.Context, id int) error {
+	if err := s.userRepo.SetCalendarToken(ctx, id, nil); err != nil {
+		return fmt.Errorf("user_service: disable calendar feed: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) GetUsers(ctx context.Context) (*[]User, error) {
+	uList, err := s.userRepo.FindAll(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: get users: %w", err)
 	}
 
 	for i, u := range *uList {
-		comp, err := s.companyRepo.FindById(u.Company.Id)
+		comp, err := s.companyRepo.FindById(ctx, u.Company.Id)
 		if err != nil {
 			return nil, fmt.Errorf("user_service: get users (load company): %w", err)
 		}
@@ -72,13 +113,31 @@ func (s *Service) GetUsers() (*[]User, error) {
 	return uList, nil
 }
 
-func (s *Service) CreateUser(u *User) (*User, error) {
-	newUser, err := s.userRepo.Insert(u)
+// GetUsersPage returns a page of users matching the filter and the total number of matches.
+func (s *Service) GetUsersPage(ctx context.Context, filter Filter) (*[]User, int, error) {
+	uList, total, err := s.userRepo.FindPage(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("user_service: get users page: %w", err)
+	}
+
+	for i, u := range *uList {
+		comp, err := s.companyRepo.FindById(ctx, u.Company.Id)
+		if err != nil {
+			return nil, 0, fmt.Errorf("user_service: get users page (load company): %w", err)
+		}
+		(*uList)[i].Company = *comp
+	}
+
+	return uList, total, nil
+}
+
+func (s *Service) CreateUser(ctx context.Context, u *User) (*User, error) {
+	newUser, err := s.userRepo.Insert(ctx, u)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: create user: %w", err)
 	}
 
-	comp, err := s.companyRepo.FindById(newUser.Company.Id)
+	comp, err := s.companyRepo.FindById(ctx, newUser.Company.Id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: create user (load company): %w", err)
 	}
@@ -87,8 +146,8 @@ func (s *Service) CreateUser(u *User) (*User, error) {
 	return newUser, nil
 }
 
-func (s *Service) UpdateUser(id int, newData *User) (*User, error) {
-	user, err := s.userRepo.FindById(id)
+func (s *Service) UpdateUser(ctx context.Context, id int, newData *User) (*User, error) {
+	user, err := s.userRepo.FindById(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: update user (find by id): %w", err)
 	}
@@ -97,14 +156,16 @@ func (s *Service) UpdateUser(id int, newData *User) (*User, error) {
 	user.Name = newData.Name
 	user.Role = newData.Role
 	user.Company = newData.Company
+	user.Active = newData.Active
+	user.Verified = newData.Verified
 	user.hash = newData.hash
 
-	updatedUser, err := s.userRepo.Update(user)
+	updatedUser, err := s.userRepo.Update(ctx, user)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: update user: %w", err)
 	}
 
-	comp, err := s.companyRepo.FindById(updatedUser.Company.Id)
+	comp, err := s.companyRepo.FindById(ctx, updatedUser.Company.Id)
 	if err != nil {
 		return nil, fmt.Errorf("user_service: update user (load company): %w", err)
 	}
@@ -113,8 +174,116 @@ func (s *Service) UpdateUser(id int, newData *User) (*User, error) {
 	return updatedUser, nil
 }
 
-func (s *Service) DeleteUser(id int) error {
-	exists, err := s.userRepo.Exists(id)
+func (s *Service) PatchUser(ctx context.Context, id int, patch *UserPatch) (*User, error) {
+	user, err := s.userRepo.FindById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: patch user (find by id): %w", err)
+	}
+
+	if patch.CompanyId != nil {
+		exists, err := s.companyRepo.Exists(ctx, *patch.CompanyId)
+		if err != nil {
+			return nil, fmt.Errorf("user_service: patch user (check company): %w", err)
+		}
+
+		if !exists {
+			return nil, fmt.Errorf("user_service: patch user: %w", company.ErrCompanyNotFound)
+		}
+	}
+
+	patch.Apply(user)
+
+	updatedUser, err := s.userRepo.Update(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: patch user: %w", err)
+	}
+
+	comp, err := s.companyRepo.FindById(ctx, updatedUser.Company.Id)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: patch user (load company): %w", err)
+	}
+
+	updatedUser.Company = *comp
+	return updatedUser, nil
+}
+
+// UpdateProfile changes the name and email users can edit themselves. A new email
+// must belong to one of the company domains, like at registration, and leaves
+// the user unverified.
+func (s *Service) UpdateProfile(ctx context.Context, id int, name, email string) (*User, error) {
+	user, err := s.userRepo.FindById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: update profile (find by id): %w", err)
+	}
+
+	comp, err := s.companyRepo.FindById(ctx, user.Company.Id)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: update profile (load company): %w", err)
+	}
+
+	user.Name = name
+	if user.Email != email {
+		if !comp.AllowsEmail(email) {
+			return nil, fmt.Errorf("user_service: update profile: %w", company.ErrDomainNotAllowed)
+		}
+
+		// The new address has to be verified again.
+		user.Email = email
+		user.Verified = false
+	}
+
+	updatedUser, err := s.userRepo.Update(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("user_service: update profile: %w", err)
+	}
+
+	updatedUser.Company = *comp
+	return updatedUser, nil
+}
+
+// ChangePassword replaces the user's password, after checking the current one.
+func (s *Service) ChangePassword(ctx context.Context, id int, current, newPassword string) error {
+	user, err := s.userRepo.FindById(ctx, id)
+	if err != nil {
+		return fmt.Errorf("user_service: change password (find by id): %w", err)
+	}
+
+	if !user.CheckPassword(current) {
+		return fmt.Errorf("user_service: change password: %w", ErrWrongPassword)
+	}
+
+	if err := user.SetPassword(newPassword); err != nil {
+		return fmt.Errorf("user_service: change password: %w", err)
+	}
+
+	if _, err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("user_service: change password: %w", err)
+	}
+
+	return nil
+}
+
+// SetPassword replaces the user's password without asking for the current one,
+// for operators resetting an account.
+func (s *Service) SetPassword(ctx context.Context, id int, newPassword string) error {
+	user, err := s.userRepo.FindById(ctx, id)
+	if err != nil {
+		return fmt.Errorf("user_service: set password (find by id): %w", err)
+	}
+
+	if err := user.SetPassword(newPassword); err != nil {
+		return fmt.Errorf("user_service: set password: %w", err)
+	}
+
+	if _, err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("user_service: set password: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) DeleteUser(ctx context.Context, id int) error {
+	exists, err := s.userRepo.Exists(ctx, id)
 	if err != nil {
 		return fmt.Errorf("user_service: delete user (check exists): %w", err)
 	}
@@ -123,7 +292,7 @@ func (s *Service) DeleteUser(id int) error {
 		return fmt.Errorf("user_service: delete user: %w", ErrUserNotFound)
 	}
 
-	if err := s.userRepo.DeleteById(id); err != nil {
+	if err := s.userRepo.DeleteById(ctx, id); err != nil {
 		return fmt.Errorf("user_service: delete user: %w", err)
 	}
 
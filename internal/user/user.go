@@ -12,16 +12,35 @@ type UserRole int
 const (
 	ROLE_USER  = iota
 	ROLE_ADMIN = iota
+	// ROLE_COMPANY_MANAGER manages the users of their own company, see rolePermissions.
+	ROLE_COMPANY_MANAGER = iota
 )
 
 func (r UserRole) String() string {
-	return [...]string{"ROLE_USER", "ROLE_ADMIN"}[r]
+	return [...]string{"ROLE_USER", "ROLE_ADMIN", "ROLE_COMPANY_MANAGER"}[r]
+}
+
+// ParseUserRole is the strict version of StringToUserRole, it reports unknown roles
+// instead of falling back to ROLE_USER.
+func ParseUserRole(s string) (UserRole, bool) {
+	switch strings.ToUpper(s) {
+	case "ROLE_ADMIN":
+		return ROLE_ADMIN, true
+	case "ROLE_COMPANY_MANAGER":
+		return ROLE_COMPANY_MANAGER, true
+	case "ROLE_USER":
+		return ROLE_USER, true
+	default:
+		return ROLE_USER, false
+	}
 }
 
 func StringToUserRole(s string) UserRole {
 	switch strings.ToUpper(s) {
 	case "ROLE_ADMIN":
 		return ROLE_ADMIN
+	case "ROLE_COMPANY_MANAGER":
+		return ROLE_COMPANY_MANAGER
 	default:
 		return ROLE_USER
 	}
@@ -33,7 +52,41 @@ type User struct {
 	Company company.Company `json:"company"`
 	Name    string          `json:"name"`
 	Role    UserRole        `json:"role"`
-	hash    string          `json:"-"`
+	// Active is false for deactivated users, who can't log in anymore.
+	Active bool `json:"active"`
+	// Verified is set once the user opens the link sent to their email.
+	Verified bool   `json:"verified"`
+	hash     string `json:"-"`
+}
+
+// Filter selects a page of users, nil fields match everything.
+type Filter struct {
+	CompanyId *int
+	Role      *UserRole
+	Active    *bool
+	Limit     int
+	Offset    int
+}
+
+// UserPatch holds the fields an admin can change on a user, nil fields are left untouched.
+type UserPatch struct {
+	Role      *UserRole
+	CompanyId *int
+	Active    *bool
+}
+
+func (p *UserPatch) Apply(u *User) {
+	if p.Role != nil {
+		u.Role = *p.Role
+	}
+
+	if p.CompanyId != nil {
+		u.Company.Id = *p.CompanyId
+	}
+
+	if p.Active != nil {
+		u.Active = *p.Active
+	}
 }
 
 func (u *User) SetPassword(plaintext string) error {
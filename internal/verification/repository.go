@@ -0,0 +1,78 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+var ErrTokenNotFound = errors.New("email verification token not found")
+
+type RepositoryPostgres struct {
+	db db.DBTX
+}
+
+func NewRepositoryPostgres(conn db.DBTX) *RepositoryPostgres {
+	return &RepositoryPostgres{conn}
+}
+
+// NewTransactorPostgres runs transactions on conn with the Postgres repositories bound to each.
+func NewTransactorPostgres(conn *sql.DB) *db.TransactorPostgres[Repositories] {
+	return db.NewTransactorPostgres(conn, func(tx db.DBTX) Repositories {
+		return Repositories{NewRepositoryPostgres(tx), user.NewRepositoryPostgres(tx)}
+	})
+}
+
+func (r *RepositoryPostgres) Insert(ctx context.Context, t *Token) (*Token, error) {
+	row := r.db.QueryRowContext(ctx, `INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, email, token_hash, expires_at, created_at`,
+		t.UserId, t.Email, t.Hash, t.ExpiresAt)
+
+	var newToken Token
+	if err := row.Scan(&newToken.Id, &newToken.UserId, &newToken.Email, &newToken.Hash, &newToken.ExpiresAt, &newToken.CreatedAt); err != nil {
+		return nil, fmt.Errorf("verification_repository: insert: %w", err)
+	}
+
+	return &newToken, nil
+}
+
+// Consume deletes the unexpired token with that hash and returns it.
+func (r *RepositoryPostgres) Consume(ctx context.Context, hash string) (*Token, error) {
+	row := r.db.QueryRowContext(ctx, `DELETE FROM email_verification_tokens
+		WHERE token_hash = $1 AND expires_at > NOW()
+		RETURNING id, user_id, email, token_hash, expires_at, created_at`, hash)
+
+	var t Token
+	if err := row.Scan(&t.Id, &t.UserId, &t.Email, &t.Hash, &t.ExpiresAt, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("verification_repository: consume: %w", ErrTokenNotFound)
+		}
+		return nil, fmt.Errorf("verification_repository: consume: %w", err)
+	}
+
+	return &t, nil
+}
+
+// CountSince counts the tokens issued to the user after since, expired ones included.
+func (r *RepositoryPostgres) CountSince(ctx context.Context, userId int, since time.Time) (int, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_verification_tokens WHERE user_id = $1 AND created_at > $2`, userId, since)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, fmt.Errorf("verification_repository: count since: %w", err)
+	}
+	return count, nil
+}
+
+func (r *RepositoryPostgres) DeleteByUser(ctx context.Context, userId int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM email_verification_tokens WHERE user_id = $1`, userId); err != nil {
+		return fmt.Errorf("verification_repository: delete by user: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mthsgimenez/participe/internal/auth"
+	"github.com/mthsgimenez/participe/internal/db"
+	"github.com/mthsgimenez/participe/internal/mail"
+	"github.com/mthsgimenez/participe/internal/user"
+)
+
+type Repository interface {
+	Insert(ctx context.Context, t *Token) (*Token, error)
+	Consume(ctx context.Context, hash string) (*Token, error)
+	CountSince(ctx context.Context, userId int, since time.Time) (int, error)
+	DeleteByUser(ctx context.Context, userId int) error
+}
+
+var (
+	ErrInvalidToken    = errors.New("invalid or expired verification token")
+	ErrTooManyRequests = errors.New("too many verification emails requested")
+	ErrAlreadyVerified = errors.New("email already verified")
+)
+
+// Repositories are the ones Verify changes together in a transaction.
+type Repositories struct {
+	Tokens Repository
+	Users  user.Repository
+}
+
+type Service struct {
+	repo       Repository
+	userRepo   user.Repository
+	transactor db.Transactor[Repositories]
+	mailer     mail.Mailer
+}
+
+func NewService(repo Repository, userRepo user.Repository, transactor db.Transactor[Repositories], mailer mail.Mailer) *Service {
+	return &Service{repo, userRepo, transactor, mailer}
+}
+
+// SendVerification emails u a link to verify their address. Older links stay
+// valid until they expire. link builds the URL sent in the email from the token.
+func (s *Service) SendVerification(ctx context.Context, u *user.User, link func(token string) string) error {
+	if u.Verified {
+		return fmt.Errorf("verification_service: send verification: %w", ErrAlreadyVerified)
+	}
+
+	// Tokens are only deleted on use, so the ones issued in the last hour are all still there.
+	sent, err := s.repo.CountSince(ctx, u.Id, time.Now().Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("verification_service: send verification: %w", err)
+	}
+
+	if sent >= MaxEmailsPerHour {
+		return fmt.Errorf("verification_service: send verification: %w", ErrTooManyRequests)
+	}
+
+	token, hash := auth.NewOpaqueToken()
+	if _, err := s.repo.Insert(ctx, &Token{UserId: u.Id, Email: u.Email, Hash: hash, ExpiresAt: time.Now().Add(TokenTTL)}); err != nil {
+		return fmt.Errorf("verification_service: send verification: %w", err)
+	}
+
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to verify your email address. It expires in %d hours.\n\n%s\n",
+			u.Name, int(TokenTTL.Hours()), link(token)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		return fmt.Errorf("verification_service: send verification: %w", err)
+	}
+
+	return nil
+}
+
+// ResendVerification sends a new link to the unverified user with that email.
+// Unknown and verified emails are ignored so the endpoint can't be used to find accounts.
+func (s *Service) ResendVerification(ctx context.Context, email string, link func(token string) string) error {
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("verification_service: resend verification: %w", err)
+	}
+
+	if u.Verified || !u.Active {
+		return nil
+	}
+
+	if err := s.SendVerification(ctx, u, link); err != nil {
+		return fmt.Errorf("verification_service: resend verification: %w", err)
+	}
+
+	return nil
+}
+
+// Verify marks the owner of the token as verified.
+func (s *Service) Verify(ctx context.Context, token string) error {
+	err := s.transactor.InTx(ctx, func(repos Repositories) error {
+		t, err := repos.Tokens.Consume(ctx, auth.HashOpaqueToken(token))
+		if err != nil {
+			return err
+		}
+
+		u, err := repos.Users.FindById(ctx, t.UserId)
+		if err != nil {
+			return err
+		}
+
+		if u.Email != t.Email {
+			return ErrInvalidToken
+		}
+
+		u.Verified = true
+		if _, err := repos.Users.Update(ctx, u); err != nil {
+			return err
+		}
+
+		return repos.Tokens.DeleteByUser(ctx, u.Id)
+	})
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return fmt.Errorf("verification_service: verify: %w", ErrInvalidToken)
+		}
+		return fmt.Errorf("verification_service: verify: %w", err)
+	}
+
+	return nil
+}
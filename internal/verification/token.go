@@ -0,0 +1,21 @@
+package verification
+
+import "time"
+
+const (
+	// TokenTTL is how long a verification link stays valid.
+	TokenTTL = 24 * time.Hour
+	// MaxEmailsPerHour caps how many verification emails a user can ask for.
+	MaxEmailsPerHour = 3
+)
+
+// Token is a pending email verification. Only the hash of the token sent by email is kept.
+// Email is the address the link was sent to, the token is void once the user changes it.
+type Token struct {
+	Id        int
+	UserId    int
+	Email     string
+	Hash      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}